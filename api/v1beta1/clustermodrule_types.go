@@ -0,0 +1,64 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterModRule is the Schema for the clustermodrules API.
+// ClusterModRules are cluster-scoped ModRules - they apply to cluster-wide resources and,
+// through targetNamespaceRegex, to namespaced resources across namespaces.
+type ClusterModRule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ModRuleSpec   `json:"spec,omitempty"`
+	Status ModRuleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterModRuleList contains a list of ClusterModRule
+type ClusterModRuleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterModRule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterModRule{}, &ClusterModRuleList{})
+}
+
+// AsModRule returns a ModRule with an empty namespace which shares the metadata, spec and status of the ClusterModRule.
+// This is how ClusterModRules are represented in the ModRule store.
+func (m *ClusterModRule) AsModRule() *ModRule {
+	return &ModRule{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       "ModRule",
+		},
+		ObjectMeta: m.ObjectMeta,
+		Spec:       m.Spec,
+		Status:     m.Status,
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clustermodrulelog = logf.Log.WithName("clustermodrule-resource")
+
+// SetupWebhookWithManager hooks up the web hook with a manager.
+func (r *ClusterModRule) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+var _ webhook.Defaulter = &ClusterModRule{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterModRule) Default() {
+	clustermodrulelog.V(1).Info("default", "name", r.Name)
+
+	defaultModRuleSpec(&r.Spec)
+}
+
+var _ webhook.Validator = &ClusterModRule{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterModRule) ValidateCreate() error {
+	clustermodrulelog.V(1).Info("validate create", "name", r.Name)
+
+	return r.validateClusterModRule()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterModRule) ValidateUpdate(old runtime.Object) error {
+	clustermodrulelog.V(1).Info("validate update", "name", r.Name)
+
+	return r.validateClusterModRule()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterModRule) ValidateDelete() error {
+	clustermodrulelog.V(1).Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+func (r *ClusterModRule) validateClusterModRule() error {
+	// ClusterModRules may generate cluster-scoped resources and resources in any namespace.
+	if allErrs := validateModRuleSpec(&r.Spec, ""); len(allErrs) > 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: "api.kubemod.io", Kind: "ClusterModRule"},
+			r.Name,
+			allErrs)
+	}
+
+	return nil
+}
@@ -17,7 +17,10 @@ package v1beta1
 import (
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,6 +35,8 @@ type ModRuleSpec struct {
 	// Valid values are:
 	// - "Patch" - the rule performs modifications on all the matching resources as they are created.
 	// - "Reject" - the rule rejects the creation of all matching resources.
+	// - "Warn" - the rule allows all matching resources, but returns its rejectMessage to the client as an admission warning.
+	// - "Generate" - the rule creates the resources listed in generate whenever a matching resource is admitted.
 	Type ModRuleType `json:"type"`
 
 	// ExecutionTier is a value between -32767 and 32766.
@@ -39,11 +44,19 @@ type ModRuleSpec struct {
 	// ModRules are matched and executed in tiers, starting with the lowest tier.
 	// The results of executing all ModRules in a tier are passed as input to the ModRules in the next tier.
 	// This cascading execution continues until the highest tier of ModRules has been executed.
-	// ModRules in the same tier are executed in indeterminate order.
+	// ModRules in the same tier are executed in the order defined by their priority.
 	// +optional
 	// +kubebuilder:default=0
 	ExecutionTier int16 `json:"executionTier"`
 
+	// Priority controls the order in which this ModRule is executed as it relates to the other ModRules in the same execution tier.
+	// ModRules in the same tier are executed in ascending order of priority, then namespace, then name.
+	// Since each ModRule is applied on top of the results of the ModRules executed before it,
+	// the patch of a ModRule with a higher priority takes precedence when ModRules in the same tier modify the same fields.
+	// +optional
+	// +kubebuilder:default=0
+	Priority int32 `json:"priority"`
+
 	// AdmissionOperations specifies which admission hook operations this ModRule applies to.
 	// Valid values are:
 	// - "CREATE" - the rule applies to all matching resources as they are created.
@@ -59,13 +72,24 @@ type ModRuleSpec struct {
 	// +kubebuilder:validation:MinItems=1
 	Match []MatchItem `json:"match"`
 
+	// Exclude is an optional exclusion block evaluated after Match.
+	// When any of its criteria hits, the ModRule is skipped for the matching resource.
+	// +optional
+	Exclude *ModRuleExclude `json:"exclude,omitempty"`
+
 	// Patch is a list of patch operations to perform on the matching resources at the time of creation.
 	// The value part of a patch operation can be a golang template which accepts the resource as its context.
 	// This field must be provided for ModRules of type "patch"
 	// +optional
 	Patch []PatchOperation `json:"patch,omitempty"`
 
-	// RejectMessage is an optional message displayed when a resource is rejected by a Reject ModRule.
+	// Generate is a list of companion resources to create when a matching resource is admitted.
+	// This field must be provided for ModRules of type "Generate".
+	// +optional
+	Generate []GenerateItem `json:"generate,omitempty"`
+
+	// RejectMessage is an optional message displayed when a resource is rejected by a Reject ModRule
+	// or when a Warn ModRule returns a warning for a resource.
 	// The field is a Golang template evaluated in the context of the object being rejected.
 	// +optional
 	RejectMessage *string `json:"rejectMessage,omitempty"`
@@ -73,6 +97,102 @@ type ModRuleSpec struct {
 	// TargetNamespaceRegex is optional and only applies to ModRules in "kubemod-system" namespace.
 	// Its usage enables cluster-wide matching of namespaced resources.
 	TargetNamespaceRegex *string `json:"targetNamespaceRegex,omitempty"`
+
+	// TargetNamespaceSelector is optional and, just like TargetNamespaceRegex, only applies to ModRules in "kubemod-system" namespace.
+	// Its usage enables cluster-wide matching of namespaced resources deployed to namespaces whose labels match the selector.
+	// When both TargetNamespaceRegex and TargetNamespaceSelector are present, the namespace of a resource must satisfy both.
+	// +optional
+	TargetNamespaceSelector *metav1.LabelSelector `json:"targetNamespaceSelector,omitempty"`
+
+	// ExcludeNamespaceSelector is optional and only applies to ModRules in "kubemod-system" namespace.
+	// Namespaced resources deployed to namespaces whose labels match the selector are never matched by the ModRule.
+	// +optional
+	ExcludeNamespaceSelector *metav1.LabelSelector `json:"excludeNamespaceSelector,omitempty"`
+
+	// EnforcementAction controls whether the outcome of the ModRule is enforced.
+	// Valid values are:
+	// - "enforce" - the patches and rejections of the ModRule are applied to the matching resources.
+	// - "dryrun" - the ModRule is evaluated, but its patches and rejections are not applied.
+	//   Instead, KubeMod logs them, counts them in the ModRule's status and records them as an admission audit annotation.
+	// +optional
+	// +kubebuilder:default=enforce
+	EnforcementAction EnforcementActionType `json:"enforcementAction,omitempty"`
+
+	// FailurePolicy controls the outcome of an admission request when the ModRule cannot be evaluated against it.
+	// Valid values are:
+	// - "Ignore" - evaluation errors are logged and the request proceeds as if the ModRule did not exist.
+	// - "Fail" - evaluation errors deny the request.
+	// Evaluation errors include failures to retrieve synthetic references and to execute templates and patches.
+	// Requests admitted while the KubeMod admission webhook is unavailable are not evaluated at all, whatever the failure policy.
+	// +optional
+	// +kubebuilder:default=Ignore
+	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty"`
+
+	// Targets is an optional list of group/version/kind entries the ModRule applies to.
+	// When present, the ModRule is evaluated only against resources which match at least one of the targets.
+	// This allows KubeMod to skip the evaluation of the ModRule's match queries for all other resources.
+	// When omitted, the ModRule is evaluated against resources of any kind.
+	// +optional
+	Targets []ModRuleTarget `json:"targets,omitempty"`
+
+	// BackgroundApply instructs KubeMod to apply the ModRule to the existing resources of the ModRule's targets,
+	// in addition to the resources admitted from now on.
+	// The background application runs every time the ModRule changes and reports its progress in status.backgroundApply.
+	// Dry-run ModRules only report the resources they would have patched.
+	// BackgroundApply is supported only by ModRules of type Patch with targets.
+	// +optional
+	BackgroundApply bool `json:"backgroundApply,omitempty"`
+}
+
+// GenerateItem describes a companion resource created by a ModRule of type Generate.
+type GenerateItem struct {
+	// Template is the YAML manifest of the generated resource.
+	// It is a golang template evaluated against the context of the admitted resource.
+	// Namespaced resources with no namespace are generated in the namespace of the admitted resource.
+	Template string `json:"template"`
+
+	// Synchronize instructs KubeMod to overwrite the generated resource with the result of its template
+	// every time a matching resource is admitted.
+	// When false, the resource is created only if it does not exist yet.
+	// +optional
+	Synchronize bool `json:"synchronize,omitempty"`
+}
+
+// ModRuleTarget identifies the group, version and kind of the resources targeted by a ModRule.
+type ModRuleTarget struct {
+	// Group is the API group of the targeted resources.
+	// The core API group is represented by an empty string.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Version is the API version of the targeted resources.
+	// When omitted, resources of any version of the group are targeted.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Kind is the kind of the targeted resources.
+	Kind string `json:"kind"`
+}
+
+// ModRuleExclude describes the resources and admission requests a ModRule is not applied to.
+// A resource is excluded if any of the criteria below hits.
+type ModRuleExclude struct {
+	// Match is a list of match items which consist of select queries and expected match values or regular expressions.
+	// When all match items for an object are positive, the object is excluded.
+	// +optional
+	Match []MatchItem `json:"match,omitempty"`
+
+	// Namespaces is a list of namespaces whose resources are excluded.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Users is a list of usernames whose admission requests are excluded.
+	// +optional
+	Users []string `json:"users,omitempty"`
+
+	// Groups is a list of user groups whose admission requests are excluded.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
 }
 
 // MatchItem represents a single match query.
@@ -125,9 +245,19 @@ type PatchOperation struct {
 	Select *string `json:"select,omitempty"`
 
 	// Path is the JSON path to the target element.
+	// Path is required by all operations except "merge" and "strategic", which always target the whole resource.
+	// +optional
 	Path string `json:"path"`
 
+	// From is the JSON path to the source element of "move" and "copy" operations.
+	// Just like "path", it can contain placeholders constructed by "select".
+	// +optional
+	From *string `json:"from,omitempty"`
+
 	// Value is the JSON representation of the modification.
+	// For "test" operations, value is the JSON representation of the value the target element is expected to have.
+	// If the test fails, none of the patch operations of the ModRule are applied.
+	// For "merge" and "strategic" operations, value is the YAML fragment to merge into the target resource.
 	// The value is a golang template which is evaluated against the context of the target resource.
 	// KubeMod performs some analysis of the result of the template evaluation in order to infer its JSON type:
 	// - If the value matches the format of a JavaScript number, it is considered to be a number.
@@ -139,11 +269,31 @@ type PatchOperation struct {
 	// - If none of the above is true, the value is considered to be a string.
 	// +nullable
 	Value *string `json:"value,omitempty"`
+
+	// ValueFrom is an optional source of data for the value of the patch operation - a key of a ConfigMap or a Secret.
+	// The referenced object must be in the namespace of the ModRule. ClusterModRules reference objects in the KubeMod namespace.
+	// The resolved data is available to the value template as .ValueFrom.
+	// If value is omitted, the resolved data is used as a string value, or as the YAML fragment to merge for "merge" and "strategic" operations.
+	// ModRules are recompiled whenever the referenced object changes.
+	// +optional
+	ValueFrom *PatchValueSource `json:"valueFrom,omitempty"`
+}
+
+// PatchValueSource describes the source of data for the value of a patch operation.
+// Exactly one of its fields must be set.
+type PatchValueSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret. Only ClusterModRules may reference Secrets.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
 }
 
 // PatchOperationType describes the type of a JSON Patch operation.
 // Only one of the following ModRule types may be specified.
-// +kubebuilder:validation:Enum=add;replace;remove
+// +kubebuilder:validation:Enum=add;replace;remove;move;copy;test;merge;strategic
 type PatchOperationType string
 
 const (
@@ -153,11 +303,21 @@ const (
 	Replace PatchOperationType = "replace"
 	// Remove represents a "remove" JSON Patch operation.
 	Remove PatchOperationType = "remove"
+	// Move represents a "move" JSON Patch operation.
+	Move PatchOperationType = "move"
+	// Copy represents a "copy" JSON Patch operation.
+	Copy PatchOperationType = "copy"
+	// Test represents a "test" JSON Patch operation.
+	Test PatchOperationType = "test"
+	// Merge represents an RFC 7386 JSON merge patch applied against the whole resource.
+	Merge PatchOperationType = "merge"
+	// StrategicMerge represents a Kubernetes strategic merge patch applied against the whole resource.
+	StrategicMerge PatchOperationType = "strategic"
 )
 
 // ModRuleType describes the type of a ModRule.
 // Only one of the following ModRule types may be specified.
-// +kubebuilder:validation:Enum=Patch;Reject
+// +kubebuilder:validation:Enum=Patch;Reject;Warn;Generate
 type ModRuleType string
 
 // ModRuleAdmissionOperation describes the operation a ModRule is executed on.
@@ -171,6 +331,39 @@ const (
 
 	// ModRuleTypeReject indicates that the ModRule should reject Create events for resources which match the rule.
 	ModRuleTypeReject ModRuleType = "Reject"
+
+	// ModRuleTypeWarn indicates that the ModRule should allow resources which match the rule,
+	// but return the ModRule's reject message as an admission warning.
+	ModRuleTypeWarn ModRuleType = "Warn"
+
+	// ModRuleTypeGenerate indicates that the ModRule should create companion resources for the resources which match the rule.
+	ModRuleTypeGenerate ModRuleType = "Generate"
+)
+
+// EnforcementActionType describes how the outcome of a ModRule is enforced.
+// Only one of the following enforcement actions may be specified.
+// +kubebuilder:validation:Enum=enforce;dryrun
+type EnforcementActionType string
+
+const (
+	// EnforcementActionEnforce indicates that the patches and rejections of the ModRule are applied.
+	EnforcementActionEnforce EnforcementActionType = "enforce"
+
+	// EnforcementActionDryRun indicates that the patches and rejections of the ModRule are only recorded.
+	EnforcementActionDryRun EnforcementActionType = "dryrun"
+)
+
+// FailurePolicyType describes how errors in the evaluation of a ModRule are handled.
+// Only one of the following failure policies may be specified.
+// +kubebuilder:validation:Enum=Ignore;Fail
+type FailurePolicyType string
+
+const (
+	// FailurePolicyIgnore indicates that errors in the evaluation of the ModRule are ignored.
+	FailurePolicyIgnore FailurePolicyType = "Ignore"
+
+	// FailurePolicyFail indicates that errors in the evaluation of the ModRule deny the admission request.
+	FailurePolicyFail FailurePolicyType = "Fail"
 )
 
 // MatchForType describes the type of a match.
@@ -189,9 +382,151 @@ const (
 type ModRuleStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// ObservedGeneration is the most recent generation of the ModRule processed by KubeMod.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions contains the latest observations of the ModRule's state.
+	// Valid condition types are:
+	// - "Compiled" - indicates whether the ModRule's match queries, regular expressions and templates compiled successfully.
+	// - "Ready" - indicates whether the ModRule is loaded in KubeMod's ModRule store and in effect.
+	// +optional
+	Conditions []ModRuleCondition `json:"conditions,omitempty"`
+
+	// Stats contains runtime statistics of the ModRule accumulated by KubeMod since the ModRule was created.
+	// The statistics are flushed to the status periodically, so they may lag behind the actual admissions.
+	// +optional
+	Stats ModRuleStats `json:"stats,omitempty"`
+
+	// BackgroundApply reports the progress of the background application of the ModRule to existing resources.
+	// +optional
+	BackgroundApply *BackgroundApplyStatus `json:"backgroundApply,omitempty"`
+}
+
+// BackgroundApplyPhase describes the phase of the background application of a ModRule.
+type BackgroundApplyPhase string
+
+const (
+	// BackgroundApplyPhaseRunning indicates that the existing resources are being patched.
+	BackgroundApplyPhaseRunning BackgroundApplyPhase = "Running"
+
+	// BackgroundApplyPhaseCompleted indicates that all existing resources have been evaluated.
+	BackgroundApplyPhaseCompleted BackgroundApplyPhase = "Completed"
+
+	// BackgroundApplyPhaseFailed indicates that the existing resources could not be listed.
+	BackgroundApplyPhaseFailed BackgroundApplyPhase = "Failed"
+)
+
+// BackgroundApplyStatus reports the progress of the background application of a ModRule to existing resources.
+type BackgroundApplyStatus struct {
+	// ObservedGeneration is the generation of the ModRule being applied in the background.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase is the phase of the background application - one of Running, Completed or Failed.
+	// +optional
+	Phase BackgroundApplyPhase `json:"phase,omitempty"`
+
+	// Message describes the reason of a failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Scanned is the number of existing resources evaluated so far.
+	// +optional
+	Scanned int64 `json:"scanned,omitempty"`
+
+	// Patched is the number of existing resources patched so far.
+	// For dry-run ModRules, it is the number of existing resources which would have been patched.
+	// +optional
+	Patched int64 `json:"patched,omitempty"`
+
+	// Failed is the number of existing resources which could not be patched.
+	// +optional
+	Failed int64 `json:"failed,omitempty"`
+
+	// StartTime is the time the background application started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the background application completed or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// ModRuleStats contains runtime statistics of a ModRule.
+type ModRuleStats struct {
+	// Matched is the number of admissions the ModRule matched.
+	// +optional
+	Matched int64 `json:"matched,omitempty"`
+
+	// Patched is the number of admissions the ModRule produced a non-empty patch for.
+	// +optional
+	Patched int64 `json:"patched,omitempty"`
+
+	// Rejected is the number of admissions the ModRule rejected.
+	// +optional
+	Rejected int64 `json:"rejected,omitempty"`
+
+	// Errors is the number of runtime errors encountered while evaluating the ModRule,
+	// such as patch calculation, patch application and template failures.
+	// +optional
+	Errors int64 `json:"errors,omitempty"`
+
+	// DryRunPatched is the number of admissions a dry-run ModRule would have patched.
+	// +optional
+	DryRunPatched int64 `json:"dryRunPatched,omitempty"`
+
+	// DryRunRejected is the number of admissions a dry-run ModRule would have rejected.
+	// +optional
+	DryRunRejected int64 `json:"dryRunRejected,omitempty"`
+
+	// LastMatchTime is the time of the last admission the ModRule matched.
+	// +optional
+	LastMatchTime *metav1.Time `json:"lastMatchTime,omitempty"`
+}
+
+// ModRuleConditionType describes the type of a ModRule status condition.
+type ModRuleConditionType string
+
+const (
+	// ModRuleConditionCompiled indicates whether the ModRule compiled successfully.
+	ModRuleConditionCompiled ModRuleConditionType = "Compiled"
+
+	// ModRuleConditionReady indicates whether the ModRule is loaded in the ModRule store.
+	ModRuleConditionReady ModRuleConditionType = "Ready"
+
+	// ModRuleConditionPatchConflict indicates whether the patch of the ModRule writes to the same paths
+	// as the patch of another ModRule in the same execution tier and with the same priority.
+	ModRuleConditionPatchConflict ModRuleConditionType = "PatchConflict"
+)
+
+// ModRuleCondition describes the state of a ModRule at a certain point.
+type ModRuleCondition struct {
+	// Type is the type of the condition.
+	Type ModRuleConditionType `json:"type"`
+
+	// Status is the status of the condition - one of True, False or Unknown.
+	Status metav1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition transitioned from one status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a one-word CamelCase reason for the condition's last transition.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human-readable message indicating details about the transition.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ModRule is the Schema for the modrules API
 type ModRule struct {
@@ -215,7 +550,102 @@ func init() {
 	SchemeBuilder.Register(&ModRule{}, &ModRuleList{})
 }
 
+// IsDryRun returns true if the outcome of the ModRule should be recorded, but not enforced.
+func (m *ModRule) IsDryRun() bool {
+	return m.Spec.EnforcementAction == EnforcementActionDryRun
+}
+
+// FailsClosed returns true if errors in the evaluation of the ModRule should deny the admission request.
+func (m *ModRule) FailsClosed() bool {
+	return m.Spec.FailurePolicy == FailurePolicyFail
+}
+
+// GenerateNamespace returns the only namespace the ModRule may generate companion resources in,
+// or an empty string if the ModRule may generate cluster-scoped resources and resources in any namespace.
+// Only ClusterModRules (ModRules with an empty namespace) and ModRules deployed to the given cluster-wide namespace
+// are allowed to generate resources outside of their own namespace.
+func (m *ModRule) GenerateNamespace(clusterModRulesNamespace string) string {
+	if m.Namespace == "" || m.Namespace == clusterModRulesNamespace {
+		return ""
+	}
+
+	return m.Namespace
+}
+
+// IsPrivilegedGeneratedResource returns true if resources of the given group and kind grant permissions or credentials.
+// Secrets are only privileged if they are of the given type.
+// The operator generates resources with its own permissions, hence ModRules restricted to their own namespace may not generate
+// such resources - otherwise their authors could grant themselves permissions they do not have.
+func IsPrivilegedGeneratedResource(groupKind schema.GroupKind, secretType string) bool {
+	switch {
+	case groupKind.Group == rbacv1.GroupName:
+		return true
+
+	case groupKind.Group == corev1.GroupName && groupKind.Kind == "Secret":
+		return corev1.SecretType(secretType) == corev1.SecretTypeServiceAccountToken
+	}
+
+	return false
+}
+
 // GetNamespacedName returns a combined namespace/name.
+// Cluster-scoped ModRules have no namespace - their name is returned as-is.
 func (m *ModRule) GetNamespacedName() string {
+	if m.Namespace == "" {
+		return m.Name
+	}
+
 	return fmt.Sprintf("%s/%s", m.Namespace, m.Name)
 }
+
+// HasAdmissionOperation returns true if the ModRule applies to the given admission operation.
+func (s *ModRuleSpec) HasAdmissionOperation(admissionOperation ModRuleAdmissionOperation) bool {
+	for _, op := range s.AdmissionOperations {
+		if op == admissionOperation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCondition returns the status condition of the given type or nil if no such condition exists.
+func (s *ModRuleStatus) GetCondition(conditionType ModRuleConditionType) *ModRuleCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// SetCondition adds or updates a status condition.
+// The condition's LastTransitionTime is only updated if its status changes.
+// SetCondition returns true if the condition was added or modified.
+func (s *ModRuleStatus) SetCondition(condition ModRuleCondition) bool {
+	existing := s.GetCondition(condition.Type)
+
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+
+		s.Conditions = append(s.Conditions, condition)
+		return true
+	}
+
+	if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+
+	if existing.Status != condition.Status {
+		existing.LastTransitionTime = metav1.Now()
+	}
+
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+
+	return true
+}
@@ -0,0 +1,84 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ModRuleStatus", func() {
+	// The transition time of the existing conditions - far enough in the past to tell it apart from the time of a new transition.
+	lastTransitionTime := metav1.Unix(1600000000, 0)
+
+	compiled := func(status metav1.ConditionStatus, reason string, message string) ModRuleCondition {
+		return ModRuleCondition{Type: ModRuleConditionCompiled, Status: status, Reason: reason, Message: message}
+	}
+
+	DescribeTable("SetCondition", func(existing []ModRuleCondition, condition ModRuleCondition, expectedChanged bool, expectedTransition bool) {
+		status := &ModRuleStatus{}
+
+		for _, c := range existing {
+			c.LastTransitionTime = lastTransitionTime
+			status.Conditions = append(status.Conditions, c)
+		}
+
+		Expect(status.SetCondition(condition)).To(Equal(expectedChanged))
+
+		actual := status.GetCondition(condition.Type)
+		Expect(actual).NotTo(BeNil())
+		Expect(actual.Status).To(Equal(condition.Status))
+		Expect(actual.Reason).To(Equal(condition.Reason))
+		Expect(actual.Message).To(Equal(condition.Message))
+		Expect(actual.LastTransitionTime.Equal(&lastTransitionTime)).To(Equal(!expectedTransition))
+
+		// Conditions are updated in place - a condition is only appended if none of its type exists.
+		if len(existing) > 0 {
+			Expect(status.Conditions).To(HaveLen(len(existing)))
+		} else {
+			Expect(status.Conditions).To(HaveLen(1))
+		}
+	},
+		Entry("new condition is added",
+			nil,
+			compiled(metav1.ConditionTrue, "CompilationSucceeded", ""), true, true),
+		Entry("identical condition is not changed",
+			[]ModRuleCondition{compiled(metav1.ConditionTrue, "CompilationSucceeded", "")},
+			compiled(metav1.ConditionTrue, "CompilationSucceeded", ""), false, false),
+		Entry("status change is a transition",
+			[]ModRuleCondition{compiled(metav1.ConditionTrue, "CompilationSucceeded", "")},
+			compiled(metav1.ConditionFalse, "CompilationFailed", "invalid patch"), true, true),
+		Entry("message change is not a transition",
+			[]ModRuleCondition{compiled(metav1.ConditionFalse, "CompilationFailed", "invalid patch")},
+			compiled(metav1.ConditionFalse, "CompilationFailed", "invalid match"), true, false),
+		Entry("reason change is not a transition",
+			[]ModRuleCondition{compiled(metav1.ConditionFalse, "CompilationFailed", "invalid patch")},
+			compiled(metav1.ConditionFalse, "NotLoaded", "invalid patch"), true, false),
+	)
+
+	It("should only touch the condition of the given type", func() {
+		status := &ModRuleStatus{Conditions: []ModRuleCondition{
+			{Type: ModRuleConditionReady, Status: metav1.ConditionTrue, Reason: "Loaded", LastTransitionTime: lastTransitionTime},
+		}}
+
+		Expect(status.SetCondition(compiled(metav1.ConditionFalse, "CompilationFailed", "invalid patch"))).To(BeTrue())
+
+		Expect(status.Conditions).To(HaveLen(2))
+		Expect(status.GetCondition(ModRuleConditionReady).Status).To(Equal(metav1.ConditionTrue))
+		Expect(status.GetCondition(ModRuleConditionReady).LastTransitionTime).To(Equal(lastTransitionTime))
+	})
+})
@@ -18,16 +18,20 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"strings"
 
 	"github.com/kubemod/kubemod/expressions"
 	"github.com/kubemod/kubemod/util"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 )
 
 // log is for logging in this package.
@@ -36,8 +40,26 @@ var (
 	jsonPathLanguage = expressions.NewKubeModJSONPathLanguage()
 )
 
+var (
+	// webhookClusterModRulesNamespace is the namespace where cluster-wide ModRules are deployed.
+	// ModRules deployed to it may generate resources outside of their own namespace, just like ClusterModRules.
+	webhookClusterModRulesNamespace string
+	// webhookRESTMapper is used to tell whether the companion resources of Generate ModRules are cluster-scoped.
+	// When nil, the scope of the kinds of companion resources is not validated.
+	webhookRESTMapper meta.RESTMapper
+	// templateActionRegex matches the actions of golang templates.
+	templateActionRegex = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+)
+
+// templateActionPlaceholder stands for the actions of generate templates when templates are statically validated.
+const templateActionPlaceholder = "__kubemod_template_action__"
+
 // SetupWebhookWithManager hooks up the web hook with a manager.
-func (r *ModRule) SetupWebhookWithManager(mgr ctrl.Manager) error {
+// The given cluster-wide namespace and the REST mapper of the manager are used to validate the scope of the resources generated by ModRules.
+func (r *ModRule) SetupWebhookWithManager(mgr ctrl.Manager, clusterModRulesNamespace string) error {
+	webhookClusterModRulesNamespace = clusterModRulesNamespace
+	webhookRESTMapper = mgr.GetRESTMapper()
+
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
 		Complete()
@@ -51,16 +73,38 @@ var _ webhook.Defaulter = &ModRule{}
 func (r *ModRule) Default() {
 	modrulelog.V(1).Info("default", "name", r.Name)
 
-	for i := range r.Spec.Match {
-		mi := &r.Spec.Match[i]
-		if mi.MatchFor == "" {
-			mi.MatchFor = MatchForTypeAny
-		}
+	defaultModRuleSpec(&r.Spec)
+}
+
+// defaultModRuleSpec fills out the default values of the spec of ModRules and ClusterModRules.
+func defaultModRuleSpec(spec *ModRuleSpec) {
+	defaultMatchItems(spec.Match)
+
+	if spec.Exclude != nil {
+		defaultMatchItems(spec.Exclude.Match)
 	}
 
 	// If no admission operations are specified, default to CREATE and UPDATE.
-	if len(r.Spec.AdmissionOperations) == 0 {
-		r.Spec.AdmissionOperations = []ModRuleAdmissionOperation{"CREATE", "UPDATE"}
+	if len(spec.AdmissionOperations) == 0 {
+		spec.AdmissionOperations = []ModRuleAdmissionOperation{"CREATE", "UPDATE"}
+	}
+
+	if spec.EnforcementAction == "" {
+		spec.EnforcementAction = EnforcementActionEnforce
+	}
+
+	if spec.FailurePolicy == "" {
+		spec.FailurePolicy = FailurePolicyIgnore
+	}
+}
+
+// defaultMatchItems fills out the default values of the given match items.
+func defaultMatchItems(matchItems []MatchItem) {
+	for i := range matchItems {
+		mi := &matchItems[i]
+		if mi.MatchFor == "" {
+			mi.MatchFor = MatchForTypeAny
+		}
 	}
 }
 
@@ -88,61 +132,150 @@ func (r *ModRule) ValidateDelete() error {
 }
 
 func (r *ModRule) validateModRule() error {
+	allErrs := validateModRuleSpec(&r.Spec, r.GenerateNamespace(webhookClusterModRulesNamespace))
+
+	// Secrets can only be referenced by ClusterModRules - otherwise anyone allowed to deploy a ModRule
+	// could read the Secrets of its namespace through the ModRule's patch, even without having access to them.
+	for i, po := range r.Spec.Patch {
+		if po.ValueFrom != nil && po.ValueFrom.SecretKeyRef != nil {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec").Child("patch").Index(i).Child("valueFrom").Child("secretKeyRef"), "only ClusterModRules may source patch values from Secrets"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: "api.kubemod.io", Kind: "ModRule"},
+			r.Name,
+			allErrs)
+	}
+
+	return nil
+}
+
+// validateModRuleSpec validates the spec of ModRules and ClusterModRules.
+// If generateNamespace is not empty, the generate templates are expected to render namespaced resources in that namespace only.
+func validateModRuleSpec(spec *ModRuleSpec, generateNamespace string) field.ErrorList {
 	var (
 		allErrs field.ErrorList
 		err     error
 	)
 
-	if r.Spec.Type != ModRuleTypePatch && r.Spec.Type != ModRuleTypeReject {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("type"), r.Spec.Type, "unrecognized ModRule type"))
+	if spec.Type != ModRuleTypePatch && spec.Type != ModRuleTypeReject && spec.Type != ModRuleTypeWarn && spec.Type != ModRuleTypeGenerate {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("type"), spec.Type, "unrecognized ModRule type"))
 	}
 
-	if r.Spec.Type != ModRuleTypePatch && len(r.Spec.Patch) > 0 {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("patch"), r.Spec.Patch, "field 'patch' should be present only for ModRules of type Patch"))
+	if spec.Type != ModRuleTypePatch && len(spec.Patch) > 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("patch"), spec.Patch, "field 'patch' should be present only for ModRules of type Patch"))
 	}
 
-	if r.Spec.Type == ModRuleTypePatch && len(r.Spec.Patch) == 0 {
+	if spec.Type == ModRuleTypePatch && len(spec.Patch) == 0 {
 		allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("patch"), "field 'patch' cannot be empty for ModRules of type Patch"))
 	}
 
-	if r.Spec.Type != ModRuleTypeReject && r.Spec.RejectMessage != nil {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("rejectMessage"), *r.Spec.RejectMessage, "field 'rejectMessage' should be present only for ModRules of type Reject"))
+	if spec.Type != ModRuleTypeGenerate && len(spec.Generate) > 0 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("generate"), spec.Generate, "field 'generate' should be present only for ModRules of type Generate"))
+	}
+
+	if spec.Type == ModRuleTypeGenerate && len(spec.Generate) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("generate"), "field 'generate' cannot be empty for ModRules of type Generate"))
+	}
+
+	if spec.Type != ModRuleTypeReject && spec.Type != ModRuleTypeWarn && spec.RejectMessage != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("rejectMessage"), *spec.RejectMessage, "field 'rejectMessage' should be present only for ModRules of type Reject or Warn"))
+	}
+
+	if spec.EnforcementAction != "" && spec.EnforcementAction != EnforcementActionEnforce && spec.EnforcementAction != EnforcementActionDryRun {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("enforcementAction"), spec.EnforcementAction, "unrecognized enforcementAction value"))
+	}
+
+	if spec.EnforcementAction == EnforcementActionDryRun && spec.Type != ModRuleTypePatch && spec.Type != ModRuleTypeReject {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("enforcementAction"), spec.EnforcementAction, "enforcementAction 'dryrun' is supported only by ModRules of type Patch and Reject"))
+	}
+
+	if spec.FailurePolicy != "" && spec.FailurePolicy != FailurePolicyIgnore && spec.FailurePolicy != FailurePolicyFail {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("failurePolicy"), spec.FailurePolicy, "unrecognized failurePolicy value"))
 	}
 
 	// MinInt16 and MaxInt16 are invalid execution tier values.
-	if r.Spec.ExecutionTier == math.MinInt16 || r.Spec.ExecutionTier == math.MaxInt16 {
-		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("executionTier"), r.Spec.ExecutionTier, "field 'executionTier' should be an integer value between -32767 and 32766"))
+	if spec.ExecutionTier == math.MinInt16 || spec.ExecutionTier == math.MaxInt16 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("executionTier"), spec.ExecutionTier, "field 'executionTier' should be an integer value between -32767 and 32766"))
 	}
 
 	// Validate the ModRule match items.
-	for i, matchItem := range r.Spec.Match {
-		// match.select is required.
-		if matchItem.Select == "" {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("match").Index(i).Child("select"), matchItem.Select, "spec.match[].select in body must be non-empty string"))
-		} else {
-			// Test the match query.
-			_, err = jsonPathLanguage.NewEvaluable(matchItem.Select)
+	allErrs = append(allErrs, validateMatchItems(field.NewPath("spec").Child("match"), spec.Match)...)
 
-			if err != nil {
-				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("match").Index(i).Child("select"), matchItem.Select, fmt.Sprintf("%v", err)))
-			}
+	// Validate the match items of the exclude block.
+	if spec.Exclude != nil {
+		allErrs = append(allErrs, validateMatchItems(field.NewPath("spec").Child("exclude").Child("match"), spec.Exclude.Match)...)
+	}
+
+	// Validate the namespace selectors.
+	if spec.TargetNamespaceSelector != nil {
+		if _, err = metav1.LabelSelectorAsSelector(spec.TargetNamespaceSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("targetNamespaceSelector"), spec.TargetNamespaceSelector, fmt.Sprintf("%v", err)))
 		}
+	}
 
-		// Then the optional target regexp.
-		if matchItem.MatchRegex != nil {
-			_, err = regexp.Compile(*matchItem.MatchRegex)
-			if err != nil {
-				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("match").Index(i).Child("matchRegex"), *matchItem.MatchRegex, fmt.Sprintf("%v", err)))
-			}
+	if spec.ExcludeNamespaceSelector != nil {
+		if _, err = metav1.LabelSelectorAsSelector(spec.ExcludeNamespaceSelector); err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("excludeNamespaceSelector"), spec.ExcludeNamespaceSelector, fmt.Sprintf("%v", err)))
 		}
+	}
 
-		if matchItem.MatchFor != MatchForTypeAny && matchItem.MatchFor != MatchForTypeAll {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("match").Index(i).Child("matchFor"), matchItem.MatchFor, "unrecognized matchFor value"))
+	// Validate the targets.
+	for i, target := range spec.Targets {
+		if target.Kind == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("targets").Index(i).Child("kind"), "spec.targets[].kind in body must be non-empty string"))
+		}
+	}
+
+	// Background application lists the existing resources of the ModRule's targets and patches them as if they were updated.
+	if spec.BackgroundApply {
+		if spec.Type != ModRuleTypePatch {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("backgroundApply"), spec.BackgroundApply, "field 'backgroundApply' is supported only by ModRules of type Patch"))
+		}
+
+		if len(spec.Targets) == 0 {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("targets"), "field 'targets' cannot be empty for ModRules with backgroundApply"))
+		}
+
+		if !spec.HasAdmissionOperation("CREATE") && !spec.HasAdmissionOperation("UPDATE") {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("admissionOperations"), spec.AdmissionOperations, "field 'admissionOperations' should include CREATE or UPDATE for ModRules with backgroundApply"))
 		}
 	}
 
 	// Validate the patch value templates and optional select queries.
-	for i, po := range r.Spec.Patch {
+	for i, po := range spec.Patch {
+		// Field from is required by move and copy operations and meaningless for the rest.
+		if (po.Operation == Move || po.Operation == Copy) && (po.From == nil || *po.From == "") {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("patch").Index(i).Child("from"), fmt.Sprintf("field 'from' is required for patch operations of type %s", po.Operation)))
+		}
+
+		if po.Operation != Move && po.Operation != Copy && po.From != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("patch").Index(i).Child("from"), *po.From, "field 'from' should be present only for patch operations of type move or copy"))
+		}
+
+		// Merge operations apply their value against the whole resource.
+		if po.Operation == Merge || po.Operation == StrategicMerge {
+			if po.Path != "" {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("patch").Index(i).Child("path"), po.Path, fmt.Sprintf("field 'path' is not allowed for patch operations of type %s", po.Operation)))
+			}
+
+			if po.Select != nil {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("patch").Index(i).Child("select"), *po.Select, fmt.Sprintf("field 'select' is not allowed for patch operations of type %s", po.Operation)))
+			}
+
+			if (po.Value == nil || *po.Value == "") && po.ValueFrom == nil {
+				allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("patch").Index(i).Child("value"), fmt.Sprintf("field 'value' or 'valueFrom' is required for patch operations of type %s", po.Operation)))
+			}
+		} else if po.Path == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("patch").Index(i).Child("path"), fmt.Sprintf("field 'path' is required for patch operations of type %s", po.Operation)))
+		}
+
+		if po.ValueFrom != nil {
+			allErrs = append(allErrs, validatePatchValueSource(field.NewPath("spec").Child("patch").Index(i).Child("valueFrom"), po.Operation, po.ValueFrom)...)
+		}
+
 		if po.Value != nil {
 			value := *po.Value
 
@@ -164,21 +297,156 @@ func (r *ModRule) validateModRule() error {
 		}
 	}
 
+	// Validate the generate templates.
+	for i, item := range spec.Generate {
+		if item.Template == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("generate").Index(i).Child("template"), "field 'template' cannot be empty"))
+			continue
+		}
+
+		_, err = util.NewSafeTemplate("generate").Parse(item.Template)
+
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("generate").Index(i).Child("template"), item.Template, fmt.Sprintf("%v", err)))
+			continue
+		}
+
+		if generateNamespace != "" {
+			if err := validateGenerateTemplateScope(item.Template, generateNamespace); err != nil {
+				allErrs = append(allErrs, field.Forbidden(field.NewPath("spec").Child("generate").Index(i).Child("template"), err.Error()))
+			}
+		}
+	}
+
 	// Validate the rejectMessage as a template.
-	if r.Spec.RejectMessage != nil {
-		_, err = util.NewSafeTemplate("rejectMessage").Parse(*r.Spec.RejectMessage)
+	if spec.RejectMessage != nil {
+		_, err = util.NewSafeTemplate("rejectMessage").Parse(*spec.RejectMessage)
 
 		if err != nil {
-			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("rejectMessage"), *r.Spec.RejectMessage, fmt.Sprintf("%v", err)))
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("rejectMessage"), *spec.RejectMessage, fmt.Sprintf("%v", err)))
 		}
 	}
 
-	if len(allErrs) > 0 {
-		return apierrors.NewInvalid(
-			schema.GroupKind{Group: "api.kubemod.io", Kind: "ModRule"},
-			r.Name,
-			allErrs)
+	return allErrs
+}
+
+// validateGenerateTemplateScope returns an error if the given generate template renders a cluster-scoped resource,
+// a resource in a namespace other than the given one or a resource which grants permissions or credentials.
+// The validation is static - the kind and namespace of resources which depend on template actions are validated when the resources are generated.
+func validateGenerateTemplateScope(template string, generateNamespace string) error {
+	var manifest struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+		Metadata   struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Type string `json:"type"`
+	}
+
+	// Drop the lines which consist of template actions only (such as conditionals) and replace the rest of the actions with a placeholder.
+	// Templates which are not valid YAML with their actions stripped cannot be validated statically.
+	lines := strings.Split(template, "\n")
+	staticLines := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		if templateActionRegex.MatchString(line) && strings.TrimSpace(templateActionRegex.ReplaceAllString(line, "")) == "" {
+			continue
+		}
+
+		staticLines = append(staticLines, templateActionRegex.ReplaceAllString(line, templateActionPlaceholder))
+	}
+
+	if err := yaml.Unmarshal([]byte(strings.Join(staticLines, "\n")), &manifest); err != nil {
+		return nil
+	}
+
+	isStatic := func(value string) bool {
+		return value != "" && !strings.Contains(value, templateActionPlaceholder)
+	}
+
+	if isStatic(manifest.Metadata.Namespace) && manifest.Metadata.Namespace != generateNamespace {
+		return fmt.Errorf("ModRules can only generate resources in their own namespace %q, not in %q", generateNamespace, manifest.Metadata.Namespace)
+	}
+
+	if isStatic(manifest.APIVersion) && isStatic(manifest.Kind) && IsPrivilegedGeneratedResource(schema.FromAPIVersionAndKind(manifest.APIVersion, manifest.Kind).GroupKind(), manifest.Type) {
+		return fmt.Errorf("ModRules cannot generate %s resources which grant permissions or credentials - use a ClusterModRule instead", manifest.Kind)
+	}
+
+	if webhookRESTMapper != nil && isStatic(manifest.APIVersion) && isStatic(manifest.Kind) {
+		gvk := schema.FromAPIVersionAndKind(manifest.APIVersion, manifest.Kind)
+
+		if mapping, err := webhookRESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil && mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			return fmt.Errorf("ModRules can only generate namespaced resources, %s is cluster-scoped - use a ClusterModRule instead", manifest.Kind)
+		}
 	}
 
 	return nil
 }
+
+// validateMatchItems validates the select queries, regular expressions and matchFor values of the given match items.
+func validateMatchItems(matchPath *field.Path, matchItems []MatchItem) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, matchItem := range matchItems {
+		// match.select is required.
+		if matchItem.Select == "" {
+			allErrs = append(allErrs, field.Invalid(matchPath.Index(i).Child("select"), matchItem.Select, fmt.Sprintf("%s[].select in body must be non-empty string", matchPath)))
+		} else {
+			// Test the match query.
+			_, err := jsonPathLanguage.NewEvaluable(matchItem.Select)
+
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(matchPath.Index(i).Child("select"), matchItem.Select, fmt.Sprintf("%v", err)))
+			}
+		}
+
+		// Then the optional target regexp.
+		if matchItem.MatchRegex != nil {
+			_, err := regexp.Compile(*matchItem.MatchRegex)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(matchPath.Index(i).Child("matchRegex"), *matchItem.MatchRegex, fmt.Sprintf("%v", err)))
+			}
+		}
+
+		if matchItem.MatchFor != MatchForTypeAny && matchItem.MatchFor != MatchForTypeAll {
+			allErrs = append(allErrs, field.Invalid(matchPath.Index(i).Child("matchFor"), matchItem.MatchFor, "unrecognized matchFor value"))
+		}
+	}
+
+	return allErrs
+}
+
+// validatePatchValueSource validates the valueFrom field of a patch operation.
+func validatePatchValueSource(valueFromPath *field.Path, operation PatchOperationType, valueFrom *PatchValueSource) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if operation == Remove || operation == Move || operation == Copy {
+		allErrs = append(allErrs, field.Invalid(valueFromPath, "", fmt.Sprintf("field 'valueFrom' is not allowed for patch operations of type %s", operation)))
+	}
+
+	if (valueFrom.ConfigMapKeyRef == nil) == (valueFrom.SecretKeyRef == nil) {
+		allErrs = append(allErrs, field.Invalid(valueFromPath, "", "exactly one of 'configMapKeyRef' and 'secretKeyRef' must be set"))
+	}
+
+	if valueFrom.ConfigMapKeyRef != nil {
+		if valueFrom.ConfigMapKeyRef.Name == "" {
+			allErrs = append(allErrs, field.Required(valueFromPath.Child("configMapKeyRef").Child("name"), "field 'name' cannot be empty"))
+		}
+
+		if valueFrom.ConfigMapKeyRef.Key == "" {
+			allErrs = append(allErrs, field.Required(valueFromPath.Child("configMapKeyRef").Child("key"), "field 'key' cannot be empty"))
+		}
+	}
+
+	if valueFrom.SecretKeyRef != nil {
+		if valueFrom.SecretKeyRef.Name == "" {
+			allErrs = append(allErrs, field.Required(valueFromPath.Child("secretKeyRef").Child("name"), "field 'name' cannot be empty"))
+		}
+
+		if valueFrom.SecretKeyRef.Key == "" {
+			allErrs = append(allErrs, field.Required(valueFromPath.Child("secretKeyRef").Child("key"), "field 'key' cannot be empty"))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,124 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("validateGenerateTemplateScope", func() {
+	BeforeEach(func() {
+		restMapper := meta.NewDefaultRESTMapper(nil)
+		restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+		restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"}, meta.RESTScopeRoot)
+		webhookRESTMapper = restMapper
+	})
+
+	AfterEach(func() {
+		webhookRESTMapper = nil
+	})
+
+	DescribeTable("should only allow namespaced resources in the namespace of the ModRule", func(template string, allowed bool) {
+		err := validateGenerateTemplateScope(template, "my-namespace")
+
+		if allowed {
+			Expect(err).NotTo(HaveOccurred())
+		} else {
+			Expect(err).To(HaveOccurred())
+		}
+	},
+		Entry("resources with no namespace are allowed",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n", true),
+		Entry("resources in the namespace of the ModRule are allowed",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: my-namespace\n", true),
+		Entry("resources in other namespaces are forbidden",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: kube-system\n", false),
+		Entry("cluster-scoped resources are forbidden",
+			"apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: a\n", false),
+		Entry("RBAC resources are forbidden",
+			"apiVersion: rbac.authorization.k8s.io/v1\nkind: RoleBinding\nmetadata:\n  name: a\n", false),
+		Entry("service account token secrets are forbidden",
+			"apiVersion: v1\nkind: Secret\nmetadata:\n  name: a\ntype: kubernetes.io/service-account-token\n", false),
+		Entry("other secrets are allowed",
+			"apiVersion: v1\nkind: Secret\nmetadata:\n  name: a\ntype: Opaque\n", true),
+		Entry("templated namespaces are validated at generate time",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: {{ .Target.metadata.name }}\n", true),
+		Entry("templated namespaces mixed with static text are validated at generate time",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: prefix-{{ .Target.metadata.name }}\n", true),
+		Entry("conditional lines are ignored",
+			"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n{{ if .Target }}\n  namespace: kube-system\n{{ end }}\n", false),
+	)
+
+	It("should reject namespaced ModRules which generate resources outside of their namespace", func() {
+		modRule := &ModRule{Spec: ModRuleSpec{
+			Type:     ModRuleTypeGenerate,
+			Match:    []MatchItem{{Select: "$.kind"}},
+			Generate: []GenerateItem{{Template: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: a\n"}},
+		}}
+		modRule.Namespace = "my-namespace"
+		modRule.Default()
+
+		Expect(modRule.ValidateCreate()).NotTo(Succeed())
+
+		clusterModRule := &ClusterModRule{Spec: modRule.Spec}
+		Expect(clusterModRule.ValidateCreate()).To(Succeed())
+	})
+
+	It("should allow ModRules in the cluster-wide namespace to generate resources anywhere", func() {
+		webhookClusterModRulesNamespace = "kubemod-system"
+		defer func() { webhookClusterModRulesNamespace = "" }()
+
+		modRule := &ModRule{Spec: ModRuleSpec{
+			Type:     ModRuleTypeGenerate,
+			Match:    []MatchItem{{Select: "$.kind"}},
+			Generate: []GenerateItem{{Template: "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRoleBinding\nmetadata:\n  name: a\n"}},
+		}}
+		modRule.Namespace = "kubemod-system"
+		modRule.Default()
+
+		Expect(modRule.ValidateCreate()).To(Succeed())
+	})
+})
+
+var _ = Describe("validateModRule", func() {
+	It("should only allow ClusterModRules to source patch values from Secrets", func() {
+		modRule := &ModRule{Spec: ModRuleSpec{
+			Type:  ModRuleTypePatch,
+			Match: []MatchItem{{Select: "$.kind"}},
+			Patch: []PatchOperation{{
+				Operation: Add,
+				Path:      "/metadata/labels/a",
+				ValueFrom: &PatchValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "my-secret"},
+					Key:                  "a",
+				}},
+			}},
+		}}
+		modRule.Namespace = "my-namespace"
+		modRule.Default()
+
+		err := modRule.ValidateCreate()
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("only ClusterModRules may source patch values from Secrets"))
+
+		clusterModRule := &ClusterModRule{Spec: modRule.Spec}
+		Expect(clusterModRule.ValidateCreate()).To(Succeed())
+	})
+})
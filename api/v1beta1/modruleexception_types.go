@@ -0,0 +1,98 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ModRuleExceptionSpec defines the desired state of ModRuleException
+type ModRuleExceptionSpec struct {
+	// ModRules is a list of references to the ModRules waived by the exception.
+	// +kubebuilder:validation:MinItems=1
+	ModRules []ModRuleReference `json:"modRules"`
+
+	// Match is an optional list of match items which consist of select queries and expected match values or regular expressions.
+	// When all match items for an object are positive, the referenced ModRules are not applied to the object.
+	// When omitted, the exception applies to all objects in its scope.
+	// +optional
+	Match []MatchItem `json:"match,omitempty"`
+
+	// ExpiresAt is the time the exception lapses.
+	// Once expired, the exception is no longer in effect and KubeMod deletes it.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// ModRuleReference identifies a ModRule or a ClusterModRule.
+type ModRuleReference struct {
+	// Namespace is the namespace of the referenced ModRule.
+	// An empty namespace references a ClusterModRule.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name is the name of the referenced ModRule.
+	Name string `json:"name"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Expires At",type=string,format=date-time,JSONPath=`.spec.expiresAt`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ModRuleException is the Schema for the modruleexceptions API.
+// ModRuleExceptions are time-boxed waivers of ModRules for the resources deployed to the namespace of the exception.
+// ModRuleExceptions deployed to the cluster-wide namespace waive ModRules for resources in all namespaces and for cluster-wide resources.
+type ModRuleException struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ModRuleExceptionSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ModRuleExceptionList contains a list of ModRuleException
+type ModRuleExceptionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ModRuleException `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ModRuleException{}, &ModRuleExceptionList{})
+}
+
+// IsExpired returns true if the exception has expired at the given time.
+func (m *ModRuleException) IsExpired(now time.Time) bool {
+	return !now.Before(m.Spec.ExpiresAt.Time)
+}
+
+// Waives returns true if the exception references the ModRule with the given namespace and name.
+func (m *ModRuleException) Waives(modRuleNamespace string, modRuleName string) bool {
+	for _, ref := range m.Spec.ModRules {
+		if ref.Namespace == modRuleNamespace && ref.Name == modRuleName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetNamespacedName returns the namespace/name of the exception.
+func (m *ModRuleException) GetNamespacedName() string {
+	return fmt.Sprintf("%s/%s", m.Namespace, m.Name)
+}
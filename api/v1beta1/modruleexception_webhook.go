@@ -0,0 +1,96 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var modruleexceptionlog = logf.Log.WithName("modruleexception-resource")
+
+// SetupWebhookWithManager hooks up the web hook with a manager.
+func (r *ModRuleException) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+var _ webhook.Defaulter = &ModRuleException{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ModRuleException) Default() {
+	modruleexceptionlog.V(1).Info("default", "name", r.Name)
+
+	defaultMatchItems(r.Spec.Match)
+}
+
+var _ webhook.Validator = &ModRuleException{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ModRuleException) ValidateCreate() error {
+	modruleexceptionlog.V(1).Info("validate create", "name", r.Name)
+
+	return r.validateModRuleException()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ModRuleException) ValidateUpdate(old runtime.Object) error {
+	modruleexceptionlog.V(1).Info("validate update", "name", r.Name)
+
+	return r.validateModRuleException()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ModRuleException) ValidateDelete() error {
+	modruleexceptionlog.V(1).Info("validate delete", "name", r.Name)
+
+	return nil
+}
+
+func (r *ModRuleException) validateModRuleException() error {
+	var allErrs field.ErrorList
+
+	if len(r.Spec.ModRules) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("modRules"), "field 'modRules' cannot be empty"))
+	}
+
+	for i, ref := range r.Spec.ModRules {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("modRules").Index(i).Child("name"), "spec.modRules[].name in body must be non-empty string"))
+		}
+	}
+
+	if r.Spec.ExpiresAt.IsZero() {
+		allErrs = append(allErrs, field.Required(field.NewPath("spec").Child("expiresAt"), "field 'expiresAt' is required"))
+	}
+
+	allErrs = append(allErrs, validateMatchItems(field.NewPath("spec").Child("match"), r.Spec.Match)...)
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: "api.kubemod.io", Kind: "ModRuleException"},
+			r.Name,
+			allErrs)
+	}
+
+	return nil
+}
@@ -20,9 +20,108 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackgroundApplyStatus) DeepCopyInto(out *BackgroundApplyStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackgroundApplyStatus.
+func (in *BackgroundApplyStatus) DeepCopy() *BackgroundApplyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BackgroundApplyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterModRule) DeepCopyInto(out *ClusterModRule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterModRule.
+func (in *ClusterModRule) DeepCopy() *ClusterModRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterModRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterModRule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterModRuleList) DeepCopyInto(out *ClusterModRuleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterModRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterModRuleList.
+func (in *ClusterModRuleList) DeepCopy() *ClusterModRuleList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterModRuleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterModRuleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenerateItem) DeepCopyInto(out *GenerateItem) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenerateItem.
+func (in *GenerateItem) DeepCopy() *GenerateItem {
+	if in == nil {
+		return nil
+	}
+	out := new(GenerateItem)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MatchItem) DeepCopyInto(out *MatchItem) {
 	*out = *in
@@ -59,7 +158,7 @@ func (in *ModRule) DeepCopyInto(out *ModRule) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRule.
@@ -80,6 +179,145 @@ func (in *ModRule) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleCondition) DeepCopyInto(out *ModRuleCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleCondition.
+func (in *ModRuleCondition) DeepCopy() *ModRuleCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleException) DeepCopyInto(out *ModRuleException) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleException.
+func (in *ModRuleException) DeepCopy() *ModRuleException {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleException)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModRuleException) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleExceptionList) DeepCopyInto(out *ModRuleExceptionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ModRuleException, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleExceptionList.
+func (in *ModRuleExceptionList) DeepCopy() *ModRuleExceptionList {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleExceptionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ModRuleExceptionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleExceptionSpec) DeepCopyInto(out *ModRuleExceptionSpec) {
+	*out = *in
+	if in.ModRules != nil {
+		in, out := &in.ModRules, &out.ModRules
+		*out = make([]ModRuleReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Match != nil {
+		in, out := &in.Match, &out.Match
+		*out = make([]MatchItem, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.ExpiresAt.DeepCopyInto(&out.ExpiresAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleExceptionSpec.
+func (in *ModRuleExceptionSpec) DeepCopy() *ModRuleExceptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleExceptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleExclude) DeepCopyInto(out *ModRuleExclude) {
+	*out = *in
+	if in.Match != nil {
+		in, out := &in.Match, &out.Match
+		*out = make([]MatchItem, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleExclude.
+func (in *ModRuleExclude) DeepCopy() *ModRuleExclude {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleExclude)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModRuleList) DeepCopyInto(out *ModRuleList) {
 	*out = *in
@@ -112,6 +350,21 @@ func (in *ModRuleList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleReference) DeepCopyInto(out *ModRuleReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleReference.
+func (in *ModRuleReference) DeepCopy() *ModRuleReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModRuleSpec) DeepCopyInto(out *ModRuleSpec) {
 	*out = *in
@@ -127,6 +380,11 @@ func (in *ModRuleSpec) DeepCopyInto(out *ModRuleSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = new(ModRuleExclude)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Patch != nil {
 		in, out := &in.Patch, &out.Patch
 		*out = make([]PatchOperation, len(*in))
@@ -134,6 +392,11 @@ func (in *ModRuleSpec) DeepCopyInto(out *ModRuleSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Generate != nil {
+		in, out := &in.Generate, &out.Generate
+		*out = make([]GenerateItem, len(*in))
+		copy(*out, *in)
+	}
 	if in.RejectMessage != nil {
 		in, out := &in.RejectMessage, &out.RejectMessage
 		*out = new(string)
@@ -144,6 +407,21 @@ func (in *ModRuleSpec) DeepCopyInto(out *ModRuleSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.TargetNamespaceSelector != nil {
+		in, out := &in.TargetNamespaceSelector, &out.TargetNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludeNamespaceSelector != nil {
+		in, out := &in.ExcludeNamespaceSelector, &out.ExcludeNamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]ModRuleTarget, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleSpec.
@@ -156,9 +434,41 @@ func (in *ModRuleSpec) DeepCopy() *ModRuleSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleStats) DeepCopyInto(out *ModRuleStats) {
+	*out = *in
+	if in.LastMatchTime != nil {
+		in, out := &in.LastMatchTime, &out.LastMatchTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleStats.
+func (in *ModRuleStats) DeepCopy() *ModRuleStats {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ModRuleStatus) DeepCopyInto(out *ModRuleStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ModRuleCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Stats.DeepCopyInto(&out.Stats)
+	if in.BackgroundApply != nil {
+		in, out := &in.BackgroundApply, &out.BackgroundApply
+		*out = new(BackgroundApplyStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleStatus.
@@ -171,6 +481,21 @@ func (in *ModRuleStatus) DeepCopy() *ModRuleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ModRuleTarget) DeepCopyInto(out *ModRuleTarget) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ModRuleTarget.
+func (in *ModRuleTarget) DeepCopy() *ModRuleTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(ModRuleTarget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PatchOperation) DeepCopyInto(out *PatchOperation) {
 	*out = *in
@@ -179,11 +504,21 @@ func (in *PatchOperation) DeepCopyInto(out *PatchOperation) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = new(string)
+		**out = **in
+	}
 	if in.Value != nil {
 		in, out := &in.Value, &out.Value
 		*out = new(string)
 		**out = **in
 	}
+	if in.ValueFrom != nil {
+		in, out := &in.ValueFrom, &out.ValueFrom
+		*out = new(PatchValueSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchOperation.
@@ -195,3 +530,28 @@ func (in *PatchOperation) DeepCopy() *PatchOperation {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PatchValueSource) DeepCopyInto(out *PatchValueSource) {
+	*out = *in
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(corev1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(corev1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PatchValueSource.
+func (in *PatchValueSource) DeepCopy() *PatchValueSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PatchValueSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,157 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// IdempotencyCheckModRulesFile is the path to a YAML file with the ModRules checked by the idempotency check.
+type IdempotencyCheckModRulesFile string
+
+// IdempotencyCheckResourceFile is the path to a YAML or JSON file with the resource manifest used by the idempotency check.
+type IdempotencyCheckResourceFile string
+
+// KubeModIdempotencyCheckApp is the DI container of the command-line idempotency check of Patch ModRules.
+type KubeModIdempotencyCheckApp struct {
+	// Result is the outcome of the idempotency check.
+	Result *core.IdempotencyResult
+}
+
+// NewKubeModIdempotencyCheckApp runs the Patch ModRules in the given ModRules file twice against the given resource
+// and prints the patch produced by the second pass to the standard output.
+// An error is returned if the second pass produced a non-empty patch.
+func NewKubeModIdempotencyCheckApp(
+	modRulesFile IdempotencyCheckModRulesFile,
+	resourceFile IdempotencyCheckResourceFile,
+	clusterModRulesNamespace core.ClusterModRulesNamespace,
+	log logr.Logger,
+	modRuleStoreItemFactory *core.ModRuleStoreItemFactory,
+) (*KubeModIdempotencyCheckApp, error) {
+	log = log.WithName("idempotency-check")
+
+	// The ModRules are tried as if they all were created in the same namespace - the same way the web app does it.
+	store := core.NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, core.NewNamespaceLabelCache(), log)
+
+	modRules, err := loadModRules(string(modRulesFile))
+
+	if err != nil {
+		log.Error(err, "unable to load ModRules", "file", modRulesFile)
+		return nil, err
+	}
+
+	for _, modRule := range modRules {
+		modRule.Default()
+		modRule.Namespace = dryRunNamespace
+
+		if err = modRule.ValidateCreate(); err != nil {
+			log.Error(err, "invalid ModRule", "name", modRule.Name)
+			return nil, err
+		}
+
+		if err = store.Put(modRule); err != nil {
+			log.Error(err, "unable to load ModRule", "name", modRule.Name)
+			return nil, err
+		}
+	}
+
+	resourceYAML, err := ioutil.ReadFile(string(resourceFile))
+
+	if err != nil {
+		log.Error(err, "unable to read resource manifest", "file", resourceFile)
+		return nil, err
+	}
+
+	resourceJSON, err := yaml.YAMLToJSON(resourceYAML)
+
+	if err != nil {
+		log.Error(err, "unable to parse resource manifest", "file", resourceFile)
+		return nil, err
+	}
+
+	// The resource is patched as if it was created, then patched again as if Kubernetes passed it back through KubeMod on its next update.
+	patched, _, err := store.CalculatePatch("CREATE", dryRunNamespace, resourceJSON, nil, log)
+
+	if err != nil {
+		log.Error(err, "unable to calculate patch")
+		return nil, err
+	}
+
+	result, err := store.CheckIdempotency("UPDATE", dryRunNamespace, patched, log)
+
+	if err != nil {
+		log.Error(err, "unable to check patch idempotency")
+		return nil, err
+	}
+
+	resultYAML, err := yaml.Marshal(result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprint(os.Stdout, string(resultYAML))
+
+	if !result.IsIdempotent() {
+		err = fmt.Errorf("the patch of the following ModRule(s) is not idempotent: %v", result.ModRules)
+		log.Error(err, "idempotency check failed")
+		return nil, err
+	}
+
+	return &KubeModIdempotencyCheckApp{Result: result}, nil
+}
+
+// loadModRules reads the ModRules from the given multi-document YAML file.
+func loadModRules(modRulesFile string) ([]*v1beta1.ModRule, error) {
+	modRulesYAML, err := ioutil.ReadFile(modRulesFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	modRules := []*v1beta1.ModRule{}
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(modRulesYAML), 4096)
+
+	for {
+		modRule := &v1beta1.ModRule{}
+
+		if err = decoder.Decode(modRule); err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		// Skip empty documents.
+		if modRule.Name == "" && modRule.Spec.Type == "" {
+			continue
+		}
+
+		modRules = append(modRules, modRule)
+	}
+
+	return modRules, nil
+}
@@ -23,6 +23,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
@@ -35,8 +36,19 @@ func NewKubeModOperatorApp(
 	scheme *runtime.Scheme,
 	manager manager.Manager,
 	modRuleReconciler *controllers.ModRuleReconciler,
+	clusterModRuleReconciler *controllers.ClusterModRuleReconciler,
+	namespaceReconciler *controllers.NamespaceReconciler,
+	modRuleExceptionReconciler *controllers.ModRuleExceptionReconciler,
+	modRuleStatsFlusher *controllers.ModRuleStatsFlusher,
+	modRuleSyncTracker *controllers.ModRuleSyncTracker,
+	valueSourceResolver *core.KubernetesValueSourceResolver,
+	backgroundApplier *controllers.BackgroundApplier,
+	auditor *controllers.Auditor,
+	resourceGenerator *core.ResourceGenerator,
 	coreDragnetWebhookHandler *core.DragnetWebhookHandler,
 	corePodBindingWebhookHandler *core.PodBindingWebhookHandler,
+	corePatchConflictWebhookHandler *core.PatchConflictWebhookHandler,
+	clusterModRulesNamespace core.ClusterModRulesNamespace,
 	log logr.Logger,
 ) (*KubeModOperatorApp, error) {
 
@@ -50,21 +62,110 @@ func NewKubeModOperatorApp(
 		return nil, err
 	}
 
+	// Set up the ClusterModRuleReconciler with the manager.
+	if err := clusterModRuleReconciler.SetupWithManager(manager); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterModRule")
+		return nil, err
+	}
+
+	// Set up the NamespaceReconciler with the manager.
+	if err := namespaceReconciler.SetupWithManager(manager); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Namespace")
+		return nil, err
+	}
+
+	// Cache the labels of the initial Namespaces and hold off admission requests until then - otherwise the namespace selectors
+	// of ModRules would be evaluated against missing labels.
+	if err := manager.Add(namespaceReconciler); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "NamespaceReconciler")
+		return nil, err
+	}
+
+	if err := manager.AddReadyzCheck("namespaces", namespaceReconciler.Check); err != nil {
+		setupLog.Error(err, "unable to create ready check")
+		return nil, err
+	}
+
+	// Set up the ModRuleExceptionReconciler with the manager.
+	if err := modRuleExceptionReconciler.SetupWithManager(manager); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ModRuleException")
+		return nil, err
+	}
+
+	// Set up the periodic flushing of ModRule statistics.
+	if err := manager.Add(modRuleStatsFlusher); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "ModRuleStatsFlusher")
+		return nil, err
+	}
+
+	// Set up the tracking of the initial loading of ModRules into the ModRule store.
+	if err := manager.Add(modRuleSyncTracker); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "ModRuleSyncTracker")
+		return nil, err
+	}
+
+	// Hold off admission requests until the initial ModRules have been loaded - otherwise resources would slip through unpatched.
+	if err := manager.AddReadyzCheck("modrules", modRuleSyncTracker.Check); err != nil {
+		setupLog.Error(err, "unable to create ready check")
+		return nil, err
+	}
+
+	// Keep the ModRules which failed to compile visible once the replica is ready, without holding off admission requests.
+	if err := metrics.Registry.Register(modRuleSyncTracker); err != nil {
+		setupLog.Error(err, "unable to register metrics", "collector", "ModRuleSyncTracker")
+		return nil, err
+	}
+
+	// Set up the watches of the ConfigMaps and Secrets referenced by the valueFrom of patch operations.
+	if err := manager.Add(valueSourceResolver); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "KubernetesValueSourceResolver")
+		return nil, err
+	}
+
+	// Set up the background application of ModRules to existing resources.
+	if err := manager.Add(backgroundApplier); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "BackgroundApplier")
+		return nil, err
+	}
+
+	// Set up the periodic audit of existing resources against Reject ModRules.
+	if err := manager.Add(auditor); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "Auditor")
+		return nil, err
+	}
+
+	// Set up the asynchronous generation of the companion resources of Generate ModRules.
+	if err := manager.Add(resourceGenerator); err != nil {
+		setupLog.Error(err, "unable to add runnable", "runnable", "ResourceGenerator")
+		return nil, err
+	}
+
 	// Wire up the ModRule web hooks.
-	if err := (&apiv1beta1.ModRule{}).SetupWebhookWithManager(manager); err != nil {
+	if err := (&apiv1beta1.ModRule{}).SetupWebhookWithManager(manager, string(clusterModRulesNamespace)); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "ModRule")
 		return nil, err
 	}
 
+	// Wire up the ClusterModRule web hooks.
+	if err := (&apiv1beta1.ClusterModRule{}).SetupWebhookWithManager(manager); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterModRule")
+		return nil, err
+	}
+
+	// Wire up the ModRuleException web hooks.
+	if err := (&apiv1beta1.ModRuleException{}).SetupWebhookWithManager(manager); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ModRuleException")
+		return nil, err
+	}
+
 	// Wire up the core web hook.
 	hookServer := manager.GetWebhookServer()
 	setupLog.Info("registering core mutating webhook")
 
+	// The dragnet webhook is served by a warning-capable webhook in order to support Warn ModRules.
 	hookServer.Register(
 		"/dragnet-webhook",
-		&webhook.Admission{
-			Handler: coreDragnetWebhookHandler,
-		},
+		core.NewWarningAdmissionWebhook(coreDragnetWebhookHandler, log),
 	)
 
 	hookServer.Register(
@@ -74,6 +175,12 @@ func NewKubeModOperatorApp(
 		},
 	)
 
+	// The patch conflict webhook reports the conflicts of ModRules as warnings, hence it is served by a warning-capable webhook too.
+	hookServer.Register(
+		"/patchconflict-webhook",
+		core.NewWarningAdmissionWebhook(corePatchConflictWebhookHandler, log),
+	)
+
 	// Start the manager.
 	setupLog.Info("starting manager")
 	if err := manager.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -110,11 +217,5 @@ func NewControllerManager(scheme *runtime.Scheme, metricsAddr OperatorMetricsAdd
 		return nil, err
 	}
 
-	// Add /readyz health-check endpoint
-	if err := mgr.AddReadyzCheck("tracker", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to create ready check")
-		return nil, err
-	}
-
 	return mgr, nil
 }
@@ -20,9 +20,17 @@ type DryRunRequest struct {
 
 // DryRunResponse represents the resonse of a successful /v1/dryrun
 type DryRunResponse struct {
-	Patch      interface{} `json:"patch"`
-	Diff       string      `json:"diff"`
-	Rejections []string    `json:"rejections"`
+	Patch         interface{}             `json:"patch"`
+	Diff          string                  `json:"diff"`
+	Rejections    []string                `json:"rejections"`
+	Warnings      []string                `json:"warnings"`
+	DryRunResults []core.DryRunResult     `json:"dryRunResults"`
+	Exclusions    []core.ExclusionResult  `json:"exclusions"`
+	Failures      []core.FailureResult    `json:"failures"`
+	Conflicts     []core.PatchConflict    `json:"conflicts"`
+	Generated     []interface{}           `json:"generated"`
+	Idempotency   *core.IdempotencyResult `json:"idempotency"`
+	Trace         *core.EvaluationTrace   `json:"trace"`
 }
 
 const (
@@ -50,7 +58,7 @@ func (app *KubeModWebApp) dryRunHandler(c *gin.Context) {
 	app.log.V(1).Info("processing request", "route", c.Request.URL, "payload", payload)
 
 	// Instantiate a ModRuleStore for this request and populate it with the modrules.
-	store := core.NewModRuleStore(app.modRuleStoreItemFactory, app.clusterModRulesNamespace, app.log)
+	store := core.NewModRuleStore(app.modRuleStoreItemFactory, app.clusterModRulesNamespace, core.NewNamespaceLabelCache(), app.log)
 
 	for _, modRule := range payload.ModRules {
 		// Populate the modrule with its default values if missing.
@@ -79,8 +87,11 @@ func (app *KubeModWebApp) dryRunHandler(c *gin.Context) {
 		return
 	}
 
+	// The report collects the outcomes of ModRules with enforcementAction dryrun and traces the evaluation of all ModRules.
+	report := &core.OperationReport{Trace: &core.EvaluationTrace{}}
+
 	// First run the patch operations.
-	patched, patch, err := store.CalculatePatch(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, originalJSON, app.log)
+	patched, patch, err := store.CalculatePatch(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, originalJSON, report, app.log)
 
 	if err != nil {
 		app.reportBadRequest(c, err)
@@ -88,7 +99,26 @@ func (app *KubeModWebApp) dryRunHandler(c *gin.Context) {
 	}
 
 	// Try rejections against the after-patch manifest.
-	rejections := store.DetermineRejections(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, patched, app.log)
+	rejections := store.DetermineRejections(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, patched, report, app.log)
+
+	// Collect the warnings of Warn rules against the after-patch manifest.
+	warnings := store.DetermineWarnings(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, patched, report, app.log)
+
+	// Render the companion resources of Generate rules against the after-patch manifest.
+	generatedResources := store.CalculateGeneratedResources(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, patched, report, app.log)
+	generated := make([]interface{}, len(generatedResources))
+
+	for i, resource := range generatedResources {
+		generated[i] = resource.Object.Object
+	}
+
+	// Re-run the Patch rules against the patched manifest to find out if they would keep changing it.
+	idempotency, err := store.CheckIdempotency(v1beta1.ModRuleAdmissionOperation(dryRunOperation), dryRunNamespace, patched, app.log)
+
+	if err != nil {
+		app.reportBadRequest(c, err)
+		return
+	}
 
 	// If there is a valid patch, calculate the diff in unified diff format.
 	var diff string
@@ -119,9 +149,17 @@ func (app *KubeModWebApp) dryRunHandler(c *gin.Context) {
 	}
 
 	response := DryRunResponse{
-		Patch:      patch,
-		Diff:       diff,
-		Rejections: rejections,
+		Patch:         patch,
+		Diff:          diff,
+		Rejections:    rejections,
+		Warnings:      warnings,
+		DryRunResults: report.DryRunResults,
+		Exclusions:    report.Exclusions,
+		Failures:      report.Failures,
+		Conflicts:     report.Conflicts,
+		Generated:     generated,
+		Idempotency:   idempotency,
+		Trace:         report.Trace,
 	}
 
 	c.JSON(http.StatusOK, response)
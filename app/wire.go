@@ -37,14 +37,31 @@ func InitializeKubeModOperatorApp(
 	healthProbeAddr OperatorHealthProbeAddr,
 	clusterModRulesNamespace core.ClusterModRulesNamespace,
 	enableLeaderElection EnableLeaderElection,
+	statsFlushInterval controllers.ModRuleStatsFlushInterval,
+	backgroundApplyQPS controllers.BackgroundApplyQPS,
+	auditInterval controllers.AuditInterval,
+	warnNonIdempotentPatches core.WarnNonIdempotentPatches,
 	log logr.Logger) (*KubeModOperatorApp, error) {
 	wire.Build(
 		expressions.NewKubeModJSONPathLanguage,
+		core.NewKubernetesValueSourceResolver,
+		wire.Bind(new(core.ValueSourceResolver), new(*core.KubernetesValueSourceResolver)),
 		core.NewModRuleStoreItemFactory,
+		core.NewClusterNamespaceLabelCache,
 		core.NewModRuleStore,
+		core.NewResourceGenerator,
 		core.NewDragnetWebhookHandler,
 		core.NewPodBindingWebhookHandler,
+		core.NewPatchConflictWebhookHandler,
+		controllers.NewBackgroundApplier,
+		controllers.NewModRuleSyncTracker,
+		controllers.NewPatchConflictNotifier,
 		controllers.NewModRuleReconciler,
+		controllers.NewClusterModRuleReconciler,
+		controllers.NewNamespaceReconciler,
+		controllers.NewModRuleExceptionReconciler,
+		controllers.NewModRuleStatsFlusher,
+		controllers.NewAuditor,
 		NewControllerManager,
 		NewKubeModOperatorApp,
 	)
@@ -58,8 +75,25 @@ func InitializeKubeModWebApp(
 	log logr.Logger) (*KubeModWebApp, error) {
 	wire.Build(
 		expressions.NewKubeModJSONPathLanguage,
+		core.NewUnavailableValueSourceResolver,
+		wire.Bind(new(core.ValueSourceResolver), new(*core.UnavailableValueSourceResolver)),
 		core.NewModRuleStoreItemFactory,
 		NewKubeModWebApp,
 	)
 	return nil, nil
 }
+
+func InitializeKubeModIdempotencyCheckApp(
+	modRulesFile IdempotencyCheckModRulesFile,
+	resourceFile IdempotencyCheckResourceFile,
+	clusterModRulesNamespace core.ClusterModRulesNamespace,
+	log logr.Logger) (*KubeModIdempotencyCheckApp, error) {
+	wire.Build(
+		expressions.NewKubeModJSONPathLanguage,
+		core.NewUnavailableValueSourceResolver,
+		wire.Bind(new(core.ValueSourceResolver), new(*core.UnavailableValueSourceResolver)),
+		core.NewModRuleStoreItemFactory,
+		NewKubeModIdempotencyCheckApp,
+	)
+	return nil, nil
+}
@@ -16,21 +16,45 @@ import (
 
 // Injectors from wire.go:
 
-func InitializeKubeModOperatorApp(scheme *runtime.Scheme, metricsAddr OperatorMetricsAddr, healthProbeAddr OperatorHealthProbeAddr, clusterModRulesNamespace core.ClusterModRulesNamespace, enableLeaderElection EnableLeaderElection, log logr.Logger) (*KubeModOperatorApp, error) {
+func InitializeKubeModOperatorApp(scheme *runtime.Scheme, metricsAddr OperatorMetricsAddr, healthProbeAddr OperatorHealthProbeAddr, clusterModRulesNamespace core.ClusterModRulesNamespace, enableLeaderElection EnableLeaderElection, statsFlushInterval controllers.ModRuleStatsFlushInterval, backgroundApplyQPS controllers.BackgroundApplyQPS, auditInterval controllers.AuditInterval, warnNonIdempotentPatches core.WarnNonIdempotentPatches, log logr.Logger) (*KubeModOperatorApp, error) {
 	manager, err := NewControllerManager(scheme, metricsAddr, healthProbeAddr, enableLeaderElection, log)
 	if err != nil {
 		return nil, err
 	}
 	language := expressions.NewKubeModJSONPathLanguage()
-	modRuleStoreItemFactory := core.NewModRuleStoreItemFactory(language, log)
-	modRuleStore := core.NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, log)
-	modRuleReconciler, err := controllers.NewModRuleReconciler(manager, modRuleStore, log)
+	kubernetesValueSourceResolver, err := core.NewKubernetesValueSourceResolver(manager, clusterModRulesNamespace, log)
 	if err != nil {
 		return nil, err
 	}
-	dragnetWebhookHandler := core.NewDragnetWebhookHandler(manager, modRuleStore, log)
+	modRuleStoreItemFactory := core.NewModRuleStoreItemFactory(language, kubernetesValueSourceResolver, log)
+	namespaceLabelCache := core.NewClusterNamespaceLabelCache(manager, log)
+	modRuleStore := core.NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, namespaceLabelCache, log)
+	backgroundApplier := controllers.NewBackgroundApplier(manager, modRuleStore, clusterModRulesNamespace, backgroundApplyQPS, log)
+	modRuleSyncTracker := controllers.NewModRuleSyncTracker(manager, log)
+	patchConflictNotifier := controllers.NewPatchConflictNotifier()
+	modRuleReconciler, err := controllers.NewModRuleReconciler(manager, modRuleStore, backgroundApplier, modRuleSyncTracker, kubernetesValueSourceResolver, patchConflictNotifier, log)
+	if err != nil {
+		return nil, err
+	}
+	clusterModRuleReconciler, err := controllers.NewClusterModRuleReconciler(manager, modRuleStore, backgroundApplier, clusterModRulesNamespace, modRuleSyncTracker, kubernetesValueSourceResolver, patchConflictNotifier, log)
+	if err != nil {
+		return nil, err
+	}
+	namespaceReconciler, err := controllers.NewNamespaceReconciler(manager, namespaceLabelCache, log)
+	if err != nil {
+		return nil, err
+	}
+	modRuleExceptionReconciler, err := controllers.NewModRuleExceptionReconciler(manager, modRuleStore, log)
+	if err != nil {
+		return nil, err
+	}
+	modRuleStatsFlusher := controllers.NewModRuleStatsFlusher(manager, modRuleStore, statsFlushInterval, log)
+	auditor := controllers.NewAuditor(manager, modRuleStore, clusterModRulesNamespace, auditInterval, log)
+	resourceGenerator := core.NewResourceGenerator(manager, log)
+	dragnetWebhookHandler := core.NewDragnetWebhookHandler(manager, modRuleStore, resourceGenerator, warnNonIdempotentPatches, log)
 	podBindingWebhookHandler := core.NewPodBindingWebhookHandler(manager, log)
-	kubeModOperatorApp, err := NewKubeModOperatorApp(scheme, manager, modRuleReconciler, dragnetWebhookHandler, podBindingWebhookHandler, log)
+	patchConflictWebhookHandler := core.NewPatchConflictWebhookHandler(modRuleStore, log)
+	kubeModOperatorApp, err := NewKubeModOperatorApp(scheme, manager, modRuleReconciler, clusterModRuleReconciler, namespaceReconciler, modRuleExceptionReconciler, modRuleStatsFlusher, modRuleSyncTracker, kubernetesValueSourceResolver, backgroundApplier, auditor, resourceGenerator, dragnetWebhookHandler, podBindingWebhookHandler, patchConflictWebhookHandler, clusterModRulesNamespace, log)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +63,8 @@ func InitializeKubeModOperatorApp(scheme *runtime.Scheme, metricsAddr OperatorMe
 
 func InitializeKubeModWebApp(webAppAddr string, enableDevModeLog EnableDevModeLog, clusterModRulesNamespace core.ClusterModRulesNamespace, log logr.Logger) (*KubeModWebApp, error) {
 	language := expressions.NewKubeModJSONPathLanguage()
-	modRuleStoreItemFactory := core.NewModRuleStoreItemFactory(language, log)
+	unavailableValueSourceResolver := core.NewUnavailableValueSourceResolver()
+	modRuleStoreItemFactory := core.NewModRuleStoreItemFactory(language, unavailableValueSourceResolver, log)
 	kubeModWebApp, err := NewKubeModWebApp(webAppAddr, enableDevModeLog, clusterModRulesNamespace, log, modRuleStoreItemFactory)
 	if err != nil {
 		return nil, err
@@ -47,6 +72,17 @@ func InitializeKubeModWebApp(webAppAddr string, enableDevModeLog EnableDevModeLo
 	return kubeModWebApp, nil
 }
 
+func InitializeKubeModIdempotencyCheckApp(modRulesFile IdempotencyCheckModRulesFile, resourceFile IdempotencyCheckResourceFile, clusterModRulesNamespace core.ClusterModRulesNamespace, log logr.Logger) (*KubeModIdempotencyCheckApp, error) {
+	language := expressions.NewKubeModJSONPathLanguage()
+	unavailableValueSourceResolver := core.NewUnavailableValueSourceResolver()
+	modRuleStoreItemFactory := core.NewModRuleStoreItemFactory(language, unavailableValueSourceResolver, log)
+	kubeModIdempotencyCheckApp, err := NewKubeModIdempotencyCheckApp(modRulesFile, resourceFile, clusterModRulesNamespace, log, modRuleStoreItemFactory)
+	if err != nil {
+		return nil, err
+	}
+	return kubeModIdempotencyCheckApp, nil
+}
+
 // wire.go:
 
 type EnableLeaderElection bool
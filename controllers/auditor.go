@@ -0,0 +1,432 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// AuditInterval is a type used by DI to inject the interval at which existing resources are audited against Reject ModRules.
+type AuditInterval time.Duration
+
+const (
+	// auditPageSize is the number of existing resources retrieved by a single list request.
+	auditPageSize = 100
+
+	// auditReportName is the name of the PolicyReport and ClusterPolicyReport objects published by the audit.
+	auditReportName = "kubemod-audit"
+
+	// auditReportSource is the source of the results published by the audit.
+	auditReportSource = "kubemod"
+)
+
+var (
+	policyReportGVK        = schema.GroupVersionKind{Group: "wgpolicyk8s.io", Version: "v1alpha2", Kind: "PolicyReport"}
+	clusterPolicyReportGVK = schema.GroupVersionKind{Group: "wgpolicyk8s.io", Version: "v1alpha2", Kind: "ClusterPolicyReport"}
+
+	// auditReportLabels identify the policy reports published by KubeMod.
+	auditReportLabels = map[string]string{"app.kubernetes.io/managed-by": "kubemod"}
+)
+
+// Auditor periodically evaluates the existing resources targeted by Reject ModRules and reports
+// the resources which would be rejected if they were admitted today.
+// The results are published as wgpolicyk8s.io PolicyReport objects in the namespace of each violating resource
+// and as a ClusterPolicyReport for cluster-scoped resources.
+type Auditor struct {
+	client                   client.Client
+	restMapper               meta.RESTMapper
+	log                      logr.Logger
+	modRuleStore             *core.ModRuleStore
+	clusterModRulesNamespace string
+	interval                 time.Duration
+}
+
+// auditScope describes the existing resources of a single kind audited against Reject ModRules.
+type auditScope struct {
+	mapping *meta.RESTMapping
+
+	// allNamespaces indicates that the resources are audited in all namespaces.
+	allNamespaces bool
+
+	// namespaces lists the namespaces whose resources are audited when allNamespaces is false.
+	namespaces map[string]bool
+}
+
+// NewAuditor creates a new Auditor.
+func NewAuditor(manager manager.Manager, modRuleStore *core.ModRuleStore, clusterModRulesNamespace core.ClusterModRulesNamespace, interval AuditInterval, log logr.Logger) *Auditor {
+	return &Auditor{
+		client:                   manager.GetClient(),
+		restMapper:               manager.GetRESTMapper(),
+		log:                      log.WithName("controllers").WithName("audit"),
+		modRuleStore:             modRuleStore,
+		clusterModRulesNamespace: string(clusterModRulesNamespace),
+		interval:                 time.Duration(interval),
+	}
+}
+
+// +kubebuilder:rbac:groups=wgpolicyk8s.io,resources=policyreports;clusterpolicyreports,verbs=get;list;create;update;delete
+
+// Start implements manager.Runnable.
+// It audits the existing resources every audit interval until the stop channel is closed.
+// The first audit is performed one interval after the start, once the ModRule store has been populated.
+func (a *Auditor) Start(stop <-chan struct{}) error {
+	if a.interval <= 0 {
+		a.log.V(1).Info("audit is disabled")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.audit(ctx); err != nil {
+				a.log.Error(err, "audit failed")
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// audit evaluates the existing resources against the current Reject ModRules and publishes the results.
+func (a *Auditor) audit(ctx context.Context) error {
+	scopes, err := a.findAuditScopes(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// Results are grouped by the namespace of the violating resources - cluster-scoped resources have an empty namespace.
+	results := map[string][]interface{}{}
+	scanned := 0
+	timestamp := time.Now()
+
+	for _, scope := range scopes {
+		listNamespaces := []string{""}
+
+		if !scope.allNamespaces {
+			listNamespaces = []string{}
+
+			for namespace := range scope.namespaces {
+				listNamespaces = append(listNamespaces, namespace)
+			}
+		}
+
+		for _, namespace := range listNamespaces {
+			count, err := a.auditResources(ctx, scope.mapping, namespace, timestamp, results)
+
+			if err != nil {
+				return err
+			}
+
+			scanned += count
+		}
+	}
+
+	if err := a.publishReports(ctx, results); err != nil {
+		return fmt.Errorf("unable to publish policy reports: %v", err)
+	}
+
+	a.log.Info("audit completed", "scanned", scanned, "violating namespaces", len(results))
+
+	return nil
+}
+
+// findAuditScopes returns the kinds of resources targeted by Reject ModRules along with the namespaces to audit.
+// Reject ModRules with no targets are not audited - they may apply to resources of any kind.
+func (a *Auditor) findAuditScopes(ctx context.Context) (map[schema.GroupKind]*auditScope, error) {
+	var modRules apiv1beta1.ModRuleList
+	var clusterModRules apiv1beta1.ClusterModRuleList
+
+	if err := a.client.List(ctx, &modRules); err != nil {
+		return nil, fmt.Errorf("unable to list ModRules: %v", err)
+	}
+
+	if err := a.client.List(ctx, &clusterModRules); err != nil {
+		return nil, fmt.Errorf("unable to list ClusterModRules: %v", err)
+	}
+
+	for i := range clusterModRules.Items {
+		modRules.Items = append(modRules.Items, *clusterModRules.Items[i].AsModRule())
+	}
+
+	scopes := map[schema.GroupKind]*auditScope{}
+
+	for _, modRule := range modRules.Items {
+		if modRule.Spec.Type != apiv1beta1.ModRuleTypeReject {
+			continue
+		}
+
+		// ClusterModRules and ModRules deployed to the cluster-wide namespace apply to resources in all namespaces.
+		clusterWide := modRule.Namespace == "" || modRule.Namespace == a.clusterModRulesNamespace
+
+		for _, target := range modRule.Spec.Targets {
+			groupKind := schema.GroupKind{Group: target.Group, Kind: target.Kind}
+			scope, ok := scopes[groupKind]
+
+			if !ok {
+				var versions []string
+
+				if target.Version != "" {
+					versions = append(versions, target.Version)
+				}
+
+				mapping, err := a.restMapper.RESTMapping(groupKind, versions...)
+
+				if err != nil {
+					a.log.Error(err, "unable to find resource of ModRule target", "modrule", modRule.GetNamespacedName(), "target", targetString(target))
+					continue
+				}
+
+				scope = &auditScope{mapping: mapping, namespaces: map[string]bool{}}
+				scopes[groupKind] = scope
+			}
+
+			switch {
+			case clusterWide:
+				scope.allNamespaces = true
+
+			// Namespaced ModRules do not apply to cluster-scoped resources.
+			case scope.mapping.Scope.Name() == meta.RESTScopeNameNamespace:
+				scope.namespaces[modRule.Namespace] = true
+			}
+		}
+	}
+
+	// Drop the kinds which are not audited in any namespace.
+	for groupKind, scope := range scopes {
+		if !scope.allNamespaces && len(scope.namespaces) == 0 {
+			delete(scopes, groupKind)
+		}
+	}
+
+	return scopes, nil
+}
+
+// auditResources evaluates the existing resources of the given kind in the given namespace page by page
+// and adds the policy report results of the violating resources to the given results.
+// An empty namespace stands for all namespaces. It returns the number of evaluated resources.
+func (a *Auditor) auditResources(ctx context.Context, mapping *meta.RESTMapping, namespace string, timestamp time.Time, results map[string][]interface{}) (int, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(mapping.GroupVersionKind.GroupVersion().WithKind(mapping.GroupVersionKind.Kind + "List"))
+	listOptions := []client.ListOption{client.Limit(auditPageSize)}
+	continueToken := ""
+	scanned := 0
+
+	if namespace != "" {
+		listOptions = append(listOptions, client.InNamespace(namespace))
+	}
+
+	for {
+		if err := a.client.List(ctx, list, append(listOptions, client.Continue(continueToken))...); err != nil {
+			return scanned, fmt.Errorf("unable to list resources of kind %s: %v", mapping.GroupVersionKind, err)
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			scanned++
+
+			for _, result := range a.auditResource(obj) {
+				results[obj.GetNamespace()] = append(results[obj.GetNamespace()], newPolicyReportResult(obj, result, timestamp))
+			}
+		}
+
+		continueToken = list.GetContinue()
+
+		if continueToken == "" {
+			return scanned, nil
+		}
+	}
+}
+
+// auditResource returns the Reject ModRules which would reject the given resource if it was created or updated today.
+func (a *Auditor) auditResource(obj *unstructured.Unstructured) []core.AuditResult {
+	log := a.log.WithValues("resource", fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName()), "namespace", obj.GetNamespace())
+
+	// Remove verbose managedFields as it is useless for the purposes of modrules.
+	obj.SetManagedFields(nil)
+
+	// Round-trip the resource through JSON in order to evaluate it exactly as an admitted resource.
+	objJSON, err := json.Marshal(obj)
+
+	if err != nil {
+		log.Error(err, "failed to encode resource")
+		return nil
+	}
+
+	jsonv := interface{}(nil)
+
+	if err := json.Unmarshal(objJSON, &jsonv); err != nil {
+		log.Error(err, "failed to decode resource")
+		return nil
+	}
+
+	results := []core.AuditResult{}
+	seen := map[string]bool{}
+
+	for _, admissionOperation := range []apiv1beta1.ModRuleAdmissionOperation{"CREATE", "UPDATE"} {
+		for _, result := range a.modRuleStore.AuditRejections(admissionOperation, obj.GetNamespace(), jsonv, log) {
+			if !seen[result.ModRule] {
+				seen[result.ModRule] = true
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results
+}
+
+// publishReports creates or updates the policy reports of the namespaces with violating resources
+// and deletes the policy reports of the namespaces which no longer have any.
+func (a *Auditor) publishReports(ctx context.Context, results map[string][]interface{}) error {
+	for namespace, namespaceResults := range results {
+		gvk := policyReportGVK
+
+		if namespace == "" {
+			gvk = clusterPolicyReportGVK
+		}
+
+		if err := a.publishReport(ctx, gvk, namespace, namespaceResults); err != nil {
+			return err
+		}
+	}
+
+	// Delete the reports of namespaces whose violations have been resolved.
+	reports := &unstructured.UnstructuredList{}
+	reports.SetGroupVersionKind(policyReportGVK.GroupVersion().WithKind(policyReportGVK.Kind + "List"))
+
+	if err := a.client.List(ctx, reports, client.MatchingLabels(auditReportLabels)); err != nil {
+		return err
+	}
+
+	for i := range reports.Items {
+		report := &reports.Items[i]
+
+		if _, ok := results[report.GetNamespace()]; !ok && report.GetName() == auditReportName {
+			if err := a.client.Delete(ctx, report); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+
+	if _, ok := results[""]; !ok {
+		report := &unstructured.Unstructured{}
+		report.SetGroupVersionKind(clusterPolicyReportGVK)
+		report.SetName(auditReportName)
+
+		if err := a.client.Delete(ctx, report); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishReport creates or updates the policy report of the given kind in the given namespace.
+func (a *Auditor) publishReport(ctx context.Context, gvk schema.GroupVersionKind, namespace string, results []interface{}) error {
+	report := &unstructured.Unstructured{}
+	report.SetGroupVersionKind(gvk)
+	err := a.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: auditReportName}, report)
+
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	exists := err == nil
+
+	if !exists {
+		report.SetNamespace(namespace)
+		report.SetName(auditReportName)
+		report.SetLabels(auditReportLabels)
+	}
+
+	report.Object["summary"] = newPolicyReportSummary(results)
+	report.Object["results"] = results
+
+	if exists {
+		return a.client.Update(ctx, report)
+	}
+
+	return a.client.Create(ctx, report)
+}
+
+// newPolicyReportResult returns the policy report result of a resource violating a Reject ModRule.
+// The violations of dry-run ModRules are reported as warnings.
+func newPolicyReportResult(obj *unstructured.Unstructured, auditResult core.AuditResult, timestamp time.Time) interface{} {
+	result := "fail"
+
+	if auditResult.DryRun {
+		result = "warn"
+	}
+
+	return map[string]interface{}{
+		"source":  auditReportSource,
+		"policy":  auditResult.ModRule,
+		"message": auditResult.Message,
+		"result":  result,
+		"scored":  true,
+		"timestamp": map[string]interface{}{
+			"seconds": timestamp.Unix(),
+			"nanos":   int64(0),
+		},
+		"resources": []interface{}{
+			map[string]interface{}{
+				"apiVersion": obj.GetAPIVersion(),
+				"kind":       obj.GetKind(),
+				"namespace":  obj.GetNamespace(),
+				"name":       obj.GetName(),
+				"uid":        string(obj.GetUID()),
+			},
+		},
+	}
+}
+
+// newPolicyReportSummary counts the given policy report results by their outcome.
+func newPolicyReportSummary(results []interface{}) map[string]interface{} {
+	summary := map[string]interface{}{
+		"pass":  int64(0),
+		"fail":  int64(0),
+		"warn":  int64(0),
+		"error": int64(0),
+		"skip":  int64(0),
+	}
+
+	for _, result := range results {
+		outcome := result.(map[string]interface{})["result"].(string)
+		summary[outcome] = summary[outcome].(int64) + 1
+	}
+
+	return summary
+}
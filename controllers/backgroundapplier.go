@@ -0,0 +1,396 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	ctrljsonpatch "gomodules.xyz/jsonpatch/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// BackgroundApplyQPS is a type used by DI to inject the maximum number of existing resources per second
+// evaluated by the background application of ModRules.
+type BackgroundApplyQPS float32
+
+const (
+	// backgroundApplyPageSize is the number of existing resources retrieved by a single list request.
+	backgroundApplyPageSize = 100
+
+	// backgroundApplyProgressInterval is the number of evaluated resources after which the progress is written to the ModRule status.
+	backgroundApplyProgressInterval = 50
+)
+
+// errBackgroundApplyAborted indicates that the ModRule has changed, has been deleted or no longer requests background application.
+var errBackgroundApplyAborted = errors.New("background application aborted")
+
+// BackgroundApplier applies Patch ModRules with spec.backgroundApply to the existing resources of their targets.
+// The patch of each existing resource is calculated by the ModRuleStore as if the resource was being updated by the ModRule alone.
+type BackgroundApplier struct {
+	client                   client.Client
+	restMapper               meta.RESTMapper
+	log                      logr.Logger
+	modRuleStore             *core.ModRuleStore
+	clusterModRulesNamespace string
+	rateLimiter              flowcontrol.RateLimiter
+	queue                    workqueue.Interface
+}
+
+// NewBackgroundApplier creates a new BackgroundApplier.
+func NewBackgroundApplier(manager manager.Manager, modRuleStore *core.ModRuleStore, clusterModRulesNamespace core.ClusterModRulesNamespace, qps BackgroundApplyQPS, log logr.Logger) *BackgroundApplier {
+	burst := int(qps)
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &BackgroundApplier{
+		client:                   manager.GetClient(),
+		restMapper:               manager.GetRESTMapper(),
+		log:                      log.WithName("controllers").WithName("background-apply"),
+		modRuleStore:             modRuleStore,
+		clusterModRulesNamespace: string(clusterModRulesNamespace),
+		rateLimiter:              flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst),
+		queue:                    workqueue.NewNamed("background-apply"),
+	}
+}
+
+// Enqueue schedules the background application of the ModRule identified by the given key.
+// Keys with an empty namespace identify ClusterModRules.
+func (a *BackgroundApplier) Enqueue(key types.NamespacedName) {
+	a.queue.Add(key)
+}
+
+// +kubebuilder:rbac:groups=*,resources=*,verbs=list;patch
+
+// Start implements manager.Runnable.
+// It applies the enqueued ModRules one at a time until the stop channel is closed.
+func (a *BackgroundApplier) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-stop
+		cancel()
+		a.queue.ShutDown()
+	}()
+
+	for a.processNextItem(ctx) {
+	}
+
+	return nil
+}
+
+// processNextItem applies the next enqueued ModRule.
+// It returns false when the queue has been shut down.
+func (a *BackgroundApplier) processNextItem(ctx context.Context) bool {
+	item, shutdown := a.queue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	defer a.queue.Done(item)
+
+	a.apply(ctx, item.(types.NamespacedName))
+
+	return true
+}
+
+// apply applies the current generation of the given ModRule to the existing resources of its targets
+// and reports the progress in the ModRule status.
+func (a *BackgroundApplier) apply(ctx context.Context, key types.NamespacedName) {
+	log := a.log.WithValues("modrule", key)
+
+	modRule, err := a.getModRule(ctx, key)
+
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to fetch ModRule")
+		}
+		return
+	}
+
+	if !modRule.Spec.BackgroundApply {
+		return
+	}
+
+	startTime := metav1.Now()
+	progress := &apiv1beta1.BackgroundApplyStatus{
+		ObservedGeneration: modRule.Generation,
+		Phase:              apiv1beta1.BackgroundApplyPhaseRunning,
+		StartTime:          &startTime,
+	}
+
+	log.Info("starting background application", "generation", modRule.Generation)
+
+	err = a.updateStatus(ctx, key, progress)
+
+	if err == nil {
+		err = a.applyToTargets(ctx, key, modRule, progress, log)
+	}
+
+	switch {
+	// A newer generation of the ModRule takes over - or there is nothing left to apply.
+	case errors.Is(err, errBackgroundApplyAborted) || apierrors.IsNotFound(err):
+		log.Info("background application aborted", "scanned", progress.Scanned, "patched", progress.Patched)
+		return
+
+	// The operator is shutting down - the ModRule is picked up again when the operator restarts.
+	case ctx.Err() != nil:
+		return
+
+	case err != nil:
+		log.Error(err, "background application failed")
+		progress.Phase = apiv1beta1.BackgroundApplyPhaseFailed
+		progress.Message = err.Error()
+
+	default:
+		log.Info("background application completed", "scanned", progress.Scanned, "patched", progress.Patched, "failed", progress.Failed)
+		progress.Phase = apiv1beta1.BackgroundApplyPhaseCompleted
+	}
+
+	completionTime := metav1.Now()
+	progress.CompletionTime = &completionTime
+
+	if err := a.updateStatus(ctx, key, progress); err != nil && !errors.Is(err, errBackgroundApplyAborted) && !apierrors.IsNotFound(err) {
+		log.Error(err, "unable to update ModRule background application status")
+	}
+}
+
+// applyToTargets lists the existing resources of each target of the given ModRule page by page and patches them.
+// Namespaced ModRules are applied to the resources in their namespace.
+// ClusterModRules and ModRules deployed to the cluster-wide namespace are applied to the resources in all namespaces
+// as well as to cluster-scoped resources.
+func (a *BackgroundApplier) applyToTargets(ctx context.Context, key types.NamespacedName, modRule *apiv1beta1.ModRule, progress *apiv1beta1.BackgroundApplyStatus, log logr.Logger) error {
+	clusterWide := key.Namespace == "" || key.Namespace == a.clusterModRulesNamespace
+
+	for _, target := range modRule.Spec.Targets {
+		mapping, err := a.findRESTMapping(target)
+
+		if err != nil {
+			return fmt.Errorf("unable to find resource of target %s: %v", targetString(target), err)
+		}
+
+		listOptions := []client.ListOption{client.Limit(backgroundApplyPageSize)}
+
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if !clusterWide {
+				listOptions = append(listOptions, client.InNamespace(key.Namespace))
+			}
+		} else if !clusterWide {
+			log.V(1).Info("skipping cluster-scoped target of namespaced ModRule", "target", targetString(target))
+			continue
+		}
+
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(mapping.GroupVersionKind.GroupVersion().WithKind(mapping.GroupVersionKind.Kind + "List"))
+		continueToken := ""
+
+		for {
+			if err := a.client.List(ctx, list, append(listOptions, client.Continue(continueToken))...); err != nil {
+				return fmt.Errorf("unable to list resources of target %s: %v", targetString(target), err)
+			}
+
+			for i := range list.Items {
+				if err := a.rateLimiter.Wait(ctx); err != nil {
+					return err
+				}
+
+				a.applyToObject(ctx, modRule, &list.Items[i], progress, log)
+
+				// Periodically report the progress - this also aborts the application if the ModRule has changed.
+				if progress.Scanned%backgroundApplyProgressInterval == 0 {
+					if err := a.updateStatus(ctx, key, progress); err != nil {
+						return err
+					}
+				}
+			}
+
+			continueToken = list.GetContinue()
+
+			if continueToken == "" {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyToObject calculates the patch of a single existing resource and applies it.
+// Only the given ModRule is applied - the other ModRules matching the resource are left to their own background application
+// or to the next update of the resource. No admission statistics are recorded.
+// Dry-run ModRules only count the resources they would have patched.
+func (a *BackgroundApplier) applyToObject(ctx context.Context, modRule *apiv1beta1.ModRule, obj *unstructured.Unstructured, progress *apiv1beta1.BackgroundApplyStatus, log logr.Logger) {
+	log = log.WithValues("resource", fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName()), "namespace", obj.GetNamespace())
+	progress.Scanned++
+
+	// Remove verbose managedFields as it is useless for the purposes of modrules.
+	obj.SetManagedFields(nil)
+	objJSON, err := json.Marshal(obj)
+
+	if err != nil {
+		log.Error(err, "failed to encode resource")
+		progress.Failed++
+		return
+	}
+
+	admissionOperation := apiv1beta1.ModRuleAdmissionOperation("UPDATE")
+
+	if !modRule.Spec.HasAdmissionOperation(admissionOperation) {
+		admissionOperation = "CREATE"
+	}
+
+	patch, err := a.modRuleStore.CalculateModRulePatch(admissionOperation, obj.GetNamespace(), modRule.Namespace, modRule.Name, objJSON, log)
+
+	if err != nil {
+		log.Error(err, "failed to calculate patch")
+		progress.Failed++
+		return
+	}
+
+	if len(patch) == 0 {
+		return
+	}
+
+	if modRule.IsDryRun() {
+		log.V(1).Info("dry-run ModRule would have patched resource")
+		progress.Patched++
+		return
+	}
+
+	// Do not overwrite modifications made to the resource since it was listed.
+	patch = append([]ctrljsonpatch.JsonPatchOperation{ctrljsonpatch.NewPatch("test", "/metadata/resourceVersion", obj.GetResourceVersion())}, patch...)
+	patchJSON, err := json.Marshal(patch)
+
+	if err != nil {
+		log.Error(err, "failed to encode patch")
+		progress.Failed++
+		return
+	}
+
+	if err := a.client.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patchJSON)); err != nil {
+		log.Error(err, "failed to patch resource")
+		progress.Failed++
+		return
+	}
+
+	log.V(1).Info("patched resource")
+	progress.Patched++
+}
+
+// findRESTMapping returns the REST mapping of the given target.
+// Targets with no version are mapped to the preferred version of their group.
+func (a *BackgroundApplier) findRESTMapping(target apiv1beta1.ModRuleTarget) (*meta.RESTMapping, error) {
+	groupKind := schema.GroupKind{Group: target.Group, Kind: target.Kind}
+
+	if target.Version == "" {
+		return a.restMapper.RESTMapping(groupKind)
+	}
+
+	return a.restMapper.RESTMapping(groupKind, target.Version)
+}
+
+// getModRule fetches the ModRule identified by the given key.
+// Keys with an empty namespace identify ClusterModRules - they are returned in the form of a ModRule with an empty namespace.
+func (a *BackgroundApplier) getModRule(ctx context.Context, key types.NamespacedName) (*apiv1beta1.ModRule, error) {
+	if key.Namespace == "" {
+		var clusterModRule apiv1beta1.ClusterModRule
+
+		if err := a.client.Get(ctx, key, &clusterModRule); err != nil {
+			return nil, err
+		}
+
+		return clusterModRule.AsModRule(), nil
+	}
+
+	var modRule apiv1beta1.ModRule
+
+	if err := a.client.Get(ctx, key, &modRule); err != nil {
+		return nil, err
+	}
+
+	return &modRule, nil
+}
+
+// updateStatus writes the given background application progress to the status of the ModRule identified by the given key.
+// It returns errBackgroundApplyAborted if the ModRule no longer matches the generation being applied or no longer requests background application.
+func (a *BackgroundApplier) updateStatus(ctx context.Context, key types.NamespacedName, progress *apiv1beta1.BackgroundApplyStatus) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if key.Namespace == "" {
+			var clusterModRule apiv1beta1.ClusterModRule
+
+			if err := a.client.Get(ctx, key, &clusterModRule); err != nil {
+				return err
+			}
+
+			if clusterModRule.Generation != progress.ObservedGeneration || !clusterModRule.Spec.BackgroundApply {
+				return errBackgroundApplyAborted
+			}
+
+			clusterModRule.Status.BackgroundApply = progress.DeepCopy()
+
+			return a.client.Status().Update(ctx, &clusterModRule)
+		}
+
+		var modRule apiv1beta1.ModRule
+
+		if err := a.client.Get(ctx, key, &modRule); err != nil {
+			return err
+		}
+
+		if modRule.Generation != progress.ObservedGeneration || !modRule.Spec.BackgroundApply {
+			return errBackgroundApplyAborted
+		}
+
+		modRule.Status.BackgroundApply = progress.DeepCopy()
+
+		return a.client.Status().Update(ctx, &modRule)
+	})
+}
+
+// needsBackgroundApply returns true if the given generation of a ModRule requests background application
+// which has not been carried out yet or has been interrupted.
+func needsBackgroundApply(spec *apiv1beta1.ModRuleSpec, status *apiv1beta1.ModRuleStatus, generation int64) bool {
+	if !spec.BackgroundApply {
+		return false
+	}
+
+	return status.BackgroundApply == nil ||
+		status.BackgroundApply.ObservedGeneration != generation ||
+		status.BackgroundApply.Phase == apiv1beta1.BackgroundApplyPhaseRunning
+}
+
+// targetString returns a human-readable representation of the given ModRule target.
+func targetString(target apiv1beta1.ModRuleTarget) string {
+	return schema.GroupVersionKind{Group: target.Group, Version: target.Version, Kind: target.Kind}.String()
+}
@@ -0,0 +1,183 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// ClusterModRuleReconciler reconciles a ClusterModRule object
+type ClusterModRuleReconciler struct {
+	client                   client.Client
+	log                      logr.Logger
+	scheme                   *runtime.Scheme
+	modRuleStore             *core.ModRuleStore
+	backgroundApplier        *BackgroundApplier
+	clusterModRulesNamespace string
+	syncTracker              *ModRuleSyncTracker
+	valueSources             *core.KubernetesValueSourceResolver
+	conflictNotifier         *PatchConflictNotifier
+	elected                  <-chan struct{}
+}
+
+// NewClusterModRuleReconciler creates a new ClusterModRuleReconciler.
+func NewClusterModRuleReconciler(manager manager.Manager, modRuleStore *core.ModRuleStore, backgroundApplier *BackgroundApplier, clusterModRulesNamespace core.ClusterModRulesNamespace, syncTracker *ModRuleSyncTracker, valueSources *core.KubernetesValueSourceResolver, conflictNotifier *PatchConflictNotifier, log logr.Logger) (*ClusterModRuleReconciler, error) {
+
+	reconciler := &ClusterModRuleReconciler{
+		client:                   manager.GetClient(),
+		log:                      log.WithName("controllers").WithName("clustermodrule"),
+		scheme:                   manager.GetScheme(),
+		modRuleStore:             modRuleStore,
+		backgroundApplier:        backgroundApplier,
+		clusterModRulesNamespace: string(clusterModRulesNamespace),
+		syncTracker:              syncTracker,
+		valueSources:             valueSources,
+		conflictNotifier:         conflictNotifier,
+		elected:                  manager.Elected(),
+	}
+
+	return reconciler, nil
+}
+
+// +kubebuilder:rbac:groups=api.kubemod.io,resources=clustermodrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=api.kubemod.io,resources=clustermodrules/status,verbs=get;update;patch
+
+// Reconcile performs ClusterModRule reconciliation.
+// ClusterModRules are loaded into the ModRule store by every replica of the operator, but only the leader updates their status.
+func (r *ClusterModRuleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	var clusterModRule apiv1beta1.ClusterModRule
+	ctx := context.Background()
+	log := r.log.WithValues("clustermodrule", req.Name)
+
+	// The ModRules which conflict with the stored generation of the ClusterModRule - the ones whose conflict changes are requeued.
+	previousConflicts := r.modRuleStore.FindStoredPatchConflicts("", req.Name)
+
+	if err := r.client.Get(ctx, req.NamespacedName, &clusterModRule); err != nil {
+
+		// If the cluster modrule is not found, then it has been deleted.
+		if apierrors.IsNotFound(err) {
+			// Delete the ClusterModRule from the ModRule memory store - cluster-scoped ModRules have no namespace.
+			r.modRuleStore.Delete("", req.Name)
+			r.valueSources.Untrack(req.NamespacedName)
+			r.syncTracker.Observe(req.NamespacedName, nil)
+
+			if isLeader(r.elected) {
+				r.conflictNotifier.Notify(previousConflicts, nil)
+			}
+		} else {
+			log.Error(err, "unable to fetch ClusterModRule")
+		}
+
+		// Ignore not-found errors since they can't be fixed by an immediate requeue
+		// (we will need to wait for a new notification), and we can get them on deleted requests.
+		return ctrl.Result{}, client.IgnoreNotFound((err))
+	}
+
+	// Store the ClusterModRule in our memory store in the form of a ModRule with an empty namespace.
+	// Note that the store keeps a reference to the ModRule - from here on we only touch copies of the ClusterModRule.
+	// Watch the ConfigMaps and Secrets referenced by the ClusterModRule before it is compiled - even if they are missing,
+	// in which case their creation recompiles the ClusterModRule.
+	r.valueSources.Track(req.NamespacedName, clusterModRule.Spec.Patch)
+	storeErr := r.modRuleStore.Put(clusterModRule.DeepCopy().AsModRule())
+	var conflicts []core.PatchConflict
+
+	if storeErr != nil {
+		log.Error(storeErr, "unable to store ClusterModRule")
+
+		// Make sure a previously stored generation of the ClusterModRule does not linger in the store.
+		r.modRuleStore.Delete("", req.Name)
+	} else {
+		log.V(1).Info("Successfully stored ClusterModRule")
+	}
+
+	r.syncTracker.Observe(req.NamespacedName, storeErr)
+
+	// Followers only load the rule - reporting its status and applying it to existing resources is up to the leader.
+	if !isLeader(r.elected) {
+		return ctrl.Result{}, nil
+	}
+
+	if storeErr == nil {
+		// Rules in the same execution tier and with the same priority run in namespace/name order - report the ones which write to the same paths.
+		conflicts = r.modRuleStore.FindPatchConflicts(clusterModRule.AsModRule())
+
+		// Apply the new generation of the ClusterModRule to the existing resources of its targets.
+		if needsBackgroundApply(&clusterModRule.Spec, &clusterModRule.Status, clusterModRule.Generation) {
+			r.backgroundApplier.Enqueue(req.NamespacedName)
+		}
+	}
+
+	// Update the status of the ModRules on the other side of the conflicts which have appeared or disappeared.
+	r.conflictNotifier.Notify(previousConflicts, r.modRuleStore.FindStoredPatchConflicts("", req.Name))
+
+	if err := r.updateStatus(ctx, &clusterModRule, storeErr, conflicts); err != nil {
+		log.Error(err, "unable to update ClusterModRule status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// updateStatus reflects the outcome of storing the ClusterModRule in its status subresource.
+// The status is only written if it has changed.
+func (r *ClusterModRuleReconciler) updateStatus(ctx context.Context, clusterModRule *apiv1beta1.ClusterModRule, storeErr error, conflicts []core.PatchConflict) error {
+	status, changed := newModRuleStatus(&clusterModRule.Status, clusterModRule.Generation, storeErr, conflicts)
+
+	if !changed {
+		return nil
+	}
+
+	updated := clusterModRule.DeepCopy()
+	updated.Status = *status
+
+	return r.client.Status().Update(ctx, updated)
+}
+
+// SetupWithManager hooks up our controller with the controller manager.
+func (r *ClusterModRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every replica loads the ClusterModRules into its store, hence the controller is not subject to leader election.
+	c, err := newNonLeaderElectionController("clustermodrule", mgr, r, &apiv1beta1.ClusterModRuleList{}, r.log)
+
+	if err != nil {
+		return err
+	}
+
+	// Status updates do not change the generation of a ClusterModRule - filter them out
+	// to prevent the reconciler from recompiling the ClusterModRule every time we write its status.
+	if err := c.Watch(&source.Kind{Type: &apiv1beta1.ClusterModRule{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{}); err != nil {
+		return err
+	}
+
+	// Changes to the patch conflicts of a ClusterModRule caused by other ModRules trigger the update of its status.
+	if err := c.Watch(&source.Channel{Source: r.conflictNotifier.ClusterModRuleEvents()}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+
+	// Changes to the ConfigMaps and Secrets referenced by the valueFrom of patch operations trigger the recompilation of the ClusterModRules.
+	return c.Watch(&source.Channel{Source: r.valueSources.ClusterModRuleEvents()}, &handler.EnqueueRequestForObject{})
+}
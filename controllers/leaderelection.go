@@ -0,0 +1,158 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Every replica of the operator serves admission requests, hence every replica must load the ModRules into its ModRule store.
+// The controllers which populate the ModRule store run on every replica regardless of leader election,
+// while the work which must be done once per cluster - status updates, background application, garbage collection - is left to the leader.
+
+// nonLeaderElectionController is a controller which runs on every replica of the operator.
+type nonLeaderElectionController struct {
+	controller.Controller
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (c *nonLeaderElectionController) NeedLeaderElection() bool {
+	return false
+}
+
+// newNonLeaderElectionController creates a controller which runs the given reconciler on every replica of the operator.
+// If resyncList is not nil, all objects of its type are reconciled again once the replica is elected leader.
+// This gives the reconciler a chance to perform the leader-only work it has skipped while the replica was a follower.
+func newNonLeaderElectionController(name string, mgr manager.Manager, reconciler reconcile.Reconciler, resyncList runtime.Object, log logr.Logger) (controller.Controller, error) {
+	c, err := controller.NewUnmanaged(name, mgr, controller.Options{Reconciler: reconciler})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resyncList != nil {
+		resync := &leaderResync{
+			client:  mgr.GetClient(),
+			list:    resyncList,
+			events:  make(chan event.GenericEvent),
+			backoff: leaderResyncBackoff,
+			log:     log,
+		}
+
+		if err := c.Watch(&source.Channel{Source: resync.events}, &handler.EnqueueRequestForObject{}); err != nil {
+			return nil, err
+		}
+
+		if err := mgr.Add(resync); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, mgr.Add(&nonLeaderElectionController{Controller: c})
+}
+
+// isLeader returns true if the replica has been elected leader.
+// Replicas which run with leader election disabled are always considered the leader.
+func isLeader(elected <-chan struct{}) bool {
+	select {
+	case <-elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// leaderResyncBackoff is the back-off between the attempts to list the objects to reconcile after leader election.
+// Once the cap is reached, the list is retried at the cap interval until it succeeds.
+var leaderResyncBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Steps:    10,
+	Cap:      time.Minute,
+}
+
+// leaderResync sends a generic event for every object of a list type once the replica is elected leader.
+// It is a leader election runnable - the manager only starts it after the replica has been elected.
+type leaderResync struct {
+	client  client.Client
+	list    runtime.Object
+	events  chan event.GenericEvent
+	backoff wait.Backoff
+	log     logr.Logger
+}
+
+// Start implements manager.Runnable.
+// Failures to list the objects are retried with exponential back-off until the stop channel is closed -
+// otherwise the leader-only work skipped while the replica was a follower would never be caught up with.
+func (r *leaderResync) Start(stop <-chan struct{}) error {
+	list := r.list.DeepCopyObject()
+	backoff := r.backoff
+
+	for {
+		err := r.client.List(context.Background(), list)
+
+		if err == nil {
+			break
+		}
+
+		delay := backoff.Step()
+		r.log.Error(err, "unable to list objects to reconcile after leader election - will retry", "delay", delay.String())
+
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return nil
+		}
+	}
+
+	items, err := meta.ExtractList(list)
+
+	if err != nil {
+		r.log.Error(err, "unable to extract objects to reconcile after leader election")
+		return nil
+	}
+
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+
+		if err != nil {
+			r.log.Error(err, "unable to access object to reconcile after leader election")
+			continue
+		}
+
+		select {
+		case r.events <- event.GenericEvent{Meta: accessor, Object: item}:
+		case <-stop:
+			return nil
+		}
+	}
+
+	r.log.V(1).Info("enqueued objects for reconciliation after leader election", "count", len(items))
+
+	return nil
+}
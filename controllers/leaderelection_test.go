@@ -0,0 +1,87 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// failingListClient fails the first given number of List calls.
+type failingListClient struct {
+	client.Client
+	failures int
+}
+
+func (c *failingListClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("connection refused")
+	}
+
+	return c.Client.List(ctx, list, opts...)
+}
+
+var _ = Describe("leaderResync", func() {
+	var resync *leaderResync
+
+	BeforeEach(func() {
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(apiv1beta1.AddToScheme(testScheme)).To(Succeed())
+
+		resync = &leaderResync{
+			client: &failingListClient{
+				Client:   fake.NewFakeClientWithScheme(testScheme, &apiv1beta1.ModRule{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-modrule"}}),
+				failures: 2,
+			},
+			list:    &apiv1beta1.ModRuleList{},
+			events:  make(chan event.GenericEvent, 1),
+			backoff: wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 10, Cap: 10 * time.Millisecond},
+			log:     core.NewTestLogger(GinkgoT()),
+		}
+	})
+
+	It("should retry listing the objects until it succeeds", func() {
+		Expect(resync.Start(make(chan struct{}))).To(Succeed())
+
+		var e event.GenericEvent
+		Expect(resync.events).To(Receive(&e))
+		Expect(e.Meta.GetName()).To(Equal("my-modrule"))
+	})
+
+	It("should stop retrying once the stop channel is closed", func() {
+		resync.client.(*failingListClient).failures = 1000
+		stop := make(chan struct{})
+		close(stop)
+
+		Expect(resync.Start(stop)).To(Succeed())
+		Expect(resync.events).NotTo(Receive())
+	})
+})
@@ -16,13 +16,18 @@ package controllers
 
 import (
 	"context"
+	"strings"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
 	"github.com/kubemod/kubemod/core"
@@ -30,20 +35,30 @@ import (
 
 // ModRuleReconciler reconciles a ModRule object
 type ModRuleReconciler struct {
-	client       client.Client
-	log          logr.Logger
-	scheme       *runtime.Scheme
-	modRuleStore *core.ModRuleStore
+	client            client.Client
+	log               logr.Logger
+	scheme            *runtime.Scheme
+	modRuleStore      *core.ModRuleStore
+	backgroundApplier *BackgroundApplier
+	syncTracker       *ModRuleSyncTracker
+	valueSources      *core.KubernetesValueSourceResolver
+	conflictNotifier  *PatchConflictNotifier
+	elected           <-chan struct{}
 }
 
 // NewModRuleReconciler creates a new ModRuleReconciler.
-func NewModRuleReconciler(manager manager.Manager, modRuleStore *core.ModRuleStore, log logr.Logger) (*ModRuleReconciler, error) {
+func NewModRuleReconciler(manager manager.Manager, modRuleStore *core.ModRuleStore, backgroundApplier *BackgroundApplier, syncTracker *ModRuleSyncTracker, valueSources *core.KubernetesValueSourceResolver, conflictNotifier *PatchConflictNotifier, log logr.Logger) (*ModRuleReconciler, error) {
 
 	reconciler := &ModRuleReconciler{
-		client:       manager.GetClient(),
-		log:          log.WithName("controllers").WithName("modrule"),
-		scheme:       manager.GetScheme(),
-		modRuleStore: modRuleStore,
+		client:            manager.GetClient(),
+		log:               log.WithName("controllers").WithName("modrule"),
+		scheme:            manager.GetScheme(),
+		modRuleStore:      modRuleStore,
+		backgroundApplier: backgroundApplier,
+		syncTracker:       syncTracker,
+		valueSources:      valueSources,
+		conflictNotifier:  conflictNotifier,
+		elected:           manager.Elected(),
 	}
 
 	return reconciler, nil
@@ -51,8 +66,10 @@ func NewModRuleReconciler(manager manager.Manager, modRuleStore *core.ModRuleSto
 
 // +kubebuilder:rbac:groups=api.kubemod.io,resources=modrules,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=api.kubemod.io,resources=modrules/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch
 
 // Reconcile performs ModRule reconciliation.
+// ModRules are loaded into the ModRule store by every replica of the operator, but only the leader updates their status.
 func (r *ModRuleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	var modRule apiv1beta1.ModRule
 	ctx := context.Background()
@@ -60,12 +77,21 @@ func (r *ModRuleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	storeNamespace := req.Namespace
 
+	// The ModRules which conflict with the stored generation of the ModRule - the ones whose conflict changes are requeued.
+	previousConflicts := r.modRuleStore.FindStoredPatchConflicts(storeNamespace, req.Name)
+
 	if err := r.client.Get(ctx, req.NamespacedName, &modRule); err != nil {
 
 		// If the modrule is not found, then it has been deleted.
 		if apierrors.IsNotFound(err) {
 			// Delete the ModRule from the ModRule memory store.
 			r.modRuleStore.Delete(storeNamespace, req.Name)
+			r.valueSources.Untrack(req.NamespacedName)
+			r.syncTracker.Observe(req.NamespacedName, nil)
+
+			if isLeader(r.elected) {
+				r.conflictNotifier.Notify(previousConflicts, nil)
+			}
 		} else {
 			log.Error(err, "unable to fetch ModRule")
 		}
@@ -75,19 +101,146 @@ func (r *ModRuleReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, client.IgnoreNotFound((err))
 	}
 
-	// Store the new ModRule in our memory store, but before we do, clear the namespace
-	// in case the ModRule is deployed to the cluster-wide namespace.
-	modRule.Namespace = storeNamespace
-	r.modRuleStore.Put(&modRule)
+	// Store the new ModRule in our memory store.
+	// Note that the store keeps a reference to the ModRule - from here on we only touch copies of it.
+	// Watch the ConfigMaps referenced by the ModRule before it is compiled - even if they are missing, in which case their creation recompiles the ModRule.
+	r.valueSources.Track(req.NamespacedName, modRule.Spec.Patch)
+	storeErr := r.modRuleStore.Put(&modRule)
+	var conflicts []core.PatchConflict
+
+	if storeErr != nil {
+		log.Error(storeErr, "unable to store ModRule")
+
+		// Make sure a previously stored generation of the ModRule does not linger in the store.
+		r.modRuleStore.Delete(storeNamespace, req.Name)
+	} else {
+		log.V(1).Info("Successfully stored ModRule")
+	}
 
-	log.V(1).Info("Successfully stored ModRule")
+	r.syncTracker.Observe(req.NamespacedName, storeErr)
+
+	// Followers only load the rule - reporting its status and applying it to existing resources is up to the leader.
+	if !isLeader(r.elected) {
+		return ctrl.Result{}, nil
+	}
+
+	if storeErr == nil {
+		// Rules in the same execution tier and with the same priority run in namespace/name order - report the ones which write to the same paths.
+		conflicts = r.modRuleStore.FindPatchConflicts(&modRule)
+
+		// Apply the new generation of the ModRule to the existing resources of its targets.
+		if needsBackgroundApply(&modRule.Spec, &modRule.Status, modRule.Generation) {
+			r.backgroundApplier.Enqueue(req.NamespacedName)
+		}
+	}
+
+	// Update the status of the ModRules on the other side of the conflicts which have appeared or disappeared.
+	r.conflictNotifier.Notify(previousConflicts, r.modRuleStore.FindStoredPatchConflicts(storeNamespace, req.Name))
+
+	if err := r.updateStatus(ctx, &modRule, storeErr, conflicts); err != nil {
+		log.Error(err, "unable to update ModRule status")
+		return ctrl.Result{}, err
+	}
 
 	return ctrl.Result{}, nil
 }
 
+// updateStatus reflects the outcome of storing the ModRule in its status subresource.
+// The status is only written if it has changed.
+func (r *ModRuleReconciler) updateStatus(ctx context.Context, modRule *apiv1beta1.ModRule, storeErr error, conflicts []core.PatchConflict) error {
+	status, changed := newModRuleStatus(&modRule.Status, modRule.Generation, storeErr, conflicts)
+
+	if !changed {
+		return nil
+	}
+
+	updated := modRule.DeepCopy()
+	updated.Status = *status
+
+	return r.client.Status().Update(ctx, updated)
+}
+
+// newModRuleStatus returns a copy of the given ModRule status which reflects the outcome of storing
+// the given generation of a ModRule or ClusterModRule in the ModRule store, along with its patch conflicts.
+// It also returns whether the new status differs from the given one.
+func newModRuleStatus(currentStatus *apiv1beta1.ModRuleStatus, generation int64, storeErr error, conflicts []core.PatchConflict) (*apiv1beta1.ModRuleStatus, bool) {
+	status := currentStatus.DeepCopy()
+	changed := status.ObservedGeneration != generation
+	status.ObservedGeneration = generation
+
+	if storeErr != nil {
+		changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+			Type:    apiv1beta1.ModRuleConditionCompiled,
+			Status:  metav1.ConditionFalse,
+			Reason:  "CompilationFailed",
+			Message: storeErr.Error(),
+		}) || changed
+
+		changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+			Type:    apiv1beta1.ModRuleConditionReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotLoaded",
+			Message: "ModRule failed to compile and is not in effect",
+		}) || changed
+	} else {
+		changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+			Type:   apiv1beta1.ModRuleConditionCompiled,
+			Status: metav1.ConditionTrue,
+			Reason: "CompilationSucceeded",
+		}) || changed
+
+		changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+			Type:    apiv1beta1.ModRuleConditionReady,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Loaded",
+			Message: "ModRule is loaded in the ModRule store and in effect",
+		}) || changed
+
+		if len(conflicts) > 0 {
+			messages := make([]string, len(conflicts))
+
+			for i, conflict := range conflicts {
+				messages[i] = conflict.String()
+			}
+
+			changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+				Type:    apiv1beta1.ModRuleConditionPatchConflict,
+				Status:  metav1.ConditionTrue,
+				Reason:  "OverlappingWritePaths",
+				Message: strings.Join(messages, "; "),
+			}) || changed
+		} else {
+			changed = status.SetCondition(apiv1beta1.ModRuleCondition{
+				Type:   apiv1beta1.ModRuleConditionPatchConflict,
+				Status: metav1.ConditionFalse,
+				Reason: "NoOverlappingWritePaths",
+			}) || changed
+		}
+	}
+
+	return status, changed
+}
+
 // SetupWithManager hooks up our controller with the controller manager.
 func (r *ModRuleReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&apiv1beta1.ModRule{}).
-		Complete(r)
+	// Every replica loads the ModRules into its store, hence the controller is not subject to leader election.
+	c, err := newNonLeaderElectionController("modrule", mgr, r, &apiv1beta1.ModRuleList{}, r.log)
+
+	if err != nil {
+		return err
+	}
+
+	// Status updates do not change the generation of a ModRule - filter them out
+	// to prevent the reconciler from recompiling the ModRule every time we write its status.
+	if err := c.Watch(&source.Kind{Type: &apiv1beta1.ModRule{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{}); err != nil {
+		return err
+	}
+
+	// Changes to the patch conflicts of a ModRule caused by other ModRules trigger the update of its status.
+	if err := c.Watch(&source.Channel{Source: r.conflictNotifier.ModRuleEvents()}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+
+	// Changes to the ConfigMaps referenced by the valueFrom of patch operations trigger the recompilation of the ModRules.
+	return c.Watch(&source.Channel{Source: r.valueSources.ModRuleEvents()}, &handler.EnqueueRequestForObject{})
 }
@@ -0,0 +1,136 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// ModRuleExceptionReconciler reconciles a ModRuleException object.
+// It loads ModRuleExceptions into the ModRule store and garbage-collects them once they expire.
+type ModRuleExceptionReconciler struct {
+	client       client.Client
+	log          logr.Logger
+	recorder     record.EventRecorder
+	modRuleStore *core.ModRuleStore
+	elected      <-chan struct{}
+}
+
+// NewModRuleExceptionReconciler creates a new ModRuleExceptionReconciler.
+func NewModRuleExceptionReconciler(manager manager.Manager, modRuleStore *core.ModRuleStore, log logr.Logger) (*ModRuleExceptionReconciler, error) {
+
+	reconciler := &ModRuleExceptionReconciler{
+		client:       manager.GetClient(),
+		log:          log.WithName("controllers").WithName("modruleexception"),
+		recorder:     manager.GetEventRecorderFor("kubemod"),
+		modRuleStore: modRuleStore,
+		elected:      manager.Elected(),
+	}
+
+	return reconciler, nil
+}
+
+// +kubebuilder:rbac:groups=api.kubemod.io,resources=modruleexceptions,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile performs ModRuleException reconciliation.
+// ModRuleExceptions are loaded into the ModRule store by every replica of the operator, but only the leader garbage-collects them.
+func (r *ModRuleExceptionReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	var exception apiv1beta1.ModRuleException
+	ctx := context.Background()
+	log := r.log.WithValues("modruleexception", req.NamespacedName)
+
+	if err := r.client.Get(ctx, req.NamespacedName, &exception); err != nil {
+
+		// If the exception is not found, then it has been deleted.
+		if apierrors.IsNotFound(err) {
+			r.modRuleStore.DeleteException(req.Namespace, req.Name)
+		} else {
+			log.Error(err, "unable to fetch ModRuleException")
+		}
+
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	now := time.Now()
+
+	// Garbage-collect expired exceptions.
+	if exception.IsExpired(now) {
+		r.modRuleStore.DeleteException(exception.Namespace, exception.Name)
+
+		// Followers only unload the exception - deleting it is up to the leader.
+		if !isLeader(r.elected) {
+			return ctrl.Result{}, nil
+		}
+
+		r.recorder.Eventf(&exception, corev1.EventTypeNormal, "Expired", "ModRuleException expired at %s and is no longer in effect", exception.Spec.ExpiresAt.UTC().Format(time.RFC3339))
+
+		if err := r.client.Delete(ctx, &exception); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "unable to delete expired ModRuleException")
+			return ctrl.Result{}, err
+		}
+
+		log.Info("Deleted expired ModRuleException")
+		return ctrl.Result{}, nil
+	}
+
+	// Store the exception in our memory store.
+	// Note that the store keeps a reference to the exception - from here on we only touch copies of it.
+	if err := r.modRuleStore.PutException(exception.DeepCopy()); err != nil {
+		log.Error(err, "unable to store ModRuleException")
+
+		// Make sure a previously stored generation of the exception does not linger in the store.
+		r.modRuleStore.DeleteException(exception.Namespace, exception.Name)
+
+		// Every replica fails to compile the exception - reporting the failure is up to the leader.
+		if isLeader(r.elected) {
+			r.recorder.Event(&exception, corev1.EventTypeWarning, "CompilationFailed", err.Error())
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	log.V(1).Info("Successfully stored ModRuleException")
+
+	// Come back when the exception expires.
+	return ctrl.Result{RequeueAfter: exception.Spec.ExpiresAt.Sub(now)}, nil
+}
+
+// SetupWithManager hooks up our controller with the controller manager.
+func (r *ModRuleExceptionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every replica loads the ModRuleExceptions into its store, hence the controller is not subject to leader election.
+	c, err := newNonLeaderElectionController("modruleexception", mgr, r, &apiv1beta1.ModRuleExceptionList{}, r.log)
+
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &apiv1beta1.ModRuleException{}}, &handler.EnqueueRequestForObject{}, predicate.GenerationChangedPredicate{})
+}
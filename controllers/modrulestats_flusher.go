@@ -0,0 +1,149 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// ModRuleStatsFlushInterval is a type used by DI to inject the interval at which ModRule statistics are flushed to ModRule status.
+type ModRuleStatsFlushInterval time.Duration
+
+// ModRuleStatsFlusher periodically flushes the runtime statistics collected by the ModRuleStore
+// into the status of the corresponding ModRules.
+type ModRuleStatsFlusher struct {
+	client       client.Client
+	log          logr.Logger
+	modRuleStore *core.ModRuleStore
+	interval     time.Duration
+}
+
+// NewModRuleStatsFlusher creates a new ModRuleStatsFlusher.
+func NewModRuleStatsFlusher(manager manager.Manager, modRuleStore *core.ModRuleStore, interval ModRuleStatsFlushInterval, log logr.Logger) *ModRuleStatsFlusher {
+	return &ModRuleStatsFlusher{
+		client:       manager.GetClient(),
+		log:          log.WithName("controllers").WithName("modrule-stats"),
+		modRuleStore: modRuleStore,
+		interval:     time.Duration(interval),
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+// Every replica of the operator serves admission requests, hence every replica collects statistics of its own.
+// The statistics are added to the ModRule status with optimistic concurrency, so every replica can safely flush them.
+func (f *ModRuleStatsFlusher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+// It flushes the collected statistics every flush interval until the stop channel is closed.
+func (f *ModRuleStatsFlusher) Start(stop <-chan struct{}) error {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.flush()
+		case <-stop:
+			// Make a last attempt to persist whatever we have collected before shutting down.
+			f.flush()
+			return nil
+		}
+	}
+}
+
+// flush drains the statistics from the ModRuleStore and adds them to the status of each ModRule.
+// Statistics which could not be written are restored in the store and retried on the next flush.
+func (f *ModRuleStatsFlusher) flush() {
+	ctx := context.Background()
+	stats := f.modRuleStore.DrainStats()
+	failed := make(map[types.NamespacedName]core.ModRuleStatsDelta)
+
+	for key, delta := range stats {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			return f.flushModRuleStats(ctx, key, delta)
+		})
+
+		if err != nil {
+			// The ModRule is gone - so are its statistics.
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			f.log.Error(err, "unable to flush ModRule statistics", "modrule", key)
+			failed[key] = delta
+		}
+	}
+
+	if len(failed) > 0 {
+		f.modRuleStore.RestoreStats(failed)
+	}
+
+	f.log.V(1).Info("flushed ModRule statistics", "count", len(stats)-len(failed))
+}
+
+// flushModRuleStats adds the given statistics delta to the status of the ModRule identified by the given key.
+// Keys with an empty namespace identify ClusterModRules.
+func (f *ModRuleStatsFlusher) flushModRuleStats(ctx context.Context, key types.NamespacedName, delta core.ModRuleStatsDelta) error {
+	if key.Namespace == "" {
+		var clusterModRule apiv1beta1.ClusterModRule
+
+		if err := f.client.Get(ctx, key, &clusterModRule); err != nil {
+			return err
+		}
+
+		addModRuleStats(&clusterModRule.Status.Stats, delta)
+
+		return f.client.Status().Update(ctx, &clusterModRule)
+	}
+
+	var modRule apiv1beta1.ModRule
+
+	if err := f.client.Get(ctx, key, &modRule); err != nil {
+		return err
+	}
+
+	addModRuleStats(&modRule.Status.Stats, delta)
+
+	return f.client.Status().Update(ctx, &modRule)
+}
+
+// addModRuleStats adds the given statistics delta to the given ModRule status statistics.
+func addModRuleStats(stats *apiv1beta1.ModRuleStats, delta core.ModRuleStatsDelta) {
+	stats.Matched += delta.Matched
+	stats.Patched += delta.Patched
+	stats.Rejected += delta.Rejected
+	stats.Errors += delta.Errors
+	stats.DryRunPatched += delta.DryRunPatched
+	stats.DryRunRejected += delta.DryRunRejected
+
+	if !delta.LastMatchTime.IsZero() && (stats.LastMatchTime == nil || delta.LastMatchTime.After(stats.LastMatchTime.Time)) {
+		lastMatchTime := metav1.NewTime(delta.LastMatchTime)
+		stats.LastMatchTime = &lastMatchTime
+	}
+}
@@ -0,0 +1,254 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+)
+
+// modRuleCompileFailedDesc describes the metric which lists the ModRules that failed to compile.
+var modRuleCompileFailedDesc = prometheus.NewDesc(
+	"kubemod_modrule_compile_failed",
+	"ModRules and ClusterModRules which failed to compile and are not in effect on this replica of the operator.",
+	[]string{"modrule"},
+	nil,
+)
+
+// ModRuleSyncTracker tracks the loading of the initial list of ModRules and ClusterModRules into the ModRule store.
+// It is used as a readiness check - a replica of the operator should not serve admission requests
+// before the ModRules which existed at the time it started have been compiled into its ModRule store.
+// It also keeps track of the ModRules which failed to compile - before and after the initial sync - and exposes them
+// as a Prometheus metric, which unlike the readiness check does not gate the replica.
+type ModRuleSyncTracker struct {
+	client client.Client
+	log    logr.Logger
+	lock   sync.Mutex
+	// The ModRules the reconcilers processed before the initial sync completed, keyed by namespace/name.
+	// ClusterModRules are keyed by their name and an empty namespace.
+	observed map[types.NamespacedName]bool
+	// The ModRules of the initial list which have not been processed yet - nil until the initial list has been taken.
+	pending map[types.NamespacedName]bool
+	// The ModRules which failed to compile, including the ones of the initial list.
+	failed map[types.NamespacedName]bool
+	synced bool
+}
+
+// NewModRuleSyncTracker creates a new ModRuleSyncTracker.
+func NewModRuleSyncTracker(manager manager.Manager, log logr.Logger) *ModRuleSyncTracker {
+	return &ModRuleSyncTracker{
+		client:   manager.GetClient(),
+		log:      log.WithName("controllers").WithName("modrule-sync"),
+		observed: make(map[types.NamespacedName]bool),
+		failed:   make(map[types.NamespacedName]bool),
+	}
+}
+
+// Observe records the outcome of storing the ModRule or ClusterModRule identified by the given key in the ModRule store.
+// ClusterModRules are identified by their name and an empty namespace.
+// Deleted ModRules are observed with a nil error.
+func (t *ModRuleSyncTracker) Observe(key types.NamespacedName, storeErr error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.recordFailure(key, storeErr)
+
+	if t.synced {
+		return
+	}
+
+	t.observed[key] = true
+
+	if t.pending != nil && t.pending[key] {
+		delete(t.pending, key)
+		t.completeIfSynced()
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+// Every replica of the operator loads the ModRules into its store, hence every replica must track its initial sync.
+func (t *ModRuleSyncTracker) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+// The manager starts the tracker once its cache has been synced - the tracker takes the initial list of ModRules from the cache.
+func (t *ModRuleSyncTracker) Start(stop <-chan struct{}) error {
+	var keys []types.NamespacedName
+
+	// Listing from the synced cache should not fail - keep trying if it does.
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		var err error
+
+		if keys, err = t.listModRules(); err != nil {
+			t.log.Error(err, "unable to list the initial ModRules")
+			return false, nil
+		}
+
+		return true, nil
+	}, stop)
+
+	if err != nil {
+		// The stop channel has been closed.
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.pending = make(map[types.NamespacedName]bool, len(keys))
+
+	for _, key := range keys {
+		if !t.observed[key] {
+			t.pending[key] = true
+		}
+	}
+
+	t.log.Info("waiting for the initial ModRules to be loaded", "count", len(keys), "pending", len(t.pending))
+	t.completeIfSynced()
+
+	return nil
+}
+
+// Check implements healthz.Checker.
+// It fails until all ModRules of the initial list have been processed.
+// The error lists the ModRules which failed to compile so far.
+// Once the initial sync is complete, the ModRules which failed to compile remain visible through Failed and the metrics of the tracker.
+func (t *ModRuleSyncTracker) Check(_ *http.Request) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.synced {
+		return nil
+	}
+
+	if t.pending == nil {
+		return fmt.Errorf("the initial list of ModRules has not been taken yet")
+	}
+
+	if failed := t.failedNames(); len(failed) > 0 {
+		return fmt.Errorf("waiting for %d ModRules to be loaded into the ModRule store, failed to compile: %s", len(t.pending), strings.Join(failed, ", "))
+	}
+
+	return fmt.Errorf("waiting for %d ModRules to be loaded into the ModRule store", len(t.pending))
+}
+
+// listModRules lists the keys of all ModRules and ClusterModRules.
+func (t *ModRuleSyncTracker) listModRules() ([]types.NamespacedName, error) {
+	var modRules apiv1beta1.ModRuleList
+	var clusterModRules apiv1beta1.ClusterModRuleList
+	ctx := context.Background()
+
+	if err := t.client.List(ctx, &modRules); err != nil {
+		return nil, err
+	}
+
+	if err := t.client.List(ctx, &clusterModRules); err != nil {
+		return nil, err
+	}
+
+	keys := make([]types.NamespacedName, 0, len(modRules.Items)+len(clusterModRules.Items))
+
+	for _, modRule := range modRules.Items {
+		keys = append(keys, types.NamespacedName{Namespace: modRule.Namespace, Name: modRule.Name})
+	}
+
+	for _, clusterModRule := range clusterModRules.Items {
+		keys = append(keys, types.NamespacedName{Name: clusterModRule.Name})
+	}
+
+	return keys, nil
+}
+
+// Failed returns the names of the ModRules and ClusterModRules which failed to compile, in alphabetical order.
+// ModRules are named namespace/name, while ClusterModRules are named by their name only.
+func (t *ModRuleSyncTracker) Failed() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.failedNames()
+}
+
+// Describe implements prometheus.Collector.
+func (t *ModRuleSyncTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- modRuleCompileFailedDesc
+}
+
+// Collect implements prometheus.Collector.
+// It reports a sample with value 1 for each ModRule which failed to compile.
+func (t *ModRuleSyncTracker) Collect(ch chan<- prometheus.Metric) {
+	for _, name := range t.Failed() {
+		ch <- prometheus.MustNewConstMetric(modRuleCompileFailedDesc, prometheus.GaugeValue, 1, name)
+	}
+}
+
+// recordFailure records the given ModRule as failed if it could not be stored, or clears its failure otherwise.
+// The caller is expected to hold the tracker lock.
+func (t *ModRuleSyncTracker) recordFailure(key types.NamespacedName, storeErr error) {
+	if storeErr != nil {
+		t.failed[key] = true
+	} else {
+		delete(t.failed, key)
+	}
+}
+
+// failedNames returns the names of the ModRules which failed to compile, in alphabetical order.
+// The caller is expected to hold the tracker lock.
+func (t *ModRuleSyncTracker) failedNames() []string {
+	names := make([]string, 0, len(t.failed))
+
+	for key := range t.failed {
+		if key.Namespace != "" {
+			names = append(names, key.String())
+		} else {
+			names = append(names, key.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// completeIfSynced marks the initial sync as complete if all ModRules of the initial list have been processed.
+// The caller is expected to hold the tracker lock.
+func (t *ModRuleSyncTracker) completeIfSynced() {
+	if len(t.pending) > 0 {
+		return
+	}
+
+	t.synced = true
+	t.observed = nil
+
+	if failed := t.failedNames(); len(failed) > 0 {
+		t.log.Info("initial ModRules loaded, some of them failed to compile and are not in effect", "failed", failed)
+	} else {
+		t.log.Info("initial ModRules loaded")
+	}
+}
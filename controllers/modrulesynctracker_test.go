@@ -0,0 +1,110 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+var _ = Describe("ModRuleSyncTracker", func() {
+	var (
+		tracker *ModRuleSyncTracker
+		modRule types.NamespacedName
+		cluster types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(apiv1beta1.AddToScheme(testScheme)).To(Succeed())
+
+		fakeClient := fake.NewFakeClientWithScheme(testScheme,
+			&apiv1beta1.ModRule{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-modrule"}},
+			&apiv1beta1.ClusterModRule{ObjectMeta: metav1.ObjectMeta{Name: "my-clustermodrule"}},
+		)
+
+		tracker = &ModRuleSyncTracker{
+			client:   fakeClient,
+			log:      core.NewTestLogger(GinkgoT()),
+			observed: make(map[types.NamespacedName]bool),
+			failed:   make(map[types.NamespacedName]bool),
+		}
+
+		modRule = types.NamespacedName{Namespace: "my-namespace", Name: "my-modrule"}
+		cluster = types.NamespacedName{Name: "my-clustermodrule"}
+	})
+
+	It("should not be ready until the initial ModRules have been loaded", func() {
+		Expect(tracker.Check(nil)).To(MatchError(ContainSubstring("has not been taken yet")))
+
+		tracker.Observe(cluster, nil)
+		Expect(tracker.Start(make(chan struct{}))).To(Succeed())
+		Expect(tracker.Check(nil)).To(MatchError("waiting for 1 ModRules to be loaded into the ModRule store"))
+
+		tracker.Observe(modRule, nil)
+		Expect(tracker.Check(nil)).To(Succeed())
+		Expect(tracker.Failed()).To(BeEmpty())
+	})
+
+	It("should become ready and keep the failure visible when the last pending ModRule fails to compile", func() {
+		Expect(tracker.Start(make(chan struct{}))).To(Succeed())
+
+		tracker.Observe(cluster, nil)
+		tracker.Observe(modRule, errors.New("invalid patch"))
+
+		Expect(tracker.Check(nil)).To(Succeed())
+		Expect(tracker.Failed()).To(Equal([]string{"my-namespace/my-modrule"}))
+
+		expected := `
+# HELP kubemod_modrule_compile_failed ModRules and ClusterModRules which failed to compile and are not in effect on this replica of the operator.
+# TYPE kubemod_modrule_compile_failed gauge
+kubemod_modrule_compile_failed{modrule="my-namespace/my-modrule"} 1
+`
+		Expect(testutil.CollectAndCompare(tracker, strings.NewReader(expected))).To(Succeed())
+	})
+
+	It("should keep tracking failures after the initial sync", func() {
+		Expect(tracker.Start(make(chan struct{}))).To(Succeed())
+
+		tracker.Observe(cluster, errors.New("invalid patch"))
+		Expect(tracker.Check(nil)).To(MatchError("waiting for 1 ModRules to be loaded into the ModRule store, failed to compile: my-clustermodrule"))
+
+		tracker.Observe(modRule, nil)
+		Expect(tracker.Check(nil)).To(Succeed())
+		Expect(tracker.Failed()).To(Equal([]string{"my-clustermodrule"}))
+
+		tracker.Observe(modRule, errors.New("invalid match"))
+		Expect(tracker.Failed()).To(Equal([]string{"my-clustermodrule", "my-namespace/my-modrule"}))
+
+		// Fixed and deleted ModRules are observed with no error.
+		tracker.Observe(cluster, nil)
+		tracker.Observe(modRule, nil)
+		Expect(tracker.Failed()).To(BeEmpty())
+		Expect(tracker.Check(nil)).To(Succeed())
+	})
+})
@@ -0,0 +1,149 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/kubemod/kubemod/core"
+)
+
+// NamespaceReconciler keeps the namespace label cache up to date with the labels of the namespaces in the cluster.
+// It is also used as a readiness check - a replica of the operator should not serve admission requests
+// before the labels of the namespaces which existed at the time it started have been cached.
+type NamespaceReconciler struct {
+	client              client.Client
+	log                 logr.Logger
+	namespaceLabelCache *core.NamespaceLabelCache
+	lock                sync.Mutex
+	synced              bool
+}
+
+// NewNamespaceReconciler creates a new NamespaceReconciler.
+func NewNamespaceReconciler(manager manager.Manager, namespaceLabelCache *core.NamespaceLabelCache, log logr.Logger) (*NamespaceReconciler, error) {
+
+	reconciler := &NamespaceReconciler{
+		client:              manager.GetClient(),
+		log:                 log.WithName("controllers").WithName("namespace"),
+		namespaceLabelCache: namespaceLabelCache,
+	}
+
+	return reconciler, nil
+}
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Reconcile performs Namespace reconciliation.
+func (r *NamespaceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	var namespace corev1.Namespace
+	ctx := context.Background()
+	log := r.log.WithValues("namespace", req.Name)
+
+	if err := r.client.Get(ctx, req.NamespacedName, &namespace); err != nil {
+
+		// If the namespace is not found, then it has been deleted.
+		if apierrors.IsNotFound(err) {
+			r.namespaceLabelCache.Delete(req.Name)
+		} else {
+			log.Error(err, "unable to fetch Namespace")
+		}
+
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	r.namespaceLabelCache.Put(namespace.Name, namespace.Labels)
+	log.V(1).Info("Successfully cached Namespace labels", "labels", namespace.Labels)
+
+	return ctrl.Result{}, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+// Every replica of the operator evaluates the namespace selectors of ModRules, hence every replica must cache the namespace labels.
+func (r *NamespaceReconciler) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+// The manager starts the reconciler once its cache has been synced - the reconciler caches the labels of all namespaces
+// in the synced cache at once rather than waiting for each of them to be reconciled.
+func (r *NamespaceReconciler) Start(stop <-chan struct{}) error {
+	// Listing from the synced cache should not fail - keep trying if it does.
+	err := wait.PollImmediateUntil(time.Second, func() (bool, error) {
+		var namespaces corev1.NamespaceList
+
+		if err := r.client.List(context.Background(), &namespaces); err != nil {
+			r.log.Error(err, "unable to list the initial Namespaces")
+			return false, nil
+		}
+
+		for _, namespace := range namespaces.Items {
+			r.namespaceLabelCache.Put(namespace.Name, namespace.Labels)
+		}
+
+		r.log.Info("cached the labels of the initial Namespaces", "count", len(namespaces.Items))
+		return true, nil
+	}, stop)
+
+	if err != nil {
+		// The stop channel has been closed.
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.synced = true
+	return nil
+}
+
+// Check implements healthz.Checker.
+// It fails until the labels of the initial list of namespaces have been cached.
+func (r *NamespaceReconciler) Check(_ *http.Request) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.synced {
+		return errors.New("the labels of the initial list of Namespaces have not been cached yet")
+	}
+
+	return nil
+}
+
+// SetupWithManager hooks up our controller with the controller manager.
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Every replica evaluates the namespace selectors of ModRules, hence the controller is not subject to leader election.
+	// There is no leader-only work to catch up with once the replica is elected.
+	c, err := newNonLeaderElectionController("namespace", mgr, r, nil, r.log)
+
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestForObject{})
+}
@@ -0,0 +1,46 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubemod/kubemod/core"
+)
+
+var _ = Describe("NamespaceReconciler", func() {
+	It("should not be ready until the labels of the initial Namespaces have been cached", func() {
+		namespaceLabelCache := core.NewNamespaceLabelCache()
+		reconciler := &NamespaceReconciler{
+			client: fake.NewFakeClientWithScheme(clientgoscheme.Scheme,
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod-1", Labels: map[string]string{"env": "production"}}},
+			),
+			log:                 core.NewTestLogger(GinkgoT()),
+			namespaceLabelCache: namespaceLabelCache,
+		}
+
+		Expect(reconciler.Check(nil)).NotTo(Succeed())
+
+		Expect(reconciler.Start(make(chan struct{}))).To(Succeed())
+		Expect(reconciler.Check(nil)).To(Succeed())
+		Expect(namespaceLabelCache.Get("prod-1")).To(Equal(labels.Set{"env": "production"}))
+	})
+})
@@ -0,0 +1,95 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/core"
+)
+
+// PatchConflictNotifier requeues the ModRules and ClusterModRules whose patch conflicts have changed
+// because a ModRule or ClusterModRule they conflict with has been stored or deleted.
+// The status of a ModRule only reflects the conflicts found when it was last reconciled - requeuing the ModRules
+// on the other side of a conflict keeps their status up to date as well.
+type PatchConflictNotifier struct {
+	modRuleEvents        chan event.GenericEvent
+	clusterModRuleEvents chan event.GenericEvent
+}
+
+// NewPatchConflictNotifier creates a new PatchConflictNotifier.
+func NewPatchConflictNotifier() *PatchConflictNotifier {
+	return &PatchConflictNotifier{
+		modRuleEvents:        make(chan event.GenericEvent),
+		clusterModRuleEvents: make(chan event.GenericEvent),
+	}
+}
+
+// ModRuleEvents returns the channel which receives a generic event for every ModRule whose patch conflicts have changed.
+func (n *PatchConflictNotifier) ModRuleEvents() <-chan event.GenericEvent {
+	return n.modRuleEvents
+}
+
+// ClusterModRuleEvents returns the channel which receives a generic event for every ClusterModRule whose patch conflicts have changed.
+func (n *PatchConflictNotifier) ClusterModRuleEvents() <-chan event.GenericEvent {
+	return n.clusterModRuleEvents
+}
+
+// Notify requeues the ModRules whose conflict with a ModRule differs between the given conflicts of the ModRule,
+// found before and after it was stored or deleted.
+// Conflicts are keyed by the conflicting ModRule - ClusterModRules are keyed by their name and an empty namespace.
+// ModRules whose conflict has not changed are not requeued, which keeps two conflicting ModRules from requeuing each other forever.
+func (n *PatchConflictNotifier) Notify(before map[types.NamespacedName]core.PatchConflict, after map[types.NamespacedName]core.PatchConflict) {
+	for _, key := range changedPatchConflicts(before, after) {
+		meta := metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}
+
+		if key.Namespace == "" {
+			object := &apiv1beta1.ClusterModRule{ObjectMeta: meta}
+			n.clusterModRuleEvents <- event.GenericEvent{Meta: object, Object: object}
+		} else {
+			object := &apiv1beta1.ModRule{ObjectMeta: meta}
+			n.modRuleEvents <- event.GenericEvent{Meta: object, Object: object}
+		}
+	}
+}
+
+// changedPatchConflicts returns the keys of the conflicting ModRules which are only present in one of the given sets of conflicts
+// or whose conflict differs between them, in namespace/name order.
+func changedPatchConflicts(before map[types.NamespacedName]core.PatchConflict, after map[types.NamespacedName]core.PatchConflict) []types.NamespacedName {
+	var keys []types.NamespacedName
+
+	for key, conflict := range before {
+		if afterConflict, ok := after[key]; !ok || afterConflict != conflict {
+			keys = append(keys, key)
+		}
+	}
+
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
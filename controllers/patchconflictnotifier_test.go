@@ -0,0 +1,78 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/kubemod/kubemod/core"
+)
+
+var _ = Describe("PatchConflictNotifier", func() {
+	var (
+		notifier *PatchConflictNotifier
+		modRule  types.NamespacedName
+		cluster  types.NamespacedName
+	)
+
+	BeforeEach(func() {
+		notifier = NewPatchConflictNotifier()
+		modRule = types.NamespacedName{Namespace: "my-namespace", Name: "my-modrule"}
+		cluster = types.NamespacedName{Name: "my-clustermodrule"}
+	})
+
+	conflictWith := func(conflictingPath string) core.PatchConflict {
+		return core.PatchConflict{ModRule: "my-namespace/other", Path: "/metadata/labels", ConflictingPath: conflictingPath}
+	}
+
+	It("should requeue the ModRules whose conflict has appeared, disappeared or changed", func() {
+		before := map[types.NamespacedName]core.PatchConflict{
+			modRule: conflictWith("/metadata/labels/a"),
+		}
+		after := map[types.NamespacedName]core.PatchConflict{
+			modRule: conflictWith("/metadata/labels/b"),
+			cluster: conflictWith("/metadata/labels/c"),
+		}
+
+		Expect(changedPatchConflicts(before, after)).To(Equal([]types.NamespacedName{cluster, modRule}))
+		Expect(changedPatchConflicts(after, nil)).To(Equal([]types.NamespacedName{cluster, modRule}))
+	})
+
+	It("should not requeue the ModRules whose conflict has not changed", func() {
+		conflicts := map[types.NamespacedName]core.PatchConflict{
+			modRule: conflictWith("/metadata/labels/a"),
+		}
+
+		Expect(changedPatchConflicts(conflicts, conflicts)).To(BeEmpty())
+	})
+
+	It("should send ModRules and ClusterModRules to their own channels", func() {
+		go notifier.Notify(nil, map[types.NamespacedName]core.PatchConflict{
+			modRule: conflictWith("/metadata/labels/a"),
+			cluster: conflictWith("/metadata/labels/a"),
+		})
+
+		var e event.GenericEvent
+		Eventually(notifier.ClusterModRuleEvents()).Should(Receive(&e))
+		Expect(e.Meta.GetName()).To(Equal("my-clustermodrule"))
+
+		Eventually(notifier.ModRuleEvents()).Should(Receive(&e))
+		Expect(e.Meta.GetNamespace()).To(Equal("my-namespace"))
+		Expect(e.Meta.GetName()).To(Equal("my-modrule"))
+	})
+})
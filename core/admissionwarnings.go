@@ -0,0 +1,142 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// WarningAdmissionWebhook is an http.Handler which serves admission requests through an admission.Handler
+// and, in addition to the standard admission response, returns the admission warnings collected while handling the request.
+// Admission warnings were introduced in Kubernetes 1.19, which is newer than the admission API vendored by controller-runtime,
+// hence the need for a custom webhook implementation.
+type WarningAdmissionWebhook struct {
+	handler admission.Handler
+	log     logr.Logger
+}
+
+// admissionWarningsKey is the context key of the admission warnings collected while handling an admission request.
+type admissionWarningsKey struct{}
+
+// warningAdmissionResponse extends the v1beta1 admission response with field "warnings".
+type warningAdmissionResponse struct {
+	admissionv1beta1.AdmissionResponse `json:",inline"`
+
+	// Warnings is a list of warning messages to return to the requesting API client.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// warningAdmissionReview is an admission review carrying a warningAdmissionResponse.
+type warningAdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Response *warningAdmissionResponse `json:"response,omitempty"`
+}
+
+// NewWarningAdmissionWebhook constructs a new admission webhook capable of returning warnings.
+func NewWarningAdmissionWebhook(handler admission.Handler, log logr.Logger) *WarningAdmissionWebhook {
+	return &WarningAdmissionWebhook{
+		handler: handler,
+		log:     log.WithName("warning-admission-webhook"),
+	}
+}
+
+// AddAdmissionWarnings adds warnings to the response of the admission request associated with the given context.
+// The warnings are discarded if the request is not served by a WarningAdmissionWebhook.
+func AddAdmissionWarnings(ctx context.Context, warnings ...string) {
+	if collector, ok := ctx.Value(admissionWarningsKey{}).(*[]string); ok {
+		*collector = append(*collector, warnings...)
+	}
+}
+
+// withAdmissionWarnings returns a child context which collects the admission warnings added through AddAdmissionWarnings.
+func withAdmissionWarnings(ctx context.Context) (context.Context, *[]string) {
+	warnings := []string{}
+	return context.WithValue(ctx, admissionWarningsKey{}, &warnings), &warnings
+}
+
+// ServeHTTP implements http.Handler.
+func (wh *WarningAdmissionWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		err := errors.New("request body is empty")
+		wh.log.Error(err, "bad request")
+		wh.writeResponse(w, metav1.TypeMeta{}, admission.Errored(http.StatusBadRequest, err), nil)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		wh.log.Error(err, "unable to read the body from the incoming request")
+		wh.writeResponse(w, metav1.TypeMeta{}, admission.Errored(http.StatusBadRequest, err), nil)
+		return
+	}
+
+	// Verify the content type is accurate.
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		err = fmt.Errorf("contentType=%s, expected application/json", contentType)
+		wh.log.Error(err, "unable to process a request with an unknown content type", "content type", contentType)
+		wh.writeResponse(w, metav1.TypeMeta{}, admission.Errored(http.StatusBadRequest, err), nil)
+		return
+	}
+
+	req := admission.Request{}
+	review := admissionv1beta1.AdmissionReview{
+		Request: &req.AdmissionRequest,
+	}
+
+	if err = json.Unmarshal(body, &review); err != nil {
+		wh.log.Error(err, "unable to decode the request")
+		wh.writeResponse(w, metav1.TypeMeta{}, admission.Errored(http.StatusBadRequest, err), nil)
+		return
+	}
+
+	ctx, warnings := withAdmissionWarnings(r.Context())
+	response := wh.handler.Handle(ctx, req)
+
+	if err = response.Complete(req); err != nil {
+		wh.log.Error(err, "unable to complete the admission response")
+		response = admission.Errored(http.StatusInternalServerError, err)
+		response.UID = req.UID
+	}
+
+	wh.writeResponse(w, review.TypeMeta, response, *warnings)
+}
+
+func (wh *WarningAdmissionWebhook) writeResponse(w http.ResponseWriter, typeMeta metav1.TypeMeta, response admission.Response, warnings []string) {
+	review := warningAdmissionReview{
+		TypeMeta: typeMeta,
+		Response: &warningAdmissionResponse{
+			AdmissionResponse: response.AdmissionResponse,
+			Warnings:          warnings,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		wh.log.Error(err, "unable to encode the response")
+	}
+}
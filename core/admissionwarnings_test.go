@@ -0,0 +1,82 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kubemod/kubemod/util"
+)
+
+var _ = Describe("WarningAdmissionWebhook", func() {
+
+	serve := func(handler admission.HandlerFunc, body string) map[string]interface{} {
+		webhook := NewWarningAdmissionWebhook(handler, util.TestLogger{TLogger: GinkgoT()})
+
+		req := httptest.NewRequest(http.MethodPost, "/dragnet-webhook", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+
+		webhook.ServeHTTP(recorder, req)
+
+		review := map[string]interface{}{}
+		err := json.Unmarshal(recorder.Body.Bytes(), &review)
+		Expect(err).NotTo(HaveOccurred())
+
+		return review
+	}
+
+	It("should return the warnings added by the handler", func() {
+		review := serve(func(ctx context.Context, req admission.Request) admission.Response {
+			AddAdmissionWarnings(ctx, "warning 1")
+			AddAdmissionWarnings(ctx, "warning 2")
+			return admission.Allowed("ok")
+		}, `{"apiVersion": "admission.k8s.io/v1beta1", "kind": "AdmissionReview", "request": {"uid": "123"}}`)
+
+		Expect(review["apiVersion"]).To(Equal("admission.k8s.io/v1beta1"))
+		response := review["response"].(map[string]interface{})
+		Expect(response["uid"]).To(Equal("123"))
+		Expect(response["allowed"]).To(BeTrue())
+		Expect(response["warnings"]).To(Equal([]interface{}{"warning 1", "warning 2"}))
+	})
+
+	It("should omit warnings when there are none", func() {
+		review := serve(func(ctx context.Context, req admission.Request) admission.Response {
+			return admission.Denied("no")
+		}, `{"request": {"uid": "123"}}`)
+
+		response := review["response"].(map[string]interface{})
+		Expect(response["allowed"]).To(BeFalse())
+		Expect(response).NotTo(HaveKey("warnings"))
+	})
+
+	It("should report malformed requests", func() {
+		review := serve(func(ctx context.Context, req admission.Request) admission.Response {
+			return admission.Allowed("ok")
+		}, `{`)
+
+		response := review["response"].(map[string]interface{})
+		Expect(response["allowed"]).To(BeFalse())
+		Expect(response["status"].(map[string]interface{})["code"]).To(Equal(float64(http.StatusBadRequest)))
+	})
+})
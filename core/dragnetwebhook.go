@@ -23,6 +23,8 @@ import (
 	"github.com/kubemod/kubemod/api/v1beta1"
 
 	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,20 +32,42 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// WarnNonIdempotentPatches is a type of bool used by DI to inject whether the dragnet webhook should warn about non-idempotent patches.
+type WarnNonIdempotentPatches bool
+
 // DragnetWebhookHandler is the main entrypoint to KubeMod's mutating admission webhook.
 type DragnetWebhookHandler struct {
-	client       client.Client
-	decoder      *admission.Decoder
-	log          logr.Logger
-	modRuleStore *ModRuleStore
+	client                   client.Client
+	decoder                  *admission.Decoder
+	log                      logr.Logger
+	modRuleStore             *ModRuleStore
+	resourceGenerator        *ResourceGenerator
+	warnNonIdempotentPatches bool
+}
+
+// admissionContext is the context of an admission request injected at field "admission" of every resource processed by the dragnet webhook.
+type admissionContext struct {
+	// UserInfo is information about the requesting user.
+	UserInfo authenticationv1.UserInfo `json:"userInfo"`
+
+	// DryRun indicates that modifications will definitely not be persisted for this request.
+	DryRun bool `json:"dryRun"`
+
+	// SubResource is the subresource being requested, if any.
+	SubResource string `json:"subResource"`
+
+	// Kind is the fully-qualified type of the object being submitted.
+	Kind metav1.GroupVersionKind `json:"kind"`
 }
 
 // NewDragnetWebhookHandler constructs a new core webhook handler.
-func NewDragnetWebhookHandler(manager manager.Manager, modRuleStore *ModRuleStore, log logr.Logger) *DragnetWebhookHandler {
+func NewDragnetWebhookHandler(manager manager.Manager, modRuleStore *ModRuleStore, resourceGenerator *ResourceGenerator, warnNonIdempotentPatches WarnNonIdempotentPatches, log logr.Logger) *DragnetWebhookHandler {
 	return &DragnetWebhookHandler{
-		client:       manager.GetClient(),
-		log:          log.WithName("dragnet-webhook"),
-		modRuleStore: modRuleStore,
+		client:                   manager.GetClient(),
+		log:                      log.WithName("dragnet-webhook"),
+		modRuleStore:             modRuleStore,
+		resourceGenerator:        resourceGenerator,
+		warnNonIdempotentPatches: bool(warnNonIdempotentPatches),
 	}
 }
 
@@ -68,44 +92,173 @@ func (h *DragnetWebhookHandler) Handle(ctx context.Context, req admission.Reques
 		storeNamespace = ""
 	}
 
-	// Inject syntheticRefs into object.
-	obj, err := h.injectSyntheticRefs(ctx, obj, storeNamespace)
+	// The old object is only relevant to UPDATE operations - for DELETE operations it is the target itself.
+	var oldObj []byte
+	if req.Operation == "UPDATE" {
+		oldObj = req.OldObject.Raw
+	}
+
+	// Inject syntheticRefs, the admission request context and the old object into object.
+	obj, err := h.injectSyntheticRefs(ctx, obj, storeNamespace, newAdmissionContext(&req), oldObj)
 
 	if err != nil {
 		log.Error(err, "Failed to inject syntheticRefs into object manifest")
-		return admission.Allowed("failed to inject syntheticRefs into object manifest")
+		return h.evaluationErrorResponse(&req, storeNamespace, err, "failed to inject syntheticRefs into object manifest")
+	}
+
+	// The report collects the outcomes of dry-run ModRules and the evaluation errors of fail-closed ModRules.
+	report := &OperationReport{}
+
+	// Collect an evaluation trace only when debug logging is on - it explains why each ModRule did or did not apply.
+	if log.V(1).Enabled() {
+		report.Trace = &EvaluationTrace{}
+		defer func() {
+			log.V(1).Info("ModRule evaluation trace", "trace", report.Trace)
+		}()
 	}
 
 	// First run patch operations.
-	patchedJSON, patch, err := h.modRuleStore.CalculatePatch(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, obj, log)
+	patchedJSON, patch, err := h.modRuleStore.CalculatePatch(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, obj, report, log)
 
 	if err != nil {
 		log.Error(err, "Failed to calculate patch")
-		// We don't want to fail the admission just because we cannot decode the JSON.
-		return admission.Allowed("failed to calculate patch")
+		// We don't want to fail the admission just because we cannot decode the JSON - unless a fail-closed ModRule is in play.
+		return h.evaluationErrorResponse(&req, storeNamespace, err, "failed to calculate patch")
+	}
+
+	// A fail-closed ModRule which failed to patch the object denies the operation - there is no point in evaluating the rest.
+	if len(report.Failures) > 0 {
+		return withDryRunAuditAnnotation(failuresResponse(report, log), report, log)
 	}
 
 	// Then test the result against the set of relevant Reject rules.
-	rejections := h.modRuleStore.DetermineRejections(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, patchedJSON, log)
+	rejections := h.modRuleStore.DetermineRejections(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, patchedJSON, report, log)
 
 	if len(rejections) > 0 {
 		rejectionMessages := strings.Join(rejections, ",")
 		log.Info("Rejected", "rejections", rejectionMessages)
 		// We don't want to fail the admission just because someone messed up their Reject rule.
-		return admission.Denied(fmt.Sprintf("operation rejected by the following ModRule(s): %s", rejectionMessages))
+		return withDryRunAuditAnnotation(admission.Denied(fmt.Sprintf("operation rejected by the following ModRule(s): %s", rejectionMessages)), report, log)
+	}
+
+	// Warn rules do not affect the outcome of the admission - pass their messages back to the client as admission warnings.
+	warnings := h.modRuleStore.DetermineWarnings(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, patchedJSON, report, log)
+
+	if len(warnings) > 0 {
+		log.Info("Warned", "warnings", strings.Join(warnings, ","))
+		AddAdmissionWarnings(ctx, warnings...)
+	}
+
+	// Generate rules create their companion resources asynchronously - unless the request is not going to be persisted.
+	var generated []*GeneratedResource
+	if req.DryRun == nil || !*req.DryRun {
+		generated = h.modRuleStore.CalculateGeneratedResources(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, patchedJSON, report, log)
+	}
+
+	// Fail-closed Warn and Generate ModRules which failed to evaluate deny the operation.
+	if len(report.Failures) > 0 {
+		return withDryRunAuditAnnotation(failuresResponse(report, log), report, log)
+	}
+
+	if len(generated) > 0 {
+		// Triggers with no name are labeled so that the resource generator can find them once they are persisted.
+		patch = append(patch, labelUnnamedTrigger(patchedJSON, req.UID, generated)...)
+
+		log.Info("Generating resources", "count", len(generated))
+		h.resourceGenerator.Enqueue(generated...)
 	}
 
 	// If we are here, then the object and its patch passed all rejection rules.
 	// Check if we actually had a patch and if yes, return that to Kubernetes for processing.
 	if len(patch) > 0 {
+		if h.warnNonIdempotentPatches {
+			h.warnIfNotIdempotent(ctx, storeNamespace, patchedJSON, log)
+		}
+
 		log.Info("Applying ModRule patch", "patch", patch)
-		return admission.Patched("patched ok", patch...)
+		return withDryRunAuditAnnotation(admission.Patched("patched ok", patch...), report, log)
+	}
+
+	return withDryRunAuditAnnotation(admission.Allowed("non-patched ok"), report, log)
+}
+
+// warnIfNotIdempotent adds an admission warning if the Patch ModRules would change the patched object again the next time it is updated.
+func (h *DragnetWebhookHandler) warnIfNotIdempotent(ctx context.Context, storeNamespace string, patched interface{}, log logr.Logger) {
+	result, err := h.modRuleStore.CheckIdempotency("UPDATE", storeNamespace, patched, log)
+
+	if err != nil {
+		log.Error(err, "Failed to check patch idempotency")
+		return
+	}
+
+	if result.IsIdempotent() {
+		return
 	}
 
-	return admission.Allowed("non-patched ok")
+	log.Info("Patch is not idempotent", "modrules", result.ModRules, "second pass patch", result.Patch)
+	AddAdmissionWarnings(ctx, fmt.Sprintf("the patch of the following ModRule(s) is not idempotent: %s", strings.Join(result.ModRules, ",")))
 }
 
-func (h *DragnetWebhookHandler) injectSyntheticRefs(ctx context.Context, originalJSON []byte, namespace string) ([]byte, error) {
+// evaluationErrorResponse returns the response to an admission request whose object could not be evaluated against the ModRules.
+// The request is denied if any ModRule with failurePolicy Fail may apply to the object - otherwise it is allowed.
+func (h *DragnetWebhookHandler) evaluationErrorResponse(req *admission.Request, storeNamespace string, err error, reason string) admission.Response {
+	gvk := schema.GroupVersionKind{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind}
+	failClosedModRules := h.modRuleStore.FindFailClosedModRules(v1beta1.ModRuleAdmissionOperation(req.Operation), storeNamespace, gvk)
+
+	if len(failClosedModRules) > 0 {
+		return admission.Denied(fmt.Sprintf("operation denied because the following ModRule(s) could not be evaluated: %s: %v", strings.Join(failClosedModRules, ","), err))
+	}
+
+	return admission.Allowed(reason)
+}
+
+// failuresResponse returns the response to an admission request for which ModRules with failurePolicy Fail failed to evaluate.
+func failuresResponse(report *OperationReport, log logr.Logger) admission.Response {
+	failures := make([]string, 0, len(report.Failures))
+
+	for _, failure := range report.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %s", failure.ModRule, failure.Error))
+	}
+
+	failureMessages := strings.Join(failures, ",")
+	log.Info("Denied by failed ModRule(s)", "failures", failureMessages)
+
+	return admission.Denied(fmt.Sprintf("operation denied because the following ModRule(s) failed: %s", failureMessages))
+}
+
+// withDryRunAuditAnnotation records the outcomes of dry-run ModRules in audit annotation "dryrun" of the admission response.
+func withDryRunAuditAnnotation(response admission.Response, report *OperationReport, log logr.Logger) admission.Response {
+	if len(report.DryRunResults) == 0 {
+		return response
+	}
+
+	dryRunJSON, err := json.Marshal(report.DryRunResults)
+
+	if err != nil {
+		log.Error(err, "Failed to encode dry-run results")
+		return response
+	}
+
+	if response.AuditAnnotations == nil {
+		response.AuditAnnotations = make(map[string]string)
+	}
+
+	response.AuditAnnotations["dryrun"] = string(dryRunJSON)
+
+	return response
+}
+
+// newAdmissionContext extracts the admission context of the given admission request.
+func newAdmissionContext(req *admission.Request) *admissionContext {
+	return &admissionContext{
+		UserInfo:    req.UserInfo,
+		DryRun:      req.DryRun != nil && *req.DryRun,
+		SubResource: req.SubResource,
+		Kind:        req.Kind,
+	}
+}
+
+func (h *DragnetWebhookHandler) injectSyntheticRefs(ctx context.Context, originalJSON []byte, namespace string, admissionCtx *admissionContext, oldObjectJSON []byte) ([]byte, error) {
 	obj := &unstructured.Unstructured{}
 	syntheticRefs := make(map[string]interface{})
 	var err error
@@ -141,6 +294,22 @@ func (h *DragnetWebhookHandler) injectSyntheticRefs(ctx context.Context, origina
 	// Set KubeMod syntheticRefs field.
 	obj.UnstructuredContent()["syntheticRefs"] = syntheticRefs
 
+	// Set KubeMod admission field.
+	obj.UnstructuredContent()["admission"] = admissionCtx
+
+	// Set KubeMod oldObject field for UPDATE operations.
+	if len(oldObjectJSON) > 0 {
+		oldObj := &unstructured.Unstructured{}
+		err = json.Unmarshal(oldObjectJSON, oldObj)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode webhook request old object's manifest into JSON: %v", err)
+		}
+
+		oldObj.SetManagedFields(nil)
+		obj.UnstructuredContent()["oldObject"] = oldObj.UnstructuredContent()
+	}
+
 	// Remove verbose managedFields as it is useless for the purposes of modrules,
 	// but at the same time it's quite verbose and potentially slows down modrule processing.
 	obj.SetManagedFields(nil)
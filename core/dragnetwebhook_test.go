@@ -16,6 +16,8 @@ package core
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"path"
 	"sort"
@@ -23,8 +25,11 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/kubemod/kubemod/api/v1beta1"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -123,4 +128,215 @@ var _ = Describe("DragnetWebhookHandler", func() {
 		Expect(response.Patches[1].Value).To(Equal("us-west-2b"))
 	})
 
+	It("should allow resources matched by Warn ModRules and report their messages as admission warnings", func() {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-2.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		loadModRule("warn/warn-1.yaml", "my-namespace")
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "my-namespace"}, gomock.Any()).Return(nil)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "my-namespace",
+				Operation: "CREATE",
+				Object: k8sruntime.RawExtension{
+					Raw: resourceJSON,
+				},
+			},
+		}
+
+		ctx, warnings := withAdmissionWarnings(context.Background())
+		response := handler.Handle(ctx, request)
+
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(BeEmpty())
+		Expect(*warnings).To(Equal([]string{`my-namespace/modrule-1: "Services with external IPs will soon be rejected: 123.12.34.1"`}))
+	})
+
+	It("should warn about non-idempotent patches if configured to do so", func() {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		loadModRule("patch/non-idempotent-1.yaml", "my-namespace")
+		handler.warnNonIdempotentPatches = true
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "my-namespace"}, gomock.Any()).Return(nil)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "my-namespace",
+				Operation: "CREATE",
+				Object: k8sruntime.RawExtension{
+					Raw: resourceJSON,
+				},
+			},
+		}
+
+		ctx, warnings := withAdmissionWarnings(context.Background())
+		response := handler.Handle(ctx, request)
+
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patches).To(HaveLen(1))
+		Expect(*warnings).To(Equal([]string{"the patch of the following ModRule(s) is not idempotent: my-namespace/modrule-non-idempotent"}))
+	})
+
+	DescribeTable("should match ModRules against the admission request context", func(groups []string, expectedAllowed bool) {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-2.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		loadModRule("reject/admission-1.yaml", "my-namespace")
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "my-namespace"}, gomock.Any()).Return(nil)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "my-namespace",
+				Operation: "CREATE",
+				UserInfo: authenticationv1.UserInfo{
+					Username: "jane",
+					Groups:   groups,
+				},
+				Object: k8sruntime.RawExtension{
+					Raw: resourceJSON,
+				},
+			},
+		}
+
+		response := handler.Handle(context.Background(), request)
+		Expect(response.Allowed).To(Equal(expectedAllowed))
+
+		if !expectedAllowed {
+			Expect(string(response.Result.Reason)).To(ContainSubstring(`my-namespace/modrule-1: "User jane is not allowed to create services with external IPs"`))
+		}
+	},
+		Entry("requester in group platform-admins should be allowed", []string{"developers", "platform-admins"}, true),
+		Entry("requester not in group platform-admins should be rejected", []string{"developers"}, false),
+		Entry("requester with no groups should be rejected", nil, false),
+	)
+
+	DescribeTable("should match ModRules against the old object of UPDATE requests", func(oldReplicas int, oldColor string, newColor string, expectedRejections []string) {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "deployment-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Derive both the old and the new object from the same deployment.
+		oldObj := &unstructured.Unstructured{}
+		err = json.Unmarshal(resourceJSON, oldObj)
+		Expect(err).NotTo(HaveOccurred())
+		newObj := oldObj.DeepCopy()
+
+		err = unstructured.SetNestedField(oldObj.Object, int64(oldReplicas), "spec", "replicas")
+		Expect(err).NotTo(HaveOccurred())
+		err = unstructured.SetNestedField(oldObj.Object, oldColor, "metadata", "labels", "color")
+		Expect(err).NotTo(HaveOccurred())
+		err = unstructured.SetNestedField(newObj.Object, newColor, "metadata", "labels", "color")
+		Expect(err).NotTo(HaveOccurred())
+
+		oldJSON, err := json.Marshal(oldObj)
+		Expect(err).NotTo(HaveOccurred())
+		newJSON, err := json.Marshal(newObj)
+		Expect(err).NotTo(HaveOccurred())
+
+		loadModRule("reject/old-object-1.yaml", "default")
+		loadModRule("reject/old-object-2.yaml", "default")
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "default"}, gomock.Any()).Return(nil)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "default",
+				Operation: "UPDATE",
+				Object: k8sruntime.RawExtension{
+					Raw: newJSON,
+				},
+				OldObject: k8sruntime.RawExtension{
+					Raw: oldJSON,
+				},
+			},
+		}
+
+		response := handler.Handle(context.Background(), request)
+		Expect(response.Allowed).To(Equal(len(expectedRejections) == 0))
+
+		for _, rejection := range expectedRejections {
+			Expect(string(response.Result.Reason)).To(ContainSubstring(rejection))
+		}
+	},
+		Entry("unchanged deployment should be allowed", 1, "blue", "blue", nil),
+		Entry("scaling down by half should be allowed", 2, "blue", "blue", nil),
+		Entry("scaling down by more than half should be rejected", 3, "blue", "blue", []string{`default/modrule-1: "Replicas cannot be scaled down from 3 to 1 at once"`}),
+		Entry("changing a set label should be rejected", 1, "red", "blue", []string{`default/modrule-2: "Label color cannot be changed once set"`}),
+		Entry("both violations should be reported", 4, "red", "blue", []string{"default/modrule-1", "default/modrule-2"}),
+	)
+
+	It("should allow resources matched by dry-run Reject ModRules and record the rejection in an audit annotation", func() {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-3.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		loadModRule("reject/dry-run-1.yaml", "my-namespace")
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "my-namespace"}, gomock.Any()).Return(nil)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "my-namespace",
+				Operation: "CREATE",
+				Object: k8sruntime.RawExtension{
+					Raw: resourceJSON,
+				},
+			},
+		}
+
+		response := handler.Handle(context.Background(), request)
+
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.AuditAnnotations).To(HaveKeyWithValue("dryrun", `[{"modRule":"my-namespace/modrule-dry-run","rejection":"my-namespace/modrule-dry-run: \"External IP 123.12.34.1 is not allowed\""}]`))
+	})
+
+	DescribeTable("should honor the failure policy of ModRules which cannot be evaluated", func(failurePolicy v1beta1.FailurePolicyType, namespaceErr error, expectedAllowed bool, expectedReason string) {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-2.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// The patch value template of the ModRule indexes past the end of an array and fails to execute.
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "patch/failure-policy-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Spec.FailurePolicy = failurePolicy
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		err = testBed.modRuleStore.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		testBed.mockK8sClient.EXPECT().Get(gomock.Any(), client.ObjectKey{Name: "my-namespace"}, gomock.Any()).Return(namespaceErr)
+
+		request := admission.Request{
+			AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Namespace: "my-namespace",
+				Operation: "CREATE",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Service"},
+				Object: k8sruntime.RawExtension{
+					Raw: resourceJSON,
+				},
+			},
+		}
+
+		response := handler.Handle(context.Background(), request)
+		Expect(response.Allowed).To(Equal(expectedAllowed))
+		Expect(response.Patches).To(BeEmpty())
+
+		if !expectedAllowed {
+			Expect(string(response.Result.Reason)).To(ContainSubstring(expectedReason))
+		}
+	},
+		Entry("template errors of fail-open ModRules should be ignored", v1beta1.FailurePolicyIgnore, nil, true, ""),
+		Entry("template errors of fail-closed ModRules should deny the request", v1beta1.FailurePolicyFail, nil, false, "following ModRule(s) failed: my-namespace/modrule-1"),
+		Entry("synthetic reference errors should be ignored if no fail-closed ModRules apply", v1beta1.FailurePolicyIgnore, errors.New("namespace lookup failed"), true, ""),
+		Entry("synthetic reference errors should deny the request if fail-closed ModRules apply", v1beta1.FailurePolicyFail, errors.New("namespace lookup failed"), false, "could not be evaluated: my-namespace/modrule-1: failed to inject namespace synthetic ref"),
+	)
+
 })
@@ -0,0 +1,186 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/jsonpath"
+)
+
+// EvaluationTrace explains why ModRules did or did not match an object and what they did to it.
+// Building a trace is expensive - it is only collected when an OperationReport is created with a trace.
+type EvaluationTrace struct {
+	// Tiers lists the evaluated execution tiers of each ModRule type in order of evaluation.
+	Tiers []*TierTrace `json:"tiers"`
+}
+
+// TierTrace describes the evaluation of the ModRules of a single type in a single execution tier.
+type TierTrace struct {
+	// Type is the type of the evaluated ModRules.
+	Type v1beta1.ModRuleType `json:"type"`
+
+	// ExecutionTier is the execution tier of the evaluated ModRules.
+	ExecutionTier int16 `json:"executionTier"`
+
+	// ModRules lists the ModRules considered in the execution tier.
+	ModRules []*ModRuleTrace `json:"modRules"`
+}
+
+// ModRuleTrace describes the evaluation of a single ModRule.
+type ModRuleTrace struct {
+	// ModRule is the namespace/name of the ModRule.
+	ModRule string `json:"modRule"`
+
+	// Match lists the evaluation of each match item of the ModRule.
+	Match []*MatchItemTrace `json:"match"`
+
+	// Matched indicates that all match items of the ModRule matched.
+	Matched bool `json:"matched"`
+
+	// Skipped is the reason a matching ModRule was skipped, if any.
+	Skipped string `json:"skipped,omitempty"`
+
+	// Patch is the JSON patch produced by a Patch ModRule.
+	Patch string `json:"patch,omitempty"`
+
+	// Message is the message produced by a Reject or Warn ModRule.
+	Message string `json:"message,omitempty"`
+
+	// Error is the error which occurred while evaluating the ModRule, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// MatchItemTrace describes the evaluation of a single match item.
+type MatchItemTrace struct {
+	// Select is the select query of the match item.
+	Select string `json:"select"`
+
+	// Result is the result of the select query.
+	Result interface{} `json:"result"`
+
+	// Comparison describes the comparison performed against the result of the select query.
+	Comparison string `json:"comparison"`
+
+	// Negate is the negate flag of the match item.
+	Negate bool `json:"negate"`
+
+	// Matched is the outcome of the match item.
+	Matched bool `json:"matched"`
+
+	// Error is the error which occurred while evaluating the select query, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// setError records the given error in the trace.
+// A nil *ModRuleTrace is valid and discards the error.
+func (t *ModRuleTrace) setError(err error) {
+	if t == nil {
+		return
+	}
+
+	t.Error = err.Error()
+}
+
+// setSkipped records the reason a matching ModRule was skipped in the trace.
+// A nil *ModRuleTrace is valid and discards the reason.
+func (t *ModRuleTrace) setSkipped(reason string) {
+	if t == nil {
+		return
+	}
+
+	t.Skipped = reason
+}
+
+// IsMatchWithTrace is like IsMatch, but it also records the evaluation of each match item in the given trace.
+// Unlike IsMatch, it evaluates all match items, even after the first one which does not match.
+func (si *ModRuleStoreItem) IsMatchWithTrace(jsonv interface{}, trace *ModRuleTrace) bool {
+	matched := true
+
+	for i := range si.modRule.Spec.Match {
+		itemTrace := si.traceMatch(&si.modRule.Spec.Match[i], jsonv)
+		trace.Match = append(trace.Match, itemTrace)
+		matched = matched && itemTrace.Matched
+	}
+
+	trace.Matched = matched
+
+	return matched
+}
+
+// traceMatch evaluates the given match item against the given JSON object and describes the evaluation.
+func (si *ModRuleStoreItem) traceMatch(matchItem *v1beta1.MatchItem, jsonv interface{}) *MatchItemTrace {
+	trace := &MatchItemTrace{
+		Select:     matchItem.Select,
+		Comparison: describeMatchComparison(matchItem),
+		Negate:     matchItem.Negate,
+		Matched:    si.isMatch(matchItem, jsonv),
+	}
+
+	result, err := si.compiledMatchSelects[matchItem](context.Background(), jsonv)
+
+	if err != nil {
+		trace.Error = err.Error()
+	} else {
+		trace.Result = traceableValue(result)
+	}
+
+	return trace
+}
+
+// describeMatchComparison describes the comparison the given match item performs against the result of its select query.
+func describeMatchComparison(matchItem *v1beta1.MatchItem) string {
+	quantifier := "any"
+
+	if matchItem.MatchFor == v1beta1.MatchForTypeAll {
+		quantifier = "all"
+	}
+
+	switch {
+	case matchItem.MatchValue != nil:
+		return fmt.Sprintf("%s of the results equal %q", quantifier, *matchItem.MatchValue)
+
+	case len(matchItem.MatchValues) > 0:
+		return fmt.Sprintf("%s of the results equal one of %q", quantifier, matchItem.MatchValues)
+
+	case matchItem.MatchRegex != nil:
+		return fmt.Sprintf("%s of the results match regex %q", quantifier, *matchItem.MatchRegex)
+
+	default:
+		return "the result is true or a non-empty value"
+	}
+}
+
+// traceableValue replaces the undefined values in the given select query result with nil in order to make it serializable.
+func traceableValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case jsonpath.UndefinedType:
+		return nil
+
+	case []interface{}:
+		values := make([]interface{}, len(v))
+
+		for i := range v {
+			values[i] = traceableValue(v[i])
+		}
+
+		return values
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	evanjsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	ctrljsonpatch "gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// mergePatchToJSONPatch applies the given merge patch against the original JSON document
+// and returns the JSON patch operations which transform the original document into the merged one.
+// Operation type "merge" is an RFC 7386 JSON merge patch, while operation type "strategic" is a Kubernetes strategic merge patch.
+func mergePatchToJSONPatch(op v1beta1.PatchOperationType, originalJSON []byte, patchJSON []byte) ([]ctrljsonpatch.JsonPatchOperation, error) {
+	var mergedJSON []byte
+	var err error
+
+	switch op {
+	case v1beta1.Merge:
+		mergedJSON, err = evanjsonpatch.MergePatch(originalJSON, patchJSON)
+
+	case v1beta1.StrategicMerge:
+		var dataStruct interface{}
+		dataStruct, err = strategicMergeDataStruct(originalJSON)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mergedJSON, err = strategicpatch.StrategicMergePatch(originalJSON, patchJSON, dataStruct)
+
+	default:
+		return nil, fmt.Errorf("unsupported merge patch operation type \"%v\"", op)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ctrljsonpatch.CreatePatch(originalJSON, mergedJSON)
+}
+
+// strategicMergeDataStruct returns an empty typed object of the kind of the given JSON document.
+// Strategic merge patches rely on the patch strategy annotations of the typed object, hence they are
+// only supported for the built-in Kubernetes kinds.
+func strategicMergeDataStruct(originalJSON []byte) (interface{}, error) {
+	typeMeta := struct {
+		APIVersion string `json:"apiVersion"`
+		Kind       string `json:"kind"`
+	}{}
+
+	if err := json.Unmarshal(originalJSON, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	gvk := schema.FromAPIVersionAndKind(typeMeta.APIVersion, typeMeta.Kind)
+	obj, err := scheme.Scheme.New(gvk)
+
+	if err != nil {
+		return nil, fmt.Errorf("strategic merge patch is not supported for kind \"%v\" - use a merge patch instead: %v", gvk, err)
+	}
+
+	return obj, nil
+}
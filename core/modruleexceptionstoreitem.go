@@ -0,0 +1,56 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	"github.com/kubemod/kubemod/api/v1beta1"
+)
+
+// modRuleExceptionStoreItem wraps around a ModRuleException and holds its match queries in compiled form.
+type modRuleExceptionStoreItem struct {
+	exception *v1beta1.ModRuleException
+	// matcher is the store item of a ModRule with the match items of the exception.
+	// It is used to evaluate the match items of the exception against objects.
+	matcher *ModRuleStoreItem
+}
+
+// newModRuleExceptionStoreItem constructs a new ModRuleException store item.
+func (f *ModRuleStoreItemFactory) newModRuleExceptionStoreItem(exception *v1beta1.ModRuleException) (*modRuleExceptionStoreItem, error) {
+	matcher, err := f.NewModRuleStoreItem(&v1beta1.ModRule{
+		ObjectMeta: exception.ObjectMeta,
+		Spec: v1beta1.ModRuleSpec{
+			Match: exception.Spec.Match,
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &modRuleExceptionStoreItem{
+			exception: exception,
+			matcher:   matcher,
+		},
+		nil
+}
+
+// waives returns true if the exception is in effect at the given time and waives the given ModRule for the given object.
+func (ei *modRuleExceptionStoreItem) waives(modRule *v1beta1.ModRule, jsonv interface{}, now time.Time) bool {
+	return !ei.exception.IsExpired(now) &&
+		ei.exception.Waives(modRule.Namespace, modRule.Name) &&
+		ei.matcher.IsMatch(jsonv)
+}
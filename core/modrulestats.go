@@ -0,0 +1,103 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ModRuleStatsDelta holds the runtime statistics collected for a single ModRule since they were last drained.
+type ModRuleStatsDelta struct {
+	// Matched is the number of admissions the ModRule matched.
+	Matched int64
+
+	// Patched is the number of admissions the ModRule produced a non-empty patch for.
+	Patched int64
+
+	// Rejected is the number of admissions the ModRule rejected.
+	Rejected int64
+
+	// Errors is the number of runtime errors encountered while evaluating the ModRule.
+	Errors int64
+
+	// DryRunPatched is the number of admissions a dry-run ModRule would have patched.
+	DryRunPatched int64
+
+	// DryRunRejected is the number of admissions a dry-run ModRule would have rejected.
+	DryRunRejected int64
+
+	// LastMatchTime is the time of the last admission the ModRule matched.
+	LastMatchTime time.Time
+}
+
+// modRuleStatsCollector is a thread-safe accumulator of ModRule runtime statistics.
+type modRuleStatsCollector struct {
+	deltas map[types.NamespacedName]*ModRuleStatsDelta
+	lock   sync.Mutex
+}
+
+func newModRuleStatsCollector() *modRuleStatsCollector {
+	return &modRuleStatsCollector{
+		deltas: make(map[types.NamespacedName]*ModRuleStatsDelta),
+	}
+}
+
+// record merges the given delta into the statistics collected for the given ModRule.
+func (c *modRuleStatsCollector) record(key types.NamespacedName, delta ModRuleStatsDelta) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	existing, ok := c.deltas[key]
+
+	if !ok {
+		existing = &ModRuleStatsDelta{}
+		c.deltas[key] = existing
+	}
+
+	existing.Add(delta)
+}
+
+// drain returns all statistics collected so far and resets the collector.
+func (c *modRuleStatsCollector) drain() map[types.NamespacedName]ModRuleStatsDelta {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ret := make(map[types.NamespacedName]ModRuleStatsDelta, len(c.deltas))
+
+	for key, delta := range c.deltas {
+		ret[key] = *delta
+	}
+
+	c.deltas = make(map[types.NamespacedName]*ModRuleStatsDelta)
+
+	return ret
+}
+
+// Add merges the given delta into the receiver.
+func (d *ModRuleStatsDelta) Add(other ModRuleStatsDelta) {
+	d.Matched += other.Matched
+	d.Patched += other.Patched
+	d.Rejected += other.Rejected
+	d.Errors += other.Errors
+	d.DryRunPatched += other.DryRunPatched
+	d.DryRunRejected += other.DryRunRejected
+
+	if other.LastMatchTime.After(d.LastMatchTime) {
+		d.LastMatchTime = other.LastMatchTime
+	}
+}
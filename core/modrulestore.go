@@ -21,33 +21,55 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	evanjsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-logr/logr"
 	"github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/pkg/errors"
 	ctrljsonpatch "gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // ClusterModRulesNamespace is a type of string used by DI to inject the namespace where cluster-wide ModRules are deployed.
 type ClusterModRulesNamespace string
 
 // ModRuleStore is a thread-safe collection of ModRules organized by namespaces.
+// Reads are lock-free - they evaluate an immutable snapshot of the store which writers replace atomically.
 type ModRuleStore struct {
-	modRuleListMap           map[string][]*ModRuleStoreItem
+	snapshot                 atomic.Value // *modRuleStoreSnapshot
 	itemFactory              *ModRuleStoreItemFactory
 	clusterModRulesNamespace string
-	rwLock                   sync.RWMutex
+	namespaceLabelCache      *NamespaceLabelCache
+	writeLock                sync.Mutex
+	stats                    *modRuleStatsCollector
 	log                      logr.Logger
 }
 
-// Custom type used to sort ModRuleStoreItem slices by ExecutionTier.
-type ByExecutionTier []*ModRuleStoreItem
+// Custom type used to sort ModRuleStoreItem slices in execution order:
+// by ExecutionTier, then by Priority, then by namespace, then by name.
+// The namespace/name pair is unique, hence the order is total and does not depend on the order in which the ModRules were stored.
+type ByExecutionOrder []*ModRuleStoreItem
 
-func (a ByExecutionTier) Len() int { return len(a) }
-func (a ByExecutionTier) Less(i, j int) bool {
-	return a[i].modRule.Spec.ExecutionTier < a[j].modRule.Spec.ExecutionTier
+func (a ByExecutionOrder) Len() int { return len(a) }
+func (a ByExecutionOrder) Less(i, j int) bool {
+	left, right := a[i].modRule, a[j].modRule
+
+	if left.Spec.ExecutionTier != right.Spec.ExecutionTier {
+		return left.Spec.ExecutionTier < right.Spec.ExecutionTier
+	}
+	if left.Spec.Priority != right.Spec.Priority {
+		return left.Spec.Priority < right.Spec.Priority
+	}
+	if left.Namespace != right.Namespace {
+		return left.Namespace < right.Namespace
+	}
+	return left.Name < right.Name
 }
-func (a ByExecutionTier) Swap(i, j int) {
+func (a ByExecutionOrder) Swap(i, j int) {
 	a[i], a[j] = a[j], a[i]
 }
 
@@ -61,91 +83,185 @@ var (
 )
 
 // NewModRuleStore instantiates a new ModRuleStore.
-func NewModRuleStore(itemFactory *ModRuleStoreItemFactory, clusterModRulesNamespace ClusterModRulesNamespace, log logr.Logger) *ModRuleStore {
-	return &ModRuleStore{
-		modRuleListMap:           make(map[string][]*ModRuleStoreItem),
+func NewModRuleStore(itemFactory *ModRuleStoreItemFactory, clusterModRulesNamespace ClusterModRulesNamespace, namespaceLabelCache *NamespaceLabelCache, log logr.Logger) *ModRuleStore {
+	s := &ModRuleStore{
 		itemFactory:              itemFactory,
 		clusterModRulesNamespace: string(clusterModRulesNamespace),
-		rwLock:                   sync.RWMutex{},
+		namespaceLabelCache:      namespaceLabelCache,
+		writeLock:                sync.Mutex{},
+		stats:                    newModRuleStatsCollector(),
 		log:                      log.WithName("core"),
 	}
+
+	s.snapshot.Store(newModRuleStoreSnapshot())
+
+	return s
+}
+
+// currentSnapshot returns the latest published snapshot of the store.
+// The snapshot must not be modified.
+func (s *ModRuleStore) currentSnapshot() *modRuleStoreSnapshot {
+	return s.snapshot.Load().(*modRuleStoreSnapshot)
 }
 
 // Put adds or updates a mod rule to the rule set.
 // ModRules are identified by their namespace/name pair.
+// Cluster-scoped ModRules (ModRules with an empty namespace) are stored alongside the ModRules deployed to the cluster-wide namespace.
 func (s *ModRuleStore) Put(modRule *v1beta1.ModRule) error {
-	var namespace = modRule.Namespace
-	var namespaceModRules []*ModRuleStoreItem
-	var existingModRuleIndex int
-	var ok bool
-
-	s.rwLock.Lock()
-	defer s.rwLock.Unlock()
+	var namespace = s.storeNamespace(modRule.Namespace)
 
-	if namespaceModRules, ok = s.modRuleListMap[namespace]; !ok {
-		// This is the first time we see this namespace - create the namespaced slice of modrules.
-		namespaceModRules = []*ModRuleStoreItem{}
-		s.modRuleListMap[namespace] = namespaceModRules
-		// Short-circuit the call to findModRuleIndexByName - we know the new modrule has never been added to the set before.
-		existingModRuleIndex = -1
-	} else {
-		// This modrule may have been added to the namespace slice before.
-		// Find its index.
-		existingModRuleIndex = findItemIndexByName(namespaceModRules, modRule.Name)
-	}
-
-	// Instantiate a store item.
+	// Instantiate a store item - this is done before taking the write lock since compiling a ModRule may be expensive.
 	modRuleStoreItem, err := s.itemFactory.NewModRuleStoreItem(modRule)
 
 	if err != nil {
 		return fmt.Errorf("failed to add ModRule to ModRuleStore: %v", err)
 	}
 
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	current := s.currentSnapshot()
+
+	// The slice of the current snapshot may be in use by concurrent readers - build the new list in a copy of it.
+	namespaceModRules := make([]*ModRuleStoreItem, len(current.modRuleListMap[namespace]), len(current.modRuleListMap[namespace])+1)
+	copy(namespaceModRules, current.modRuleListMap[namespace])
+
 	// If a modrule exists with the same name, replace it, otherwise append to the list.
-	if existingModRuleIndex != -1 {
-		s.modRuleListMap[namespace][existingModRuleIndex] = modRuleStoreItem
+	if existingModRuleIndex := findItemIndexByName(namespaceModRules, modRule.Namespace, modRule.Name); existingModRuleIndex != -1 {
+		namespaceModRules[existingModRuleIndex] = modRuleStoreItem
 	} else {
-		s.modRuleListMap[namespace] = append(namespaceModRules, modRuleStoreItem)
+		namespaceModRules = append(namespaceModRules, modRuleStoreItem)
 	}
 
-	// Sort the modrules by execution tier - this will help relieve pressure on getMatchingModRuleStoreItems.
-	sort.Sort(ByExecutionTier(s.modRuleListMap[namespace]))
+	// Sort the modrules in execution order - this will help relieve pressure on getMatchingModRuleStoreItems.
+	sort.Sort(ByExecutionOrder(namespaceModRules))
+
+	// Publish a new snapshot with a rebuilt target index of the namespace.
+	next := current.withNamespaceModRules(namespace, namespaceModRules)
+	s.snapshot.Store(next)
+
+	// Rules in the same execution tier and with the same priority run in namespace/name order - warn about the ones which write to the same paths.
+	for _, conflict := range s.findPatchConflicts(next, modRule, modRuleStoreItem.writePaths) {
+		s.log.Info("ModRule patch conflicts with another ModRule in the same execution tier", "rule", conflict.ModRule, "path", conflict.Path, "conflicting rule", conflict.ConflictingModRule, "conflicting path", conflict.ConflictingPath)
+	}
 
 	return nil
 }
 
 // Delete removes a modrule from the set.
-func (s *ModRuleStore) Delete(namespace string, name string) {
-	s.rwLock.Lock()
-	defer s.rwLock.Unlock()
-
-	if namespaceModRules, ok := s.modRuleListMap[namespace]; ok {
-		if modRuleIndex := findItemIndexByName(namespaceModRules, name); modRuleIndex != -1 {
-			// Fast delete - breaks the order of elements, but avoids copying the slice.
-			// Copy last element into the slot of the one we are deleting, then truncate 1 element from the tail of the slice.
-			namespaceModRules[modRuleIndex] = namespaceModRules[len(namespaceModRules)-1]
-			namespaceModRules[len(namespaceModRules)-1] = nil
-			namespaceModRules = namespaceModRules[:len(namespaceModRules)-1]
-
-			// If the resulting list of modrules is empty, remove the namespace from the map,
-			// otherwise, update the namespace in the map with the new list.
-			if len(namespaceModRules) == 0 {
-				delete(s.modRuleListMap, namespace)
-			} else {
-				s.modRuleListMap[namespace] = namespaceModRules
+// Cluster-scoped ModRules are deleted by passing an empty namespace.
+func (s *ModRuleStore) Delete(modRuleNamespace string, name string) {
+	var namespace = s.storeNamespace(modRuleNamespace)
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	current := s.currentSnapshot()
+	currentModRules := current.modRuleListMap[namespace]
+
+	if modRuleIndex := findItemIndexByName(currentModRules, modRuleNamespace, name); modRuleIndex != -1 {
+		// Build the new list in a new slice to preserve the current snapshot and the execution order of the remaining modrules.
+		namespaceModRules := make([]*ModRuleStoreItem, 0, len(currentModRules)-1)
+		namespaceModRules = append(namespaceModRules, currentModRules[:modRuleIndex]...)
+		namespaceModRules = append(namespaceModRules, currentModRules[modRuleIndex+1:]...)
+
+		// If the resulting list of modrules is empty, the namespace is removed from the new snapshot.
+		s.snapshot.Store(current.withNamespaceModRules(namespace, namespaceModRules))
+	}
+}
+
+// PutException adds or updates a ModRuleException.
+// ModRuleExceptions are identified by their namespace/name pair.
+func (s *ModRuleStore) PutException(exception *v1beta1.ModRuleException) error {
+	exceptionStoreItem, err := s.itemFactory.newModRuleExceptionStoreItem(exception)
+
+	if err != nil {
+		return fmt.Errorf("failed to add ModRuleException to ModRuleStore: %v", err)
+	}
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	current := s.currentSnapshot()
+
+	// The slice of the current snapshot may be in use by concurrent readers - build the new list in a copy of it.
+	namespaceExceptions := make([]*modRuleExceptionStoreItem, len(current.exceptionListMap[exception.Namespace]), len(current.exceptionListMap[exception.Namespace])+1)
+	copy(namespaceExceptions, current.exceptionListMap[exception.Namespace])
+
+	exceptionIndex := -1
+
+	for i, ei := range namespaceExceptions {
+		if ei.exception.Name == exception.Name {
+			exceptionIndex = i
+			break
+		}
+	}
+
+	if exceptionIndex != -1 {
+		namespaceExceptions[exceptionIndex] = exceptionStoreItem
+	} else {
+		namespaceExceptions = append(namespaceExceptions, exceptionStoreItem)
+	}
+
+	s.snapshot.Store(current.withNamespaceExceptions(exception.Namespace, namespaceExceptions))
+
+	return nil
+}
+
+// DeleteException removes a ModRuleException from the store.
+func (s *ModRuleStore) DeleteException(namespace string, name string) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	current := s.currentSnapshot()
+	currentExceptions := current.exceptionListMap[namespace]
+
+	for i, ei := range currentExceptions {
+		if ei.exception.Name == name {
+			// Build the new list in a new slice to preserve the current snapshot.
+			namespaceExceptions := make([]*modRuleExceptionStoreItem, 0, len(currentExceptions)-1)
+			namespaceExceptions = append(namespaceExceptions, currentExceptions[:i]...)
+			namespaceExceptions = append(namespaceExceptions, currentExceptions[i+1:]...)
+
+			// If the resulting list of exceptions is empty, the namespace is removed from the new snapshot.
+			s.snapshot.Store(current.withNamespaceExceptions(namespace, namespaceExceptions))
+			return
+		}
+	}
+}
+
+// findWaivingException returns the first ModRuleException in effect which waives the given ModRule for the given object deployed to the given namespace
+// or nil if no such exception is found.
+// Exceptions deployed to the object's namespace and to the cluster-wide namespace are considered.
+// The exceptions are looked up in the given snapshot of the store.
+func (s *ModRuleStore) findWaivingException(snapshot *modRuleStoreSnapshot, mrsi *ModRuleStoreItem, namespace string, jsonv interface{}, now time.Time) *modRuleExceptionStoreItem {
+	namespaces := []string{s.clusterModRulesNamespace}
+
+	if namespace != "" && namespace != s.clusterModRulesNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+
+	for _, ns := range namespaces {
+		for _, ei := range snapshot.exceptionListMap[ns] {
+			if ei.waives(mrsi.modRule, jsonv, now) {
+				return ei
 			}
 		}
 	}
+
+	return nil
 }
 
 // getMatchingModRuleStoreItems returns a slice with all the mod rules which match the given unmarshalled JSON.
 // It also returns the execution tier of the returned modrules, or math.MaxInt16 in case no modrules were found in a tier higher than minExecutionTier.
-func (s *ModRuleStore) getMatchingModRuleStoreItems(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, minExecutionTier int16, modRuleType v1beta1.ModRuleType, jsonv interface{}) (modRules []*ModRuleStoreItem, currentExecutionTier int16) {
+// ModRules skipped by their exclude block or waived by a ModRuleException are logged and recorded in the given operation report.
+// The ModRules are looked up in the given snapshot of the store, which allows callers to evaluate all execution tiers against a consistent view.
+func (s *ModRuleStore) getMatchingModRuleStoreItems(snapshot *modRuleStoreSnapshot, admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, minExecutionTier int16, modRuleType v1beta1.ModRuleType, jsonv interface{}, report *OperationReport, log logr.Logger) (modRules []*ModRuleStoreItem, currentExecutionTier int16) {
 	currentExecutionTier = math.MaxInt16
 	var potentialRules []*ModRuleStoreItem
 
-	s.rwLock.RLock()
-	defer s.rwLock.RUnlock()
+	// Only ModRules with no targets or with a target matching the object's group/version/kind are considered.
+	gvk := groupVersionKindFromJSONObject(jsonv)
 
 	processPotentialRule := func(mrsi *ModRuleStoreItem) {
 
@@ -173,40 +289,127 @@ func (s *ModRuleStore) getMatchingModRuleStoreItems(admissionOperation v1beta1.M
 		}
 	}
 
+	// The labels of the resource's namespace are used to evaluate the namespace selectors of cluster-wide mod rules.
+	var namespaceLabels labels.Set
+	if namespace != "" {
+		namespaceLabels = s.namespaceLabelCache.Get(namespace)
+	}
+
 	// First look at cluster-wide mod rules.
 	// If the resource is a non-namespaced object (its namespace is empty),
-	// or the resource's namespace matches the mod rule's TargetNamespaceRegex,
+	// or the resource's namespace matches the mod rule's TargetNamespaceRegex and TargetNamespaceSelector,
 	// then the mod rule is a potential match and subject to further examination by the heavier .IsMatch().
-	for _, mrsi := range s.modRuleListMap[s.clusterModRulesNamespace] {
-		if mrsi.modRule.Spec.ExecutionTier >= minExecutionTier &&
-			((namespace == "" && mrsi.compiledTargetNamespaceRegex == nil) ||
-				(mrsi.compiledTargetNamespaceRegex != nil && mrsi.compiledTargetNamespaceRegex.Match([]byte(namespace)))) {
-
+	snapshot.targetIndexMap[s.clusterModRulesNamespace].forEachCandidate(gvk, func(mrsi *ModRuleStoreItem) {
+		if mrsi.modRule.Spec.ExecutionTier >= minExecutionTier && mrsi.isNamespaceMatch(namespace, namespaceLabels) {
 			processPotentialRule(mrsi)
-
 		}
-	}
+	})
 
 	// If the resource is namespaced, add the mod rules deployed to that same namespace to the list of potentially matching mod rules.
 	// Make sure to add only rules with an execution tier higher or equal to the min required execution tier.
+	// Cluster-scoped ModRules share the store namespace of the cluster-wide namespace, but they are not deployed to it - skip them.
 	if namespace != "" {
-		for _, mrsi := range s.modRuleListMap[namespace] {
-			if mrsi.modRule.Spec.ExecutionTier >= minExecutionTier {
+		snapshot.targetIndexMap[namespace].forEachCandidate(gvk, func(mrsi *ModRuleStoreItem) {
+			if mrsi.modRule.Spec.ExecutionTier >= minExecutionTier && mrsi.modRule.Namespace != "" {
 				processPotentialRule(mrsi)
 			}
-		}
+		})
 	}
 
+	// The potential rules are gathered from both cluster-wide and namespaced mod rules - merge them in execution order.
+	sort.Sort(ByExecutionOrder(potentialRules))
+
 	// Perform the actual matching.
+	now := time.Now()
+
+	// When tracing, record every ModRule of the requested type considered in this execution tier.
+	var tierTrace *TierTrace
+	if report.isTracing() {
+		tierTrace = &TierTrace{Type: modRuleType, ExecutionTier: currentExecutionTier}
+	}
+
 	for _, mrsi := range potentialRules {
-		if mrsi.modRule.Spec.Type == modRuleType && mrsi.IsMatch(jsonv) {
-			modRules = append(modRules, mrsi)
+		if mrsi.modRule.Spec.Type != modRuleType {
+			continue
 		}
+
+		var modRuleTrace *ModRuleTrace
+		var matched bool
+
+		if tierTrace != nil {
+			modRuleTrace = &ModRuleTrace{ModRule: mrsi.modRule.GetNamespacedName()}
+			tierTrace.ModRules = append(tierTrace.ModRules, modRuleTrace)
+			matched = mrsi.IsMatchWithTrace(jsonv, modRuleTrace)
+		} else {
+			matched = mrsi.IsMatch(jsonv)
+		}
+
+		if !matched {
+			continue
+		}
+
+		// Skip the rule if the exclude block hits.
+		if reason := mrsi.exclusionReason(namespace, jsonv); reason != "" {
+			log.V(1).Info("ModRule skipped by its exclude block", "rule", mrsi.modRule.GetNamespacedName(), "reason", reason)
+			report.addExclusion(ExclusionResult{ModRule: mrsi.modRule.GetNamespacedName(), Reason: reason})
+			modRuleTrace.setSkipped(reason)
+			continue
+		}
+
+		// Skip the rule if it is waived by a ModRuleException.
+		if ei := s.findWaivingException(snapshot, mrsi, namespace, jsonv, now); ei != nil {
+			reason := fmt.Sprintf("waived by ModRuleException %s", ei.exception.GetNamespacedName())
+			log.V(1).Info("ModRule waived by ModRuleException", "rule", mrsi.modRule.GetNamespacedName(), "exception", ei.exception.GetNamespacedName())
+			report.addExclusion(ExclusionResult{ModRule: mrsi.modRule.GetNamespacedName(), Reason: reason})
+			modRuleTrace.setSkipped(reason)
+			continue
+		}
+
+		modRules = append(modRules, mrsi)
+	}
+
+	if tierTrace != nil && len(tierTrace.ModRules) > 0 {
+		report.addTierTrace(tierTrace)
 	}
 
 	return
 }
 
+// FindFailClosedModRules returns the namespace/name of the enforced ModRules with failurePolicy Fail which may apply
+// to an object of the given group/version/kind admitted to the given namespace.
+// The match section of the ModRules is not evaluated - this is meant for objects which cannot be evaluated at all.
+func (s *ModRuleStore) FindFailClosedModRules(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, gvk schema.GroupVersionKind) []string {
+	names := []string{}
+	snapshot := s.currentSnapshot()
+
+	collect := func(mrsi *ModRuleStoreItem) {
+		if mrsi.modRule.FailsClosed() && !mrsi.modRule.IsDryRun() && mrsi.modRule.Spec.HasAdmissionOperation(admissionOperation) {
+			names = append(names, mrsi.modRule.GetNamespacedName())
+		}
+	}
+
+	var namespaceLabels labels.Set
+	if namespace != "" {
+		namespaceLabels = s.namespaceLabelCache.Get(namespace)
+	}
+
+	snapshot.targetIndexMap[s.clusterModRulesNamespace].forEachCandidate(gvk, func(mrsi *ModRuleStoreItem) {
+		if mrsi.isNamespaceMatch(namespace, namespaceLabels) {
+			collect(mrsi)
+		}
+	})
+
+	if namespace != "" {
+		snapshot.targetIndexMap[namespace].forEachCandidate(gvk, func(mrsi *ModRuleStoreItem) {
+			if mrsi.modRule.Namespace != "" {
+				collect(mrsi)
+			}
+		})
+	}
+
+	return names
+}
+
 // Extract the value of a JSON-unmarshalled object pointed at by a colon-separated path.
 func getValueFromJSONObject(jsonv interface{}, path string) interface{} {
 	pathComponents := strings.Split(path, ":")
@@ -235,6 +438,11 @@ func getValueFromJSONObject(jsonv interface{}, path string) interface{} {
 	return nil
 }
 
+// isPatchTestFailure returns true if the given patch application error was caused by a failed "test" operation.
+func isPatchTestFailure(err error) bool {
+	return err != nil && errors.Cause(err) == evanjsonpatch.ErrTestFailed
+}
+
 // Given an unmarshalled JSON, extractLastAppliedConfiguration looks for annotation kubectl.kubernetes.io/last-applied-configuration
 // and if it exists, it returns its value, otherwise it returns nil.
 func extractLastAppliedConfiguration(jsonv interface{}) []byte {
@@ -251,7 +459,8 @@ func extractLastAppliedConfiguration(jsonv interface{}) []byte {
 
 // CalculatePatch calculates the set of patch operations to apply against a given resource
 // based on the ModRules matching the resource.
-func (s *ModRuleStore) CalculatePatch(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, originalJSON []byte, operationLog logr.Logger) (interface{}, []ctrljsonpatch.JsonPatchOperation, error) {
+// The patches of dry-run ModRules are not applied - they are recorded in the given operation report instead.
+func (s *ModRuleStore) CalculatePatch(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, originalJSON []byte, report *OperationReport, operationLog logr.Logger) (interface{}, []ctrljsonpatch.JsonPatchOperation, error) {
 	var modifiedJSON = originalJSON
 	jsonv := interface{}(nil)
 	var currentExecutionTier int16 = math.MinInt16
@@ -277,35 +486,81 @@ func (s *ModRuleStore) CalculatePatch(admissionOperation v1beta1.ModRuleAdmissio
 	templateContext := PatchTemplateContext{
 		Namespace: namespace,
 		Target:    &jsonv,
+		Admission: getValueFromJSONObject(jsonv, "admission"),
+		OldObject: getValueFromJSONObject(jsonv, "oldObject"),
 	}
 
+	// Evaluate all execution tiers against the same snapshot of the store, even if ModRules are modified in the meantime.
+	snapshot := s.currentSnapshot()
+
 	for {
 		// Find all matching Patch rules for the first execution tier higher than the previous execution tier.
-		matchingModRules, currentExecutionTier = s.getMatchingModRuleStoreItems(admissionOperation, namespace, currentExecutionTier+1, v1beta1.ModRuleTypePatch, jsonv)
+		matchingModRules, currentExecutionTier = s.getMatchingModRuleStoreItems(snapshot, admissionOperation, namespace, currentExecutionTier+1, v1beta1.ModRuleTypePatch, jsonv, report, log)
 
 		// No rules matching execution tier higher than the latest execution tier were found - break out of here.
 		if currentExecutionTier == math.MaxInt16 {
 			break
 		}
 
+		// The paths written by the rules applied in this execution tier so far.
+		var tierWrites []patchWrites
+
 		// Apply the patches of each matching rule.
 		for _, mrsi := range matchingModRules {
-			epatch, err := mrsi.calculatePatch(&templateContext, jsonv, operationLog)
+			s.recordStats(mrsi, ModRuleStatsDelta{Matched: 1, LastMatchTime: time.Now()}, report)
+			modRuleTrace := report.modRuleTrace(mrsi)
+
+			epatch, err := mrsi.calculatePatch(&templateContext, jsonv, modRuleTrace, operationLog)
 
 			// If an error occurred while calculating the patch for a ModRule, simply log it and continue to the next one.
 			if err != nil {
 				log.Error(err, "failed calculating patch for ModRule", "rule", mrsi.modRule.GetNamespacedName())
+				s.recordError(mrsi, err, report)
+				modRuleTrace.setError(err)
 				continue
 			}
 
-			modifiedJSON, err = epatch.ApplyWithOptions(modifiedJSON, jsonPatchApplyOptions)
+			// Dry-run ModRules only record the patch they would have applied.
+			if mrsi.modRule.IsDryRun() {
+				if len(epatch) > 0 {
+					s.recordDryRunPatch(mrsi, epatch, report, log)
+				}
+				continue
+			}
+
+			patchedJSON, err := epatch.ApplyWithOptions(modifiedJSON, jsonPatchApplyOptions)
+
+			// A failed test operation means the ModRule's precondition no longer holds - skip the whole patch.
+			if isPatchTestFailure(err) {
+				log.V(1).Info("ModRule patch test operation failed, skipping patch", "rule", mrsi.modRule.GetNamespacedName(), "reason", err.Error())
+				modRuleTrace.setSkipped(fmt.Sprintf("patch test operation failed: %v", err))
+				continue
+			}
 
 			// If an error occurred while applying the patch for a ModRule, simply log it and continue to the next one.
 			if err != nil {
 				log.Error(err, "failed applying patch for ModRule", "rule", mrsi.modRule.GetNamespacedName())
+				s.recordError(mrsi, err, report)
+				modRuleTrace.setError(err)
 				continue
 			}
 
+			// Rules in the same execution tier and with the same priority run in namespace/name order - detect the ones which write to the same paths.
+			writePaths := writePathsFromPatch(epatch)
+			s.detectPatchConflicts(mrsi, writePaths, tierWrites, report, log)
+			tierWrites = append(tierWrites, patchWrites{mrsi: mrsi, paths: writePaths})
+
+			// While checking idempotency, note the ModRules which still change the object.
+			if report.isIdempotencyCheck() && !evanjsonpatch.Equal(modifiedJSON, patchedJSON) {
+				report.addChange(mrsi.modRule.GetNamespacedName())
+			}
+
+			modifiedJSON = patchedJSON
+
+			if len(epatch) > 0 {
+				s.recordStats(mrsi, ModRuleStatsDelta{Patched: 1}, report)
+			}
+
 			err = json.Unmarshal(modifiedJSON, &jsonv)
 
 			if err != nil {
@@ -314,11 +569,20 @@ func (s *ModRuleStore) CalculatePatch(admissionOperation v1beta1.ModRuleAdmissio
 
 			// Apply the same patch to the kubectl last-applied-configuration annotation.
 			if lastAppliedConfigurationJSON != nil {
-				lastAppliedConfigurationJSON, err = epatch.ApplyWithOptions(lastAppliedConfigurationJSON, jsonPatchApplyOptions)
+				patchedLastAppliedConfigurationJSON, err := epatch.ApplyWithOptions(lastAppliedConfigurationJSON, jsonPatchApplyOptions)
+
+				switch {
+				// The last-applied-configuration may legitimately not satisfy the test operations the object satisfied.
+				case isPatchTestFailure(err):
+					log.V(1).Info("ModRule patch test operation failed against last-applied-configuration annotation", "rule", mrsi.modRule.GetNamespacedName(), "reason", err.Error())
 
 				// If an error occurred while applying the patch for a ModRule, simply log it and continue to the next one.
-				if err != nil {
+				case err != nil:
 					log.Error(err, "failed applying patch for ModRule to last-applied-configuration annotation", "rule", mrsi.modRule.GetNamespacedName())
+					s.recordError(mrsi, err, report)
+
+				default:
+					lastAppliedConfigurationJSON = patchedLastAppliedConfigurationJSON
 				}
 			}
 		}
@@ -345,11 +609,247 @@ func (s *ModRuleStore) CalculatePatch(admissionOperation v1beta1.ModRuleAdmissio
 	return jsonv, ops, nil
 }
 
+// CalculateModRulePatch calculates the set of patch operations which the given Patch ModRule alone applies against a given resource.
+// The other ModRules matching the resource are not applied and no runtime statistics are recorded.
+// The patch of a dry-run ModRule is returned just like the patch of an enforced one.
+// The patch is empty if the ModRule does not match the resource, is excluded or waived for it, or does not change it.
+// Cluster-scoped ModRules are identified by an empty modRuleNamespace.
+func (s *ModRuleStore) CalculateModRulePatch(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, modRuleNamespace string, name string, originalJSON []byte, operationLog logr.Logger) ([]ctrljsonpatch.JsonPatchOperation, error) {
+	var log logr.Logger
+
+	if operationLog != nil {
+		log = operationLog.WithName("core")
+	} else {
+		log = s.log
+	}
+
+	jsonv := interface{}(nil)
+
+	if err := json.Unmarshal(originalJSON, &jsonv); err != nil {
+		return nil, err
+	}
+
+	snapshot := s.currentSnapshot()
+	storeNamespace := s.storeNamespace(modRuleNamespace)
+
+	// Only look for the ModRule among the ones targeting the resource's group/version/kind.
+	var mrsi *ModRuleStoreItem
+	snapshot.targetIndexMap[storeNamespace].forEachCandidate(groupVersionKindFromJSONObject(jsonv), func(candidate *ModRuleStoreItem) {
+		if candidate.modRule.Namespace == modRuleNamespace && candidate.modRule.Name == name {
+			mrsi = candidate
+		}
+	})
+
+	if mrsi == nil || mrsi.modRule.Spec.Type != v1beta1.ModRuleTypePatch || !mrsi.modRule.Spec.HasAdmissionOperation(admissionOperation) {
+		return nil, nil
+	}
+
+	// Apply the same namespace rules as getMatchingModRuleStoreItems.
+	var namespaceLabels labels.Set
+	if namespace != "" {
+		namespaceLabels = s.namespaceLabelCache.Get(namespace)
+	}
+
+	clusterWideMatch := storeNamespace == s.clusterModRulesNamespace && mrsi.isNamespaceMatch(namespace, namespaceLabels)
+	namespacedMatch := namespace != "" && namespace == storeNamespace && modRuleNamespace != ""
+
+	if !clusterWideMatch && !namespacedMatch {
+		return nil, nil
+	}
+
+	if !mrsi.IsMatch(jsonv) {
+		return nil, nil
+	}
+
+	if reason := mrsi.exclusionReason(namespace, jsonv); reason != "" {
+		log.V(1).Info("ModRule skipped by its exclude block", "rule", mrsi.modRule.GetNamespacedName(), "reason", reason)
+		return nil, nil
+	}
+
+	if ei := s.findWaivingException(snapshot, mrsi, namespace, jsonv, time.Now()); ei != nil {
+		log.V(1).Info("ModRule waived by ModRuleException", "rule", mrsi.modRule.GetNamespacedName(), "exception", ei.exception.GetNamespacedName())
+		return nil, nil
+	}
+
+	templateContext := PatchTemplateContext{
+		Namespace: namespace,
+		Target:    &jsonv,
+	}
+
+	epatch, err := mrsi.calculatePatch(&templateContext, jsonv, nil, operationLog)
+
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedJSON, err := epatch.ApplyWithOptions(originalJSON, jsonPatchApplyOptions)
+
+	// A failed test operation means the ModRule's precondition does not hold - there is nothing to patch.
+	if isPatchTestFailure(err) {
+		log.V(1).Info("ModRule patch test operation failed, skipping patch", "rule", mrsi.modRule.GetNamespacedName(), "reason", err.Error())
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if evanjsonpatch.Equal(originalJSON, modifiedJSON) {
+		return nil, nil
+	}
+
+	// Apply the same patch to the kubectl last-applied-configuration annotation.
+	if lastAppliedConfigurationJSON := extractLastAppliedConfiguration(jsonv); lastAppliedConfigurationJSON != nil {
+		patchedLastAppliedConfigurationJSON, err := epatch.ApplyWithOptions(lastAppliedConfigurationJSON, jsonPatchApplyOptions)
+
+		if err != nil {
+			log.V(1).Info("failed applying patch for ModRule to last-applied-configuration annotation", "rule", mrsi.modRule.GetNamespacedName(), "reason", err.Error())
+		} else {
+			modifiedv := interface{}(nil)
+
+			if err := json.Unmarshal(modifiedJSON, &modifiedv); err != nil {
+				return nil, err
+			}
+
+			node := modifiedv.(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+			node["kubectl.kubernetes.io/last-applied-configuration"] = string(patchedLastAppliedConfigurationJSON)
+
+			if modifiedJSON, err = json.Marshal(&modifiedv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ctrljsonpatch.CreatePatch(originalJSON, modifiedJSON)
+}
+
+// IdempotencyResult is the outcome of re-applying the Patch ModRules to an object they have already patched.
+type IdempotencyResult struct {
+	// Patch is the patch produced by the second pass. It is empty if the Patch ModRules are idempotent.
+	Patch []ctrljsonpatch.JsonPatchOperation `json:"patch"`
+
+	// ModRules contains the namespace/name of the ModRules which changed the object in the second pass.
+	ModRules []string `json:"modRules"`
+}
+
+// IsIdempotent returns true if the second pass did not change the object.
+func (r *IdempotencyResult) IsIdempotent() bool {
+	return len(r.Patch) == 0
+}
+
+// CheckIdempotency re-runs CalculatePatch against the object returned by a previous call to CalculatePatch
+// and reports the patch produced by the second pass. A non-empty second-pass patch means that the Patch ModRules
+// would keep changing the object every time Kubernetes passes it through KubeMod.
+// The admission operation is the one under which the patched object is passed again - normally UPDATE.
+// The second pass does not record any runtime statistics.
+func (s *ModRuleStore) CheckIdempotency(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, patched interface{}, operationLog logr.Logger) (*IdempotencyResult, error) {
+	patchedJSON, err := json.Marshal(patched)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OperationReport{idempotencyCheck: true}
+	_, patch, err := s.CalculatePatch(admissionOperation, namespace, patchedJSON, report, operationLog)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdempotencyResult{
+		Patch:    patch,
+		ModRules: report.changedBy,
+	}, nil
+}
+
 // DetermineRejections checks if the given object should be rejected based on the current Reject ModRules stored in the namespace.
-func (s *ModRuleStore) DetermineRejections(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, jsonv interface{}, operationLog logr.Logger) []string {
+// The rejections of dry-run ModRules are not returned - they are recorded in the given operation report instead.
+func (s *ModRuleStore) DetermineRejections(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, jsonv interface{}, report *OperationReport, operationLog logr.Logger) []string {
+	return s.determineMessages(admissionOperation, namespace, v1beta1.ModRuleTypeReject, jsonv, report, operationLog)
+}
+
+// DetermineWarnings returns the warnings which should be reported for the given object based on the current Warn ModRules stored in the namespace.
+func (s *ModRuleStore) DetermineWarnings(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, jsonv interface{}, report *OperationReport, operationLog logr.Logger) []string {
+	return s.determineMessages(admissionOperation, namespace, v1beta1.ModRuleTypeWarn, jsonv, report, operationLog)
+}
+
+// AuditResult describes a Reject ModRule which matches an existing object.
+type AuditResult struct {
+	// ModRule is the namespace/name of the Reject ModRule.
+	ModRule string
+
+	// Message is the rejection message of the ModRule.
+	Message string
+
+	// DryRun indicates that the ModRule is a dry-run ModRule, which would not actually reject the object.
+	DryRun bool
+}
+
+// AuditRejections determines the Reject ModRules which would reject the given existing object if it was admitted today.
+// Unlike DetermineRejections, it reports dry-run ModRules alongside enforced ones and does not record any runtime statistics.
+func (s *ModRuleStore) AuditRejections(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, jsonv interface{}, operationLog logr.Logger) []AuditResult {
+	results := []AuditResult{}
+
+	for _, em := range s.evaluateMessages(admissionOperation, namespace, v1beta1.ModRuleTypeReject, jsonv, nil, operationLog) {
+		results = append(results, AuditResult{
+			ModRule: em.mrsi.modRule.GetNamespacedName(),
+			Message: em.message,
+			DryRun:  em.mrsi.modRule.IsDryRun(),
+		})
+	}
+
+	return results
+}
+
+// determineMessages evaluates the reject messages of all ModRules of the given type which match the given object.
+func (s *ModRuleStore) determineMessages(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, modRuleType v1beta1.ModRuleType, jsonv interface{}, report *OperationReport, operationLog logr.Logger) []string {
+	var messages = []string{}
+	var log logr.Logger
+
+	// If we are getting operation-specific log, use it, otherwise, use the singleton log we have for the ModRuleStore item.
+	if operationLog != nil {
+		log = operationLog.WithName("core")
+	} else {
+		log = s.log
+	}
+
+	for _, em := range s.evaluateMessages(admissionOperation, namespace, modRuleType, jsonv, report, operationLog) {
+		if em.err != nil {
+			s.recordError(em.mrsi, em.err, report)
+		}
+
+		switch {
+		// Dry-run ModRules only record the rejection they would have produced.
+		case em.mrsi.modRule.IsDryRun():
+			log.Info("dry-run ModRule would have rejected the operation", "rule", em.mrsi.modRule.GetNamespacedName(), "rejection", em.message)
+			s.recordStats(em.mrsi, ModRuleStatsDelta{Matched: 1, DryRunRejected: 1, LastMatchTime: time.Now()}, report)
+			report.addDryRunResult(DryRunResult{ModRule: em.mrsi.modRule.GetNamespacedName(), Rejection: em.message})
+
+		case modRuleType == v1beta1.ModRuleTypeReject:
+			s.recordStats(em.mrsi, ModRuleStatsDelta{Matched: 1, Rejected: 1, LastMatchTime: time.Now()}, report)
+			messages = append(messages, em.message)
+
+		default:
+			s.recordStats(em.mrsi, ModRuleStatsDelta{Matched: 1, LastMatchTime: time.Now()}, report)
+			messages = append(messages, em.message)
+		}
+	}
+
+	return messages
+}
+
+// evaluatedMessage is the message of a ModRule which matches an object.
+type evaluatedMessage struct {
+	mrsi    *ModRuleStoreItem
+	message string
+	err     error
+}
+
+// evaluateMessages finds all ModRules of the given type which match the given object and evaluates their reject messages.
+func (s *ModRuleStore) evaluateMessages(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, modRuleType v1beta1.ModRuleType, jsonv interface{}, report *OperationReport, operationLog logr.Logger) []evaluatedMessage {
 	var currentExecutionTier int16 = math.MinInt16
 	var matchingModRules []*ModRuleStoreItem
-	var rejectionMessages = []string{}
+	var messages = []evaluatedMessage{}
 	var log logr.Logger
 
 	// If we are getting operation-specific log, use it, otherwise, use the singleton log we have for the ModRuleStore item.
@@ -362,19 +862,26 @@ func (s *ModRuleStore) DetermineRejections(admissionOperation v1beta1.ModRuleAdm
 	templateContext := RejectTemplateContext{
 		Namespace: namespace,
 		Target:    &jsonv,
+		Admission: getValueFromJSONObject(jsonv, "admission"),
+		OldObject: getValueFromJSONObject(jsonv, "oldObject"),
 	}
 
+	// Evaluate all execution tiers against the same snapshot of the store, even if ModRules are modified in the meantime.
+	snapshot := s.currentSnapshot()
+
 	for {
-		// Find all matching Reject rules for the first execution tier higher than the previous execution tier.
-		matchingModRules, currentExecutionTier = s.getMatchingModRuleStoreItems(admissionOperation, namespace, currentExecutionTier+1, v1beta1.ModRuleTypeReject, jsonv)
+		// Find all matching rules for the first execution tier higher than the previous execution tier.
+		matchingModRules, currentExecutionTier = s.getMatchingModRuleStoreItems(snapshot, admissionOperation, namespace, currentExecutionTier+1, modRuleType, jsonv, report, log)
 
 		// No rules matching execution tier higher than the latest execution tier were found - break out of here.
 		if currentExecutionTier == math.MaxInt16 {
 			break
 		}
 
-		// Enumerate all matching reject rules and evaluate their messages.
+		// Enumerate all matching rules and evaluate their messages.
 		for _, mrsi := range matchingModRules {
+			em := evaluatedMessage{mrsi: mrsi}
+			modRuleTrace := report.modRuleTrace(mrsi)
 
 			if mrsi.rejectMessageTemplate != nil {
 				vb := strings.Builder{}
@@ -383,24 +890,151 @@ func (s *ModRuleStore) DetermineRejections(admissionOperation v1beta1.ModRuleAdm
 				if err != nil {
 					// Log the template error, but do not stop the rejection.
 					log.Error(err, "invalid rejectMessage template", "rule", mrsi.modRule.GetNamespacedName(), "rejectMessage text", *mrsi.modRule.Spec.RejectMessage)
-					rejectionMessages = append(rejectionMessages, fmt.Sprintf("%s", mrsi.modRule.GetNamespacedName()))
+					em.err = err
+					em.message = fmt.Sprintf("%s", mrsi.modRule.GetNamespacedName())
 				} else {
-					rejectionMessages = append(rejectionMessages, fmt.Sprintf("%s: \"%s\"", mrsi.modRule.GetNamespacedName(), vb.String()))
+					em.message = fmt.Sprintf("%s: \"%s\"", mrsi.modRule.GetNamespacedName(), vb.String())
 				}
 			} else {
-				rejectionMessages = append(rejectionMessages, fmt.Sprintf("%s", mrsi.modRule.GetNamespacedName()))
+				em.message = fmt.Sprintf("%s", mrsi.modRule.GetNamespacedName())
+			}
+
+			if modRuleTrace != nil {
+				modRuleTrace.Message = em.message
+
+				if em.err != nil {
+					modRuleTrace.setError(em.err)
+				}
+			}
+
+			messages = append(messages, em)
+		}
+	}
+
+	return messages
+}
+
+// CalculateGeneratedResources renders the companion resources of all Generate ModRules which match the given object.
+// The rendered resources are tied back to the given object and the ModRule which generated them, but are not created.
+func (s *ModRuleStore) CalculateGeneratedResources(admissionOperation v1beta1.ModRuleAdmissionOperation, namespace string, jsonv interface{}, report *OperationReport, operationLog logr.Logger) []*GeneratedResource {
+	var currentExecutionTier int16 = math.MinInt16
+	var matchingModRules []*ModRuleStoreItem
+	var resources = []*GeneratedResource{}
+	var log logr.Logger
+
+	// If we are getting operation-specific log, use it, otherwise, use the singleton log we have for the ModRuleStore item.
+	if operationLog != nil {
+		log = operationLog.WithName("core")
+	} else {
+		log = s.log
+	}
+
+	templateContext := GenerateTemplateContext{
+		Namespace: namespace,
+		Target:    &jsonv,
+		Admission: getValueFromJSONObject(jsonv, "admission"),
+		OldObject: getValueFromJSONObject(jsonv, "oldObject"),
+	}
+
+	trigger := newGeneratedResourceTrigger(namespace, jsonv)
+
+	// Evaluate all execution tiers against the same snapshot of the store, even if ModRules are modified in the meantime.
+	snapshot := s.currentSnapshot()
+
+	for {
+		// Find all matching rules for the first execution tier higher than the previous execution tier.
+		matchingModRules, currentExecutionTier = s.getMatchingModRuleStoreItems(snapshot, admissionOperation, namespace, currentExecutionTier+1, v1beta1.ModRuleTypeGenerate, jsonv, report, log)
+
+		// No rules matching execution tier higher than the latest execution tier were found - break out of here.
+		if currentExecutionTier == math.MaxInt16 {
+			break
+		}
+
+		for _, mrsi := range matchingModRules {
+			// Only ClusterModRules and ModRules in the cluster-wide namespace may generate resources outside of their own namespace.
+			generated, err := mrsi.renderGeneratedResources(&templateContext, trigger, mrsi.modRule.GenerateNamespace(s.clusterModRulesNamespace))
+
+			if err != nil {
+				// Log the template error and move on to the next ModRule.
+				log.Error(err, "failed to render generate template", "rule", mrsi.modRule.GetNamespacedName())
+				s.recordError(mrsi, err, report)
+				report.modRuleTrace(mrsi).setError(err)
+				continue
 			}
+
+			s.recordStats(mrsi, ModRuleStatsDelta{Matched: 1, LastMatchTime: time.Now()}, report)
+			resources = append(resources, generated...)
 		}
 	}
 
-	return rejectionMessages
+	return resources
+}
+
+// recordDryRunPatch logs and reports the patch a dry-run ModRule would have applied.
+func (s *ModRuleStore) recordDryRunPatch(mrsi *ModRuleStoreItem, epatch evanjsonpatch.Patch, report *OperationReport, log logr.Logger) {
+	patchJSON, err := json.Marshal(epatch)
+
+	if err != nil {
+		log.Error(err, "failed encoding dry-run patch for ModRule", "rule", mrsi.modRule.GetNamespacedName())
+		s.recordStats(mrsi, ModRuleStatsDelta{Errors: 1}, report)
+		return
+	}
+
+	log.Info("dry-run ModRule would have patched the object", "rule", mrsi.modRule.GetNamespacedName(), "patch", string(patchJSON))
+	s.recordStats(mrsi, ModRuleStatsDelta{DryRunPatched: 1}, report)
+	report.addDryRunResult(DryRunResult{ModRule: mrsi.modRule.GetNamespacedName(), Patch: string(patchJSON)})
 }
 
-// findModRuleIndexByName returns the index of the first ModRule which matches the given name
+// recordError counts an error in the evaluation of the given ModRule.
+// The errors of enforced ModRules with failurePolicy Fail are also recorded in the given operation report.
+func (s *ModRuleStore) recordError(mrsi *ModRuleStoreItem, err error, report *OperationReport) {
+	s.recordStats(mrsi, ModRuleStatsDelta{Errors: 1}, report)
+
+	if mrsi.modRule.FailsClosed() && !mrsi.modRule.IsDryRun() {
+		report.addFailure(FailureResult{ModRule: mrsi.modRule.GetNamespacedName(), Error: err.Error()})
+	}
+}
+
+// recordStats adds the given delta to the runtime statistics of the given ModRule.
+// Nothing is recorded while checking the idempotency of Patch ModRules.
+func (s *ModRuleStore) recordStats(mrsi *ModRuleStoreItem, delta ModRuleStatsDelta, report *OperationReport) {
+	if report.isIdempotencyCheck() {
+		return
+	}
+
+	s.stats.record(types.NamespacedName{Namespace: mrsi.modRule.Namespace, Name: mrsi.modRule.Name}, delta)
+}
+
+// DrainStats returns the runtime statistics collected for each ModRule since the last call to DrainStats
+// and resets the statistics.
+// The statistics are keyed by the namespace and name of the ModRules in the store.
+func (s *ModRuleStore) DrainStats() map[types.NamespacedName]ModRuleStatsDelta {
+	return s.stats.drain()
+}
+
+// RestoreStats merges previously drained statistics back into the store.
+// It is used to retain statistics which could not be flushed.
+func (s *ModRuleStore) RestoreStats(stats map[types.NamespacedName]ModRuleStatsDelta) {
+	for key, delta := range stats {
+		s.stats.record(key, delta)
+	}
+}
+
+// storeNamespace returns the namespace under which ModRules of the given namespace are stored.
+// Cluster-scoped ModRules are stored under the cluster-wide namespace.
+func (s *ModRuleStore) storeNamespace(modRuleNamespace string) string {
+	if modRuleNamespace == "" {
+		return s.clusterModRulesNamespace
+	}
+
+	return modRuleNamespace
+}
+
+// findModRuleIndexByName returns the index of the first ModRule which matches the given namespace and name
 // or -1 if no match is found.
-func findItemIndexByName(modRules []*ModRuleStoreItem, name string) int {
+func findItemIndexByName(modRules []*ModRuleStoreItem, namespace string, name string) int {
 	for index, val := range modRules {
-		if val.modRule.Name == name {
+		if val.modRule.Namespace == namespace && val.modRule.Name == name {
 			return index
 		}
 	}
@@ -413,10 +1047,7 @@ func findItemIndexByName(modRules []*ModRuleStoreItem, name string) int {
 func (s *ModRuleStore) GetStats() map[string]int {
 	namespaces := make(map[string]int)
 
-	s.rwLock.RLock()
-	defer s.rwLock.RUnlock()
-
-	for namespace, modruleList := range s.modRuleListMap {
+	for namespace, modruleList := range s.currentSnapshot().modRuleListMap {
 		namespaces[namespace] = len(modruleList)
 	}
 
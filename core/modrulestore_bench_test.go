@@ -15,6 +15,11 @@ limitations under the License.
 package core
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
 	"sync/atomic"
 	"testing"
 
@@ -61,3 +66,67 @@ func BenchmarkModRuleStorePutParallel(b *testing.B) {
 		}
 	})
 }
+
+// benchmarkKinds are the kinds of the ModRules loaded by BenchmarkModRuleStoreGetMatchingModRuleStoreItems.
+var benchmarkKinds = []string{"Pod", "Deployment", "Service", "ConfigMap", "Secret", "Ingress", "Job", "CronJob", "StatefulSet", "DaemonSet"}
+
+func BenchmarkModRuleStoreGetMatchingModRuleStoreItems(b *testing.B) {
+	resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	jsonv := interface{}(nil)
+	if err = json.Unmarshal(resourceJSON, &jsonv); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, targeted := range []bool{false, true} {
+		b.Run(fmt.Sprintf("targeted=%v", targeted), func(b *testing.B) {
+			testBed := InitializeModRuleStoreTestBed("kubemod-system", b)
+			rs := testBed.modRuleStore
+
+			// Load 500 ModRules evenly distributed across the benchmark kinds.
+			for i := 0; i < 500; i++ {
+				kind := benchmarkKinds[i%len(benchmarkKinds)]
+
+				modRule := &v1beta1.ModRule{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "my-namespace",
+						Name:      fmt.Sprintf("modrule-%d", i),
+					},
+					Spec: v1beta1.ModRuleSpec{
+						Type:                v1beta1.ModRuleTypePatch,
+						AdmissionOperations: []v1beta1.ModRuleAdmissionOperation{"CREATE"},
+						Match: []v1beta1.MatchItem{
+							{
+								Select: fmt.Sprintf(`$.kind == "%s"`, kind),
+							},
+							{
+								Select: `$.metadata.labels.app =~ "nginx"`,
+							},
+						},
+					},
+				}
+
+				if targeted {
+					modRule.Spec.Targets = []v1beta1.ModRuleTarget{{Kind: kind}}
+				}
+
+				if err := rs.Put(modRule); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				modRules, _ := rs.getMatchingModRuleStoreItems(rs.currentSnapshot(), "CREATE", "my-namespace", math.MinInt16, v1beta1.ModRuleTypePatch, jsonv, nil, rs.log)
+
+				if len(modRules) != 50 {
+					b.Fatalf("expected 50 matching ModRules, got %d", len(modRules))
+				}
+			}
+		})
+	}
+}
@@ -15,16 +15,36 @@ limitations under the License.
 package core
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"path"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kubemod/kubemod/api/v1beta1"
+	"github.com/kubemod/kubemod/expressions"
 	"github.com/kubemod/kubemod/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/yaml"
 
 	. "github.com/onsi/ginkgo"
@@ -71,7 +91,7 @@ var _ = Describe("ModRuleStore", func() {
 			Expect(err).NotTo(HaveOccurred())
 		}
 
-		_, patch, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, nil)
+		_, patch, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, nil, nil)
 		Expect(err).NotTo(HaveOccurred())
 
 		// Sort the patch because the order returned by CalculatePatch is unstable.
@@ -119,7 +139,7 @@ var _ = Describe("ModRuleStore", func() {
 			}
 		}
 
-		rejections := rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil)
+		rejections := rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)
 
 		expectation, err := ioutil.ReadFile(path.Join("testdata/expectations/", expectationFile))
 		Expect(err).NotTo(HaveOccurred())
@@ -161,6 +181,13 @@ var _ = Describe("ModRuleStore", func() {
 		Entry("simple tiered execution should work as expected", []string{"patch/patch-29.yaml", "patch/patch-30.yaml"}, "deployment-1.json", "patch-29-30-deployment-1.txt"),
 		Entry("tiered execution with two ModRules in second tier should work as expected", []string{"patch/patch-29.yaml", "patch/patch-30.yaml", "patch/patch-31.yaml"}, "deployment-1.json", "patch-29-30-31-deployment-1.txt"),
 		Entry("tiered execution with three tiers should work as expected", []string{"patch/patch-29.yaml", "patch/patch-30.yaml", "patch/patch-31.yaml", "patch/patch-32.yaml"}, "deployment-1.json", "patch-29-30-31-32-deployment-1.txt"),
+		Entry("move and copy operations should work as expected", []string{"patch/patch-34.yaml"}, "pod-1.json", "patch-34-pod-1.txt"),
+		Entry("passing test operation should apply the patch", []string{"patch/patch-35.yaml"}, "pod-1.json", "patch-35-pod-1.txt"),
+		Entry("failing test operation should skip the patch", []string{"patch/patch-35.yaml", "patch/patch-36.yaml"}, "pod-1.json", "patch-35-pod-1.txt"),
+		Entry("passing test operation in a second tier should apply the patch", []string{"patch/patch-36.yaml"}, "pod-1.json", "patch-36-pod-1.txt"),
+		Entry("move operation with select should work as expected", []string{"patch/patch-37.yaml"}, "pod-1.json", "patch-37-pod-1.txt"),
+		Entry("merge operation should work as expected", []string{"patch/patch-38.yaml"}, "pod-1.json", "patch-38-pod-1.txt"),
+		Entry("strategic merge operation should work as expected", []string{"patch/patch-39.yaml"}, "pod-1.json", "patch-39-pod-1.txt"),
 	)
 
 	DescribeTable("DetermineRejections", modRuleStoreDetermineRejectionsTableFunction,
@@ -270,6 +297,1443 @@ var _ = Describe("ModRuleStore", func() {
 
 })
 
+// ********************************************************************
+// Test ModRuleStore with ClusterModRules
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs    *ModRuleStore
+		jsonv interface{}
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-3.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv = nil
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "reject/cluster-modrule-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRule := v1beta1.ClusterModRule{}
+		err = yaml.Unmarshal(clusterModRuleYAML, &clusterModRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRule.Default()
+
+		err = rs.Put(clusterModRule.AsModRule())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should apply ClusterModRules to namespaces matching their targetNamespaceRegex", func() {
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{`modrule-1: "External IP 123.12.34.1 is not allowed"`}))
+		Expect(rs.DetermineRejections("CREATE", "other-namespace", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should not apply ClusterModRules as namespaced ModRules of the cluster-wide namespace", func() {
+		Expect(rs.DetermineRejections("CREATE", "kubemod-system", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should store ClusterModRules alongside same-named ModRules deployed to the cluster-wide namespace", func() {
+		modRule := &v1beta1.ModRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "kubemod-system",
+				Name:      "modrule-1",
+			},
+			Spec: v1beta1.ModRuleSpec{
+				Type:                v1beta1.ModRuleTypeReject,
+				AdmissionOperations: []v1beta1.ModRuleAdmissionOperation{"CREATE"},
+				Match: []v1beta1.MatchItem{
+					{
+						Select: `$.kind == "Service"`,
+					},
+				},
+			},
+		}
+
+		err := rs.Put(modRule)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rs.GetStats()).To(Equal(map[string]int{"kubemod-system": 2}))
+
+		rs.Delete("", "modrule-1")
+		Expect(rs.GetStats()).To(Equal(map[string]int{"kubemod-system": 1}))
+		Expect(rs.DetermineRejections("CREATE", "kubemod-system", jsonv, nil, nil)).To(Equal([]string{"kubemod-system/modrule-1"}))
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore target index
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	loadResource := func(resourceJSONFile string) interface{} {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", resourceJSONFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv := interface{}(nil)
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		return jsonv
+	}
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "reject/targets-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		err = rs.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should apply targeted ModRules to resources matching their targets exactly once", func() {
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", loadResource("deployment-1.json"), nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", loadResource("service-1.json"), nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+	})
+
+	It("should not apply targeted ModRules to resources which do not match their targets", func() {
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", loadResource("pod-1.json"), nil, nil)).To(BeEmpty())
+
+		jsonv := loadResource("service-1.json")
+		jsonv.(map[string]interface{})["apiVersion"] = "v2"
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should keep applying untargeted ModRules to resources of any kind", func() {
+		err := rs.Put(&v1beta1.ModRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "my-namespace",
+				Name:      "modrule-2",
+			},
+			Spec: v1beta1.ModRuleSpec{
+				Type:                v1beta1.ModRuleTypeReject,
+				AdmissionOperations: []v1beta1.ModRuleAdmissionOperation{"CREATE"},
+				Match: []v1beta1.MatchItem{
+					{
+						Select: "$.kind",
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", loadResource("pod-1.json"), nil, nil)).To(Equal([]string{"my-namespace/modrule-2"}))
+
+		rs.Delete("my-namespace", "modrule-1")
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", loadResource("deployment-1.json"), nil, nil)).To(Equal([]string{"my-namespace/modrule-2"}))
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore namespace selectors
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs    *ModRuleStore
+		jsonv interface{}
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv = nil
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "reject/namespace-selector-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRule := v1beta1.ClusterModRule{}
+		err = yaml.Unmarshal(clusterModRuleYAML, &clusterModRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRule.Default()
+
+		err = rs.Put(clusterModRule.AsModRule())
+		Expect(err).NotTo(HaveOccurred())
+
+		rs.namespaceLabelCache.Put("prod-1", map[string]string{"env": "production"})
+		rs.namespaceLabelCache.Put("prod-2", map[string]string{"env": "production", "kubemod.io/exempt": ""})
+		rs.namespaceLabelCache.Put("dev-1", map[string]string{"env": "development"})
+	})
+
+	It("should apply ModRules to namespaces matching their targetNamespaceSelector", func() {
+		Expect(rs.DetermineRejections("CREATE", "prod-1", jsonv, nil, nil)).To(Equal([]string{"modrule-1"}))
+		Expect(rs.DetermineRejections("CREATE", "dev-1", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should not apply ModRules to namespaces matching their excludeNamespaceSelector", func() {
+		Expect(rs.DetermineRejections("CREATE", "prod-2", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should not apply ModRules to unknown namespaces or non-namespaced resources", func() {
+		Expect(rs.DetermineRejections("CREATE", "unknown", jsonv, nil, nil)).To(BeEmpty())
+		Expect(rs.DetermineRejections("CREATE", "", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should apply ModRules whose targetNamespaceRegex matches any namespace to non-namespaced resources regardless of their selectors", func() {
+		targetNamespaceRegex := ".*"
+		kind := "Service"
+
+		clusterModRule := v1beta1.ClusterModRule{}
+		clusterModRule.Name = "modrule-2"
+		clusterModRule.Spec = v1beta1.ModRuleSpec{
+			Type:                    v1beta1.ModRuleTypeReject,
+			TargetNamespaceRegex:    &targetNamespaceRegex,
+			TargetNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "production"}},
+			Match:                   []v1beta1.MatchItem{{Select: "$.kind", MatchValue: &kind}},
+		}
+		clusterModRule.Default()
+		Expect(rs.Put(clusterModRule.AsModRule())).To(Succeed())
+
+		Expect(rs.DetermineRejections("CREATE", "", jsonv, nil, nil)).To(Equal([]string{"modrule-2"}))
+		Expect(rs.DetermineRejections("CREATE", "dev-1", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should look up the labels of namespaces missing from the cache in the cluster", func() {
+		rs.namespaceLabelCache.reader = fake.NewFakeClientWithScheme(clientgoscheme.Scheme, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "prod-3", Labels: map[string]string{"env": "production"}},
+		})
+
+		Expect(rs.DetermineRejections("CREATE", "prod-3", jsonv, nil, nil)).To(Equal([]string{"modrule-1"}))
+		Expect(rs.namespaceLabelCache.Get("prod-3")).To(Equal(labels.Set{"env": "production"}))
+		Expect(rs.DetermineRejections("CREATE", "unknown", jsonv, nil, nil)).To(BeEmpty())
+	})
+
+	It("should reflect namespace relabeling", func() {
+		rs.namespaceLabelCache.Put("dev-1", map[string]string{"env": "production"})
+		Expect(rs.DetermineRejections("CREATE", "dev-1", jsonv, nil, nil)).To(Equal([]string{"modrule-1"}))
+
+		rs.namespaceLabelCache.Put("prod-1", map[string]string{"env": "production", "kubemod.io/exempt": "true"})
+		Expect(rs.DetermineRejections("CREATE", "prod-1", jsonv, nil, nil)).To(BeEmpty())
+
+		rs.namespaceLabelCache.Delete("dev-1")
+		Expect(rs.DetermineRejections("CREATE", "dev-1", jsonv, nil, nil)).To(BeEmpty())
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore exclude blocks
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs    *ModRuleStore
+		jsonv interface{}
+	)
+
+	withUserInfo := func(username string, groups ...interface{}) interface{} {
+		jsonv.(map[string]interface{})["admission"] = map[string]interface{}{
+			"userInfo": map[string]interface{}{
+				"username": username,
+				"groups":   groups,
+			},
+		}
+
+		return jsonv
+	}
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv = nil
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "reject/exclude-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "kubemod-system"
+
+		err = rs.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should apply ModRules when their exclude block does not hit", func() {
+		report := &OperationReport{}
+		Expect(rs.DetermineRejections("CREATE", "default", withUserInfo("alice", "developers"), report, nil)).To(Equal([]string{"kubemod-system/modrule-1"}))
+		Expect(report.Exclusions).To(BeEmpty())
+	})
+
+	DescribeTable("should skip ModRules when their exclude block hits",
+		func(namespace string, name string, username string, group string, expectedReason string) {
+			jsonv.(map[string]interface{})["metadata"].(map[string]interface{})["name"] = name
+			report := &OperationReport{}
+
+			Expect(rs.DetermineRejections("CREATE", namespace, withUserInfo(username, group), report, nil)).To(BeEmpty())
+			Expect(report.Exclusions).To(Equal([]ExclusionResult{{ModRule: "kubemod-system/modrule-1", Reason: expectedReason}}))
+		},
+		Entry("by match", "default", "kube-dns", "alice", "developers", "object matches exclude.match"),
+		Entry("by namespace", "kube-system", "nginx", "alice", "developers", "namespace kube-system is excluded"),
+		Entry("by user", "default", "nginx", "system:serviceaccount:kube-system:deployment-controller", "developers", "user system:serviceaccount:kube-system:deployment-controller is excluded"),
+		Entry("by group", "default", "nginx", "alice", "system:masters", "group system:masters is excluded"),
+	)
+})
+
+// ********************************************************************
+// Test ModRuleStore exceptions
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs        *ModRuleStore
+		jsonv     interface{}
+		exception *v1beta1.ModRuleException
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv = nil
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = rs.Put(&v1beta1.ModRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "my-namespace",
+				Name:      "modrule-1",
+			},
+			Spec: v1beta1.ModRuleSpec{
+				Type:                v1beta1.ModRuleTypeReject,
+				AdmissionOperations: []v1beta1.ModRuleAdmissionOperation{"CREATE"},
+				Match: []v1beta1.MatchItem{
+					{
+						Select: `$.kind == "Service"`,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		exceptionYAML, err := ioutil.ReadFile(path.Join("testdata/exceptions/", "exception-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		exception = &v1beta1.ModRuleException{}
+		err = yaml.Unmarshal(exceptionYAML, exception)
+		Expect(err).NotTo(HaveOccurred())
+
+		exception.Default()
+	})
+
+	It("should not apply ModRules waived by an exception", func() {
+		Expect(rs.PutException(exception)).To(Succeed())
+
+		report := &OperationReport{}
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, report, nil)).To(BeEmpty())
+		Expect(report.Exclusions).To(Equal([]ExclusionResult{{ModRule: "my-namespace/modrule-1", Reason: "waived by ModRuleException my-namespace/exception-1"}}))
+	})
+
+	It("should apply ModRules to objects which do not match the exception", func() {
+		jsonv.(map[string]interface{})["metadata"].(map[string]interface{})["name"] = "httpd"
+		Expect(rs.PutException(exception)).To(Succeed())
+
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+	})
+
+	It("should apply ModRules not referenced by the exception", func() {
+		exception.Spec.ModRules[0].Name = "modrule-2"
+		Expect(rs.PutException(exception)).To(Succeed())
+
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+	})
+
+	It("should apply ModRules once the exception expires", func() {
+		exception.Spec.ExpiresAt = metav1.NewTime(time.Now().Add(-time.Minute))
+		Expect(rs.PutException(exception)).To(Succeed())
+
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+	})
+
+	It("should apply ModRules once the exception is deleted", func() {
+		Expect(rs.PutException(exception)).To(Succeed())
+		rs.DeleteException("my-namespace", "exception-1")
+
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+	})
+
+	It("should only apply exceptions to the objects in their namespace", func() {
+		exception.Namespace = "other-namespace"
+		Expect(rs.PutException(exception)).To(Succeed())
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(Equal([]string{"my-namespace/modrule-1"}))
+
+		clusterException := exception.DeepCopy()
+		clusterException.Namespace = "kubemod-system"
+		Expect(rs.PutException(clusterException)).To(Succeed())
+		Expect(rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)).To(BeEmpty())
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore patch values sourced from ConfigMaps and Secrets
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs                  *ModRuleStore
+		fakeClientset       *kubefake.Clientset
+		valueSourceResolver *KubernetesValueSourceResolver
+		modRule             *v1beta1.ModRule
+		modRuleKey          types.NamespacedName
+		configMap           *corev1.ConfigMap
+		resourceJSON        []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "registry-config"},
+			Data:       map[string]string{"mirror": "mirror.example.com"},
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubemod-system", Name: "ca-bundle"},
+			Data:       map[string][]byte{"ca.crt": []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")},
+		}
+
+		fakeClient := fake.NewFakeClientWithScheme(clientgoscheme.Scheme, configMap.DeepCopy(), secret.DeepCopy())
+		fakeClientset = kubefake.NewSimpleClientset(configMap.DeepCopy(), secret.DeepCopy())
+
+		log := NewTestLogger(GinkgoT())
+		valueSourceResolver = newKubernetesValueSourceResolver(fakeClient, fakeClientset, "kubemod-system", log)
+		itemFactory := NewModRuleStoreItemFactory(expressions.NewKubeModJSONPathLanguage(), valueSourceResolver, log)
+		rs = NewModRuleStore(itemFactory, "kubemod-system", NewNamespaceLabelCache(), log)
+
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "patch/patch-40.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule = &v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, modRule)
+		Expect(err).NotTo(HaveOccurred())
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+		modRuleKey = types.NamespacedName{Namespace: modRule.Namespace, Name: modRule.Name}
+
+		resourceJSON, err = ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		valueSourceResolver.Untrack(modRuleKey)
+	})
+
+	patchValues := func() map[string]interface{} {
+		_, patch, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		values := map[string]interface{}{}
+
+		for _, operation := range patch {
+			values[operation.Path] = operation.Value
+		}
+
+		return values
+	}
+
+	updateConfigMap := func(mirror string) {
+		configMap.Data["mirror"] = mirror
+		_, err := fakeClientset.CoreV1().ConfigMaps("my-namespace").Update(context.Background(), configMap, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should expose ConfigMap data to the patch values", func() {
+		Expect(rs.Put(modRule)).To(Succeed())
+
+		values := patchValues()
+		Expect(values).To(HaveKeyWithValue("/metadata/labels/registry-mirror", "mirror.example.com"))
+		Expect(values).To(HaveKeyWithValue("/spec/containers/0/image", "mirror.example.com/nginx:1.14.2"))
+	})
+
+	It("should pick up changes to the referenced ConfigMap when the ModRule is recompiled", func() {
+		valueSourceResolver.Track(modRuleKey, modRule.Spec.Patch)
+		Expect(rs.Put(modRule)).To(Succeed())
+
+		updateConfigMap("other-mirror.example.com")
+
+		Expect(patchValues()).To(HaveKeyWithValue("/metadata/labels/registry-mirror", "mirror.example.com"))
+
+		Eventually(func() map[string]interface{} {
+			Expect(rs.Put(modRule)).To(Succeed())
+			return patchValues()
+		}).Should(HaveKeyWithValue("/metadata/labels/registry-mirror", "other-mirror.example.com"))
+	})
+
+	It("should notify the ModRules which reference a ConfigMap when it changes", func() {
+		valueSourceResolver.Track(modRuleKey, modRule.Spec.Patch)
+		Expect(rs.Put(modRule)).To(Succeed())
+
+		updateConfigMap("other-mirror.example.com")
+
+		var e event.GenericEvent
+		Eventually(valueSourceResolver.ModRuleEvents()).Should(Receive(&e))
+		Expect(e.Meta.GetNamespace()).To(Equal("my-namespace"))
+		Expect(e.Meta.GetName()).To(Equal("modrule-1"))
+	})
+
+	It("should watch each referenced object once and stop watching it when it is no longer referenced", func() {
+		other := types.NamespacedName{Namespace: "my-namespace", Name: "modrule-2"}
+
+		valueSourceResolver.Track(modRuleKey, modRule.Spec.Patch)
+		valueSourceResolver.Track(other, modRule.Spec.Patch)
+		Expect(valueSourceResolver.watches).To(HaveLen(1))
+
+		valueSourceResolver.Untrack(modRuleKey)
+		Expect(valueSourceResolver.watches).To(HaveLen(1))
+
+		valueSourceResolver.Track(other, nil)
+		Expect(valueSourceResolver.watches).To(BeEmpty())
+		Expect(valueSourceResolver.modRuleRefs).To(BeEmpty())
+	})
+
+	It("should read referenced objects from the API server if their watch does not sync", func() {
+		fakeClientset.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", errors.New("forbidden"))
+		})
+		valueSourceResolver.syncTimeout = 100 * time.Millisecond
+
+		valueSourceResolver.Track(modRuleKey, modRule.Spec.Patch)
+		Expect(rs.Put(modRule)).To(Succeed())
+
+		Expect(patchValues()).To(HaveKeyWithValue("/metadata/labels/registry-mirror", "mirror.example.com"))
+	})
+
+	It("should fail to compile ModRules which reference missing keys", func() {
+		modRule.Spec.Patch[0].ValueFrom.ConfigMapKeyRef.Key = "missing"
+
+		err := rs.Put(modRule)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("key missing not found in ConfigMap my-namespace/registry-config"))
+	})
+
+	It("should resolve missing optional references to empty data", func() {
+		optional := true
+		modRule.Spec.Patch[0].ValueFrom.ConfigMapKeyRef.Name = "missing"
+		modRule.Spec.Patch[0].ValueFrom.ConfigMapKeyRef.Optional = &optional
+
+		Expect(rs.Put(modRule)).To(Succeed())
+		Expect(patchValues()).To(HaveKeyWithValue("/metadata/labels/registry-mirror", ""))
+	})
+
+	It("should resolve the Secret references of ClusterModRules in the KubeMod namespace", func() {
+		valueFrom := &v1beta1.PatchValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+			Key:                  "ca.crt",
+		}}
+
+		value, err := valueSourceResolver.ResolveValueSource("", valueFrom)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"))
+
+		valueSourceResolver.Track(types.NamespacedName{Name: "cluster-modrule"}, []v1beta1.PatchOperation{{Operation: v1beta1.Add, Path: "/a", ValueFrom: valueFrom}})
+		defer valueSourceResolver.Untrack(types.NamespacedName{Name: "cluster-modrule"})
+
+		value, err = valueSourceResolver.ResolveValueSource("", valueFrom)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(value).To(Equal("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"))
+	})
+
+	It("should not resolve the Secret references of namespaced ModRules", func() {
+		modRule.Spec.Patch[0].ValueFrom = &v1beta1.PatchValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+			Key:                  "ca.crt",
+		}}
+
+		err := rs.Put(modRule)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("secretKeyRef is only supported by ClusterModRules"))
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore Generate ModRules
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs        *ModRuleStore
+		namespace interface{}
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "generate/generate-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		clusterModRule := v1beta1.ClusterModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &clusterModRule)
+		Expect(err).NotTo(HaveOccurred())
+		clusterModRule.Default()
+
+		err = rs.Put(clusterModRule.AsModRule())
+		Expect(err).NotTo(HaveOccurred())
+
+		namespaceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "namespace-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		err = json.Unmarshal(namespaceJSON, &namespace)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should render the companion resources of matching objects", func() {
+		resources := rs.CalculateGeneratedResources("CREATE", "", namespace, nil, nil)
+		Expect(resources).To(HaveLen(2))
+
+		Expect(resources[0].Object.GetKind()).To(Equal("NetworkPolicy"))
+		Expect(resources[0].Object.GetNamespace()).To(Equal("team-a"))
+		Expect(resources[0].Synchronize).To(BeFalse())
+
+		Expect(resources[1].Object.GetKind()).To(Equal("ResourceQuota"))
+		Expect(resources[1].Synchronize).To(BeTrue())
+
+		pods, _, _ := unstructured.NestedString(resources[1].Object.Object, "spec", "hard", "pods")
+		Expect(pods).To(Equal("100"))
+	})
+
+	It("should tie the companion resources back to the ModRule and the trigger", func() {
+		resources := rs.CalculateGeneratedResources("CREATE", "", namespace, nil, nil)
+		Expect(resources).NotTo(BeEmpty())
+
+		Expect(resources[0].Object.GetAnnotations()).To(HaveKeyWithValue(generatedModRuleAnnotation, "namespace-defaults"))
+		Expect(resources[0].Object.GetAnnotations()).To(HaveKeyWithValue(generatedTriggerAnnotation, "Namespace/team-a"))
+		Expect(resources[0].Trigger).To(Equal(GeneratedResourceTrigger{APIVersion: "v1", Kind: "Namespace", Name: "team-a"}))
+	})
+
+	It("should not render companion resources of namespaced ModRules outside of their namespace", func() {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "generate/generate-2.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := &v1beta1.ModRule{}
+		Expect(yaml.Unmarshal(modRuleYAML, modRule)).To(Succeed())
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+		Expect(rs.Put(modRule)).To(Succeed())
+
+		podJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := interface{}(nil)
+		Expect(json.Unmarshal(podJSON, &pod)).To(Succeed())
+
+		Expect(rs.CalculateGeneratedResources("CREATE", "my-namespace", pod, nil, nil)).To(BeEmpty())
+		Expect(rs.DrainStats()[types.NamespacedName{Namespace: "my-namespace", Name: "pod-companion"}].Errors).To(BeEquivalentTo(1))
+	})
+
+	It("should not render companion resources of objects which do not match", func() {
+		podJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := interface{}(nil)
+		err = json.Unmarshal(podJSON, &pod)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rs.CalculateGeneratedResources("CREATE", "", pod, nil, nil)).To(BeEmpty())
+	})
+
+	Context("when the companion resources are created", func() {
+		var (
+			fakeClient client.Client
+			generator  *ResourceGenerator
+			resources  []*GeneratedResource
+		)
+
+		BeforeEach(func() {
+			restMapper := meta.NewDefaultRESTMapper(nil)
+			restMapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+			restMapper.Add(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}, meta.RESTScopeNamespace)
+			restMapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"}, meta.RESTScopeNamespace)
+
+			fakeClient = fake.NewFakeClientWithScheme(clientgoscheme.Scheme, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a", UID: "1234"},
+			})
+
+			generator = &ResourceGenerator{
+				client:     fakeClient,
+				restMapper: restMapper,
+				log:        NewTestLogger(GinkgoT()),
+			}
+
+			resources = rs.CalculateGeneratedResources("CREATE", "", namespace, nil, nil)
+			Expect(resources).NotTo(BeEmpty())
+		})
+
+		getNetworkPolicy := func() *unstructured.Unstructured {
+			networkPolicy := &unstructured.Unstructured{}
+			networkPolicy.SetGroupVersionKind(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"})
+			Expect(fakeClient.Get(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "default-deny"}, networkPolicy)).To(Succeed())
+			return networkPolicy
+		}
+
+		It("should make the trigger the owner of the companion resources", func() {
+			Expect(generator.generate(context.Background(), resources[0])).To(Succeed())
+
+			networkPolicy := getNetworkPolicy()
+			Expect(networkPolicy.GetLabels()).To(HaveKeyWithValue(generatedTriggerUIDLabel, "1234"))
+			Expect(networkPolicy.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "team-a", UID: "1234"}}))
+		})
+
+		It("should leave existing companion resources alone", func() {
+			Expect(generator.generate(context.Background(), resources[0])).To(Succeed())
+			Expect(generator.generate(context.Background(), resources[0])).To(Succeed())
+		})
+
+		It("should not generate cluster-scoped resources rendered by namespaced ModRules", func() {
+			resource := resources[0]
+			resource.ScopeNamespace = "team-a"
+			resource.Object = &unstructured.Unstructured{}
+			resource.Object.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"})
+			resource.Object.SetName("escalated")
+
+			err := generator.generate(context.Background(), resource)
+			Expect(errors.Is(err, errGenerateOutOfScope)).To(BeTrue())
+		})
+
+		It("should not generate resources which grant permissions when rendered by namespaced ModRules", func() {
+			resource := resources[0]
+			resource.ScopeNamespace = "team-a"
+			resource.Object = &unstructured.Unstructured{}
+			resource.Object.SetGroupVersionKind(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"})
+			resource.Object.SetNamespace("team-a")
+			resource.Object.SetName("escalated")
+
+			err := generator.generate(context.Background(), resource)
+			Expect(errors.Is(err, errGenerateOutOfScope)).To(BeTrue())
+		})
+
+		It("should not generate resources rendered by namespaced ModRules in other namespaces", func() {
+			resource := resources[0]
+			resource.ScopeNamespace = "team-b"
+
+			err := generator.generate(context.Background(), resource)
+			Expect(errors.Is(err, errGenerateOutOfScope)).To(BeTrue())
+		})
+
+		It("should not generate companion resources until the trigger is persisted", func() {
+			Expect(fakeClient.Delete(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})).To(Succeed())
+
+			Expect(generator.generate(context.Background(), resources[0])).NotTo(Succeed())
+
+			networkPolicy := &unstructured.Unstructured{}
+			networkPolicy.SetGroupVersionKind(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"})
+			err := fakeClient.Get(context.Background(), types.NamespacedName{Namespace: "team-a", Name: "default-deny"}, networkPolicy)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should look up triggers named by generateName by the label of the admission request which created them", func() {
+			// The trigger is admitted with a generateName and only gets its name when it is persisted.
+			resource := resources[0]
+			resource.Trigger.Name = ""
+			resource.Trigger.UID = ""
+
+			patch := labelUnnamedTrigger(map[string]interface{}{"metadata": map[string]interface{}{}}, "request-1", resources[:1])
+			Expect(patch).To(HaveLen(1))
+			Expect(patch[0].Path).To(Equal("/metadata/labels"))
+			Expect(patch[0].Value).To(Equal(map[string]interface{}{generatedTriggerRequestLabel: "request-1"}))
+			Expect(resource.Trigger.RequestUID).To(Equal(types.UID("request-1")))
+
+			Expect(generator.generate(context.Background(), resource)).NotTo(Succeed())
+
+			Expect(fakeClient.Create(context.Background(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a-x7k2p", UID: "5678", Labels: map[string]string{generatedTriggerRequestLabel: "request-1"}},
+			})).To(Succeed())
+
+			Expect(generator.generate(context.Background(), resource)).To(Succeed())
+
+			networkPolicy := getNetworkPolicy()
+			Expect(networkPolicy.GetLabels()).To(HaveKeyWithValue(generatedTriggerUIDLabel, "5678"))
+			Expect(networkPolicy.GetAnnotations()).To(HaveKeyWithValue(generatedTriggerAnnotation, "Namespace/team-a-x7k2p"))
+			Expect(networkPolicy.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "team-a-x7k2p", UID: "5678"}}))
+		})
+
+		It("should not label triggers which have a name", func() {
+			Expect(labelUnnamedTrigger(map[string]interface{}{}, "request-1", resources)).To(BeEmpty())
+			Expect(resources[0].Trigger.RequestUID).To(BeEmpty())
+		})
+
+		It("should drop companion resources whose trigger is never persisted", func() {
+			Expect(fakeClient.Delete(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})).To(Succeed())
+
+			generator.queue = workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0))
+			generator.Enqueue(resources[0])
+
+			for i := 0; i <= generatorMaxRetries; i++ {
+				Expect(generator.processNextItem()).To(BeTrue())
+			}
+
+			Expect(generator.queue.Len()).To(BeZero())
+			Expect(generator.queue.NumRequeues(resources[0])).To(BeZero())
+		})
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore rejection audit
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs    *ModRuleStore
+		jsonv interface{}
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "service-3.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		jsonv = nil
+		err = json.Unmarshal(resourceJSON, &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, modRuleYAMLFile := range []string{"reject/boolean-service-malicious-external-ips-1.yaml", "reject/dry-run-1.yaml"} {
+			modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+			Expect(err).NotTo(HaveOccurred())
+
+			modRule := v1beta1.ModRule{}
+			err = yaml.Unmarshal(modRuleYAML, &modRule)
+			Expect(err).NotTo(HaveOccurred())
+
+			modRule.Default()
+			modRule.Namespace = "my-namespace"
+
+			err = rs.Put(&modRule)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	It("should report enforced and dry-run Reject ModRules matching an existing object", func() {
+		Expect(rs.AuditRejections("CREATE", "my-namespace", jsonv, nil)).To(Equal([]AuditResult{
+			{ModRule: "my-namespace/modrule-1", Message: `my-namespace/modrule-1: "One or more of the following external IPs are not allowed [123.12.34.1 123.12.35.2]"`},
+			{ModRule: "my-namespace/modrule-dry-run", Message: `my-namespace/modrule-dry-run: "External IP 123.12.34.1 is not allowed"`, DryRun: true},
+		}))
+
+		Expect(rs.AuditRejections("CREATE", "other-namespace", jsonv, nil)).To(BeEmpty())
+	})
+
+	It("should not record runtime statistics", func() {
+		Expect(rs.AuditRejections("CREATE", "my-namespace", jsonv, nil)).To(HaveLen(2))
+		Expect(rs.DrainStats()).To(BeEmpty())
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore evaluation trace
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", "patch/patch-1.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		err = rs.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	calculateTrace := func(resourceFileJSONFile string) *EvaluationTrace {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", resourceFileJSONFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		report := &OperationReport{Trace: &EvaluationTrace{}}
+		_, _, err = rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, report, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		return report.Trace
+	}
+
+	It("should trace the match items and the patch of a matching ModRule", func() {
+		trace := calculateTrace("pod-1.json")
+
+		Expect(trace.Tiers).To(HaveLen(1))
+		Expect(trace.Tiers[0].Type).To(Equal(v1beta1.ModRuleTypePatch))
+		Expect(trace.Tiers[0].ModRules).To(HaveLen(1))
+
+		modRuleTrace := trace.Tiers[0].ModRules[0]
+		Expect(modRuleTrace.ModRule).To(Equal("my-namespace/modrule-1"))
+		Expect(modRuleTrace.Matched).To(BeTrue())
+		Expect(modRuleTrace.Match).To(HaveLen(2))
+		Expect(modRuleTrace.Match[0].Result).To(Equal("Pod"))
+		Expect(modRuleTrace.Match[0].Comparison).To(Equal(`any of the results equal "Pod"`))
+		Expect(modRuleTrace.Match[0].Matched).To(BeTrue())
+		Expect(modRuleTrace.Match[1].Matched).To(BeTrue())
+		Expect(modRuleTrace.Patch).To(ContainSubstring(`"path": "/baz"`))
+		Expect(modRuleTrace.Error).To(BeEmpty())
+	})
+
+	It("should trace all match items of a ModRule which does not match", func() {
+		trace := calculateTrace("service-3.json")
+
+		Expect(trace.Tiers).To(HaveLen(1))
+		Expect(trace.Tiers[0].ModRules).To(HaveLen(1))
+
+		modRuleTrace := trace.Tiers[0].ModRules[0]
+		Expect(modRuleTrace.Matched).To(BeFalse())
+		Expect(modRuleTrace.Match).To(HaveLen(2))
+		Expect(modRuleTrace.Match[0].Result).To(Equal("Service"))
+		Expect(modRuleTrace.Match[0].Matched).To(BeFalse())
+		Expect(modRuleTrace.Patch).To(BeEmpty())
+	})
+
+	It("should not trace the evaluation unless requested", func() {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		report := &OperationReport{}
+		_, _, err = rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, report, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Trace).To(BeNil())
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore idempotency check
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+	})
+
+	loadModRule := func(modRuleYAMLFile string) {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		err = rs.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	checkIdempotency := func(resourceFileJSONFile string) *IdempotencyResult {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", resourceFileJSONFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		patched, patch, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patch).NotTo(BeEmpty())
+
+		result, err := rs.CheckIdempotency("UPDATE", "my-namespace", patched, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		return result
+	}
+
+	It("should find no second-pass patch for idempotent ModRules", func() {
+		loadModRule("patch/patch-1.yaml")
+
+		result := checkIdempotency("pod-1.json")
+		Expect(result.IsIdempotent()).To(BeTrue())
+		Expect(result.ModRules).To(BeEmpty())
+	})
+
+	It("should report the second-pass patch and the ModRules which produced it", func() {
+		loadModRule("patch/patch-1.yaml")
+		loadModRule("patch/non-idempotent-1.yaml")
+
+		result := checkIdempotency("pod-1.json")
+		Expect(result.IsIdempotent()).To(BeFalse())
+		Expect(result.ModRules).To(Equal([]string{"my-namespace/modrule-non-idempotent"}))
+		Expect(result.Patch).To(HaveLen(1))
+		Expect(result.Patch[0].Operation).To(Equal("add"))
+		Expect(result.Patch[0].Path).To(Equal("/spec/containers/2"))
+	})
+
+	It("should not record runtime statistics for the second pass", func() {
+		loadModRule("patch/non-idempotent-1.yaml")
+
+		checkIdempotency("pod-1.json")
+
+		stats := rs.DrainStats()
+		delta := stats[types.NamespacedName{Namespace: "my-namespace", Name: "modrule-non-idempotent"}]
+		Expect(delta.Matched).To(Equal(int64(1)))
+		Expect(delta.Patched).To(Equal(int64(1)))
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore patch conflicts
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+	})
+
+	readModRule := func(modRuleYAMLFile string) *v1beta1.ModRule {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := &v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		return modRule
+	}
+
+	It("should statically find ModRules in the same execution tier which write to overlapping paths", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml"))).To(Succeed())
+
+		Expect(rs.FindPatchConflicts(readModRule("patch/conflict-2.yaml"))).To(Equal([]PatchConflict{
+			{
+				ModRule:            "my-namespace/modrule-conflict-2",
+				Path:               "/metadata/labels",
+				ConflictingModRule: "my-namespace/modrule-conflict-1",
+				ConflictingPath:    "/metadata/labels/color",
+			},
+		}))
+	})
+
+	It("should find the conflicts of stored ModRules keyed by the conflicting ModRule", func() {
+		Expect(rs.FindStoredPatchConflicts("my-namespace", "modrule-conflict-1")).To(BeEmpty())
+
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml"))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-2.yaml"))).To(Succeed())
+
+		Expect(rs.FindStoredPatchConflicts("my-namespace", "modrule-conflict-1")).To(Equal(map[types.NamespacedName]PatchConflict{
+			{Namespace: "my-namespace", Name: "modrule-conflict-2"}: {
+				ModRule:            "my-namespace/modrule-conflict-1",
+				Path:               "/metadata/labels/color",
+				ConflictingModRule: "my-namespace/modrule-conflict-2",
+				ConflictingPath:    "/metadata/labels",
+			},
+		}))
+
+		rs.Delete("my-namespace", "modrule-conflict-2")
+		Expect(rs.FindStoredPatchConflicts("my-namespace", "modrule-conflict-1")).To(BeEmpty())
+	})
+
+	It("should not find conflicts between ModRules in different execution tiers", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml"))).To(Succeed())
+
+		modRule := readModRule("patch/conflict-2.yaml")
+		modRule.Spec.ExecutionTier = 1
+
+		Expect(rs.FindPatchConflicts(modRule)).To(BeEmpty())
+	})
+
+	It("should detect conflicting patches at request time and fail fail-closed ModRules", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml"))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-2.yaml"))).To(Succeed())
+
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		report := &OperationReport{}
+		_, _, err = rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, report, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(report.Conflicts).To(HaveLen(1))
+		Expect([]string{report.Conflicts[0].ModRule, report.Conflicts[0].ConflictingModRule}).To(ConsistOf("my-namespace/modrule-conflict-1", "my-namespace/modrule-conflict-2"))
+
+		Expect(report.Failures).To(HaveLen(1))
+		Expect(report.Failures[0].ModRule).To(Equal("my-namespace/modrule-conflict-2"))
+	})
+
+	DescribeTable("should determine whether write paths overlap", func(a string, b string, expected bool) {
+		Expect(writePathsOverlap(a, b)).To(Equal(expected))
+		Expect(writePathsOverlap(b, a)).To(Equal(expected))
+	},
+		Entry("identical paths overlap", "/metadata/labels/color", "/metadata/labels/color", true),
+		Entry("nested paths overlap", "/metadata/labels", "/metadata/labels/color", true),
+		Entry("sibling paths do not overlap", "/metadata/labels/color", "/metadata/labels/size", false),
+		Entry("placeholders match any segment", "/spec/containers/#0/image", "/spec/containers/1/image", true),
+		Entry("placeholders do not match different suffixes", "/spec/containers/#0/image", "/spec/containers/1/name", false),
+		Entry("appends to the same array do not overlap", "/spec/containers/-", "/spec/containers/-", false),
+		Entry("appends overlap with the whole array", "/spec/containers", "/spec/containers/-", true),
+		Entry("negative indices address the same element", "/spec/containers/-1", "/spec/containers/-1", true),
+		Entry("negative indices overlap with the element's fields", "/spec/containers/-1", "/spec/containers/-1/image", true),
+		Entry("negative indices may address the same element as other indices", "/spec/containers/-1/image", "/spec/containers/0/image", true),
+		Entry("negative indices do not overlap with appends", "/spec/containers/-1", "/spec/containers/-", false),
+	)
+})
+
+// ********************************************************************
+// Test ModRuleStore execution order
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+	})
+
+	readModRule := func(modRuleYAMLFile string, priority int32) *v1beta1.ModRule {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := &v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+		modRule.Spec.Priority = priority
+
+		return modRule
+	}
+
+	newModRule := func(name string, executionTier int16, priority int32) *v1beta1.ModRule {
+		modRule := readModRule("patch/conflict-1.yaml", priority)
+		modRule.Name = name
+		modRule.Spec.ExecutionTier = executionTier
+
+		return modRule
+	}
+
+	storedNames := func() []string {
+		var names []string
+		for _, mrsi := range rs.currentSnapshot().modRuleListMap["my-namespace"] {
+			names = append(names, mrsi.modRule.Name)
+		}
+		return names
+	}
+
+	patchedLabels := func() map[string]interface{} {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		patched, _, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, &OperationReport{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		return patched.(map[string]interface{})["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	}
+
+	It("should order ModRules by execution tier, priority and name regardless of the order they were stored in", func() {
+		for _, modRule := range []*v1beta1.ModRule{
+			newModRule("d", 0, 0),
+			newModRule("c", 1, -1),
+			newModRule("a", 0, 5),
+			newModRule("e", 0, 0),
+			newModRule("b", 0, 0),
+		} {
+			Expect(rs.Put(modRule)).To(Succeed())
+		}
+
+		Expect(storedNames()).To(Equal([]string{"b", "d", "e", "a", "c"}))
+	})
+
+	It("should preserve the order of the remaining ModRules on delete", func() {
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			Expect(rs.Put(newModRule(name, 0, 0))).To(Succeed())
+		}
+
+		rs.Delete("my-namespace", "b")
+
+		Expect(storedNames()).To(Equal([]string{"a", "c", "d", "e"}))
+	})
+
+	It("should let the patch of the ModRule with the higher priority take precedence", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", 1))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-2.yaml", 0))).To(Succeed())
+
+		Expect(patchedLabels()).To(Equal(map[string]interface{}{"app": "nginx", "color": "green"}))
+
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", 0))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-2.yaml", 1))).To(Succeed())
+
+		Expect(patchedLabels()).To(Equal(map[string]interface{}{"app": "nginx"}))
+	})
+
+	It("should not find conflicts between ModRules with different priorities", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", 0))).To(Succeed())
+
+		Expect(rs.FindPatchConflicts(readModRule("patch/conflict-2.yaml", 1))).To(BeEmpty())
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore snapshots
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+	})
+
+	readModRule := func(modRuleYAMLFile string, name string) *v1beta1.ModRule {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := &v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+		modRule.Name = name
+
+		return modRule
+	}
+
+	It("should not modify a snapshot once it is published", func() {
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", "a"))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", "b"))).To(Succeed())
+
+		snapshot := rs.currentSnapshot()
+		modRules := snapshot.modRuleListMap["my-namespace"]
+		Expect(modRules).To(HaveLen(2))
+		first, second := modRules[0], modRules[1]
+
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", "a"))).To(Succeed())
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", "c"))).To(Succeed())
+		rs.Delete("my-namespace", "b")
+
+		Expect(snapshot.modRuleListMap["my-namespace"]).To(HaveLen(2))
+		Expect(snapshot.modRuleListMap["my-namespace"][0]).To(BeIdenticalTo(first))
+		Expect(snapshot.modRuleListMap["my-namespace"][1]).To(BeIdenticalTo(second))
+
+		Expect(rs.currentSnapshot()).NotTo(BeIdenticalTo(snapshot))
+		Expect(rs.currentSnapshot().modRuleListMap["my-namespace"]).To(HaveLen(2))
+	})
+
+	It("should evaluate admissions consistently while ModRules are being modified", func() {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rs.Put(readModRule("patch/conflict-1.yaml", "a"))).To(Succeed())
+
+		done := make(chan struct{})
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				Expect(rs.Put(readModRule("patch/conflict-1.yaml", "b"))).To(Succeed())
+				rs.Delete("my-namespace", "b")
+			}
+			close(done)
+		}()
+
+		for {
+			select {
+			case <-done:
+				wg.Wait()
+				return
+			default:
+				_, patch, err := rs.CalculatePatch("CREATE", "my-namespace", resourceJSON, &OperationReport{}, nil)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(patch).To(HaveLen(1))
+			}
+		}
+	})
+})
+
+// ********************************************************************
+// Test ModRuleStore runtime statistics
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs *ModRuleStore
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+	})
+
+	loadModRule := func(modRuleYAMLFile string) {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := v1beta1.ModRule{}
+		err = yaml.Unmarshal(modRuleYAML, &modRule)
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+
+		err = rs.Put(&modRule)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	loadResource := func(resourceFileJSONFile string) []byte {
+		resourceJSON, err := ioutil.ReadFile(path.Join("testdata/resources/", resourceFileJSONFile))
+		Expect(err).NotTo(HaveOccurred())
+		return resourceJSON
+	}
+
+	It("should collect matched and patched statistics for Patch ModRules", func() {
+		loadModRule("patch/patch-1.yaml")
+
+		for i := 0; i < 3; i++ {
+			_, _, err := rs.CalculatePatch("CREATE", "my-namespace", loadResource("pod-1.json"), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		stats := rs.DrainStats()
+		Expect(len(stats)).To(Equal(1))
+
+		for _, delta := range stats {
+			Expect(delta.Matched).To(Equal(int64(3)))
+			Expect(delta.Patched).To(Equal(int64(3)))
+			Expect(delta.Rejected).To(Equal(int64(0)))
+			Expect(delta.Errors).To(Equal(int64(0)))
+			Expect(delta.LastMatchTime.IsZero()).To(BeFalse())
+		}
+
+		// Draining resets the statistics.
+		Expect(len(rs.DrainStats())).To(Equal(0))
+	})
+
+	It("should collect rejected and error statistics for Reject ModRules", func() {
+		loadModRule("reject/bad-reject-message-2.yaml")
+
+		jsonv := interface{}(nil)
+		err := json.Unmarshal(loadResource("service-3.json"), &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		rejections := rs.DetermineRejections("CREATE", "my-namespace", jsonv, nil, nil)
+		Expect(len(rejections)).To(Equal(1))
+
+		stats := rs.DrainStats()
+		delta, ok := stats[types.NamespacedName{Namespace: "my-namespace", Name: "modrule-1"}]
+		Expect(ok).To(BeTrue())
+		Expect(delta.Matched).To(Equal(int64(1)))
+		Expect(delta.Rejected).To(Equal(int64(1)))
+		Expect(delta.Errors).To(Equal(int64(1)))
+	})
+
+	It("should report instead of apply the patches of dry-run ModRules", func() {
+		loadModRule("patch/patch-1.yaml")
+		loadModRule("patch/dry-run-1.yaml")
+
+		report := &OperationReport{}
+		_, patch, err := rs.CalculatePatch("CREATE", "my-namespace", loadResource("pod-1.json"), report, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Only the enforced ModRule contributes to the patch.
+		for _, op := range patch {
+			Expect(op.Value).NotTo(Equal("blue"))
+		}
+
+		Expect(report.DryRunResults).To(Equal([]DryRunResult{
+			{ModRule: "my-namespace/modrule-dry-run", Patch: `[{"op":"add","path":"/metadata/labels/color","value":"blue"}]`},
+		}))
+
+		stats := rs.DrainStats()
+		delta := stats[types.NamespacedName{Namespace: "my-namespace", Name: "modrule-dry-run"}]
+		Expect(delta.Matched).To(Equal(int64(1)))
+		Expect(delta.Patched).To(Equal(int64(0)))
+		Expect(delta.DryRunPatched).To(Equal(int64(1)))
+	})
+
+	It("should report instead of return the rejections of dry-run ModRules", func() {
+		loadModRule("reject/dry-run-1.yaml")
+
+		jsonv := interface{}(nil)
+		err := json.Unmarshal(loadResource("service-3.json"), &jsonv)
+		Expect(err).NotTo(HaveOccurred())
+
+		report := &OperationReport{}
+		rejections := rs.DetermineRejections("CREATE", "my-namespace", jsonv, report, nil)
+		Expect(rejections).To(BeEmpty())
+
+		Expect(report.DryRunResults).To(Equal([]DryRunResult{
+			{ModRule: "my-namespace/modrule-dry-run", Rejection: `my-namespace/modrule-dry-run: "External IP 123.12.34.1 is not allowed"`},
+		}))
+
+		stats := rs.DrainStats()
+		delta := stats[types.NamespacedName{Namespace: "my-namespace", Name: "modrule-dry-run"}]
+		Expect(delta.Matched).To(Equal(int64(1)))
+		Expect(delta.Rejected).To(Equal(int64(0)))
+		Expect(delta.DryRunRejected).To(Equal(int64(1)))
+	})
+
+	It("should retain restored statistics", func() {
+		key := types.NamespacedName{Namespace: "my-namespace", Name: "modrule-1"}
+		rs.RestoreStats(map[types.NamespacedName]ModRuleStatsDelta{key: {Matched: 2, Errors: 1}})
+		rs.RestoreStats(map[types.NamespacedName]ModRuleStatsDelta{key: {Matched: 3}})
+
+		stats := rs.DrainStats()
+		Expect(stats[key].Matched).To(Equal(int64(5)))
+		Expect(stats[key].Errors).To(Equal(int64(1)))
+	})
+})
+
 // Given ModRuleStore stats, sum up the total count of modrules.
 func getTotalModRuleCountFromStats(modRuleStoreStats map[string]int) int {
 	ret := 0
@@ -280,3 +1744,80 @@ func getTotalModRuleCountFromStats(modRuleStoreStats map[string]int) int {
 
 	return ret
 }
+
+// ********************************************************************
+// Test ModRuleStore.CalculateModRulePatch
+// ********************************************************************
+
+var _ = Describe("ModRuleStore", func() {
+	var (
+		rs           *ModRuleStore
+		resourceJSON []byte
+	)
+
+	BeforeEach(func() {
+		testBed := InitializeModRuleStoreTestBed("kubemod-system", GinkgoT())
+		rs = testBed.modRuleStore
+
+		var err error
+		resourceJSON, err = ioutil.ReadFile(path.Join("testdata/resources/", "pod-1.json"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	loadModRule := func(modRuleYAMLFile string) {
+		modRuleYAML, err := ioutil.ReadFile(path.Join("testdata/modrules/", modRuleYAMLFile))
+		Expect(err).NotTo(HaveOccurred())
+
+		modRule := &v1beta1.ModRule{}
+		Expect(yaml.Unmarshal(modRuleYAML, modRule)).To(Succeed())
+
+		modRule.Default()
+		modRule.Namespace = "my-namespace"
+		Expect(rs.Put(modRule)).To(Succeed())
+	}
+
+	It("should calculate the patch of the given ModRule only", func() {
+		loadModRule("patch/conflict-1.yaml")
+		loadModRule("patch/conflict-2.yaml")
+
+		patch, err := rs.CalculateModRulePatch("UPDATE", "my-namespace", "my-namespace", "modrule-conflict-1", resourceJSON, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(patch).To(HaveLen(1))
+		Expect(patch[0].Operation).To(Equal("replace"))
+		Expect(patch[0].Path).To(Equal("/metadata/labels/color"))
+		Expect(patch[0].Value).To(Equal("green"))
+	})
+
+	It("should return an empty patch if the ModRule does not change the resource", func() {
+		loadModRule("patch/conflict-1.yaml")
+
+		greenResourceJSON := []byte(strings.Replace(string(resourceJSON), `"color": "red"`, `"color": "green"`, 1))
+
+		patch, err := rs.CalculateModRulePatch("UPDATE", "my-namespace", "my-namespace", "modrule-conflict-1", greenResourceJSON, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patch).To(BeEmpty())
+	})
+
+	It("should return an empty patch for ModRules deployed to other namespaces or missing from the store", func() {
+		loadModRule("patch/conflict-1.yaml")
+
+		patch, err := rs.CalculateModRulePatch("UPDATE", "other-namespace", "my-namespace", "modrule-conflict-1", resourceJSON, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patch).To(BeEmpty())
+
+		patch, err = rs.CalculateModRulePatch("UPDATE", "my-namespace", "my-namespace", "missing", resourceJSON, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patch).To(BeEmpty())
+	})
+
+	It("should not record runtime statistics", func() {
+		loadModRule("patch/conflict-1.yaml")
+
+		patch, err := rs.CalculateModRulePatch("UPDATE", "my-namespace", "my-namespace", "modrule-conflict-1", resourceJSON, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(patch).NotTo(BeEmpty())
+
+		Expect(rs.DrainStats()).To(BeEmpty())
+	})
+})
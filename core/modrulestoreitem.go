@@ -16,6 +16,7 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -30,6 +31,10 @@ import (
 	"github.com/kubemod/kubemod/api/v1beta1"
 	"github.com/kubemod/kubemod/jsonpath"
 	"github.com/kubemod/kubemod/util"
+	ctrljsonpatch "gomodules.xyz/jsonpatch/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // ModRuleStoreItem wraps around a ModRule and holds a cache of the ModRule's
@@ -37,17 +42,22 @@ import (
 type ModRuleStoreItem struct {
 	modRule                      *v1beta1.ModRule
 	compiledTargetNamespaceRegex *regexp.Regexp
+	targetNamespaceSelector      labels.Selector
+	excludeNamespaceSelector     labels.Selector
 	compiledMatchSelects         map[*v1beta1.MatchItem]gval.Evaluable
 	compiledRegexes              map[*v1beta1.MatchItem]*regexp.Regexp
 	compiledJSONPatch            []*compiledJSONPatchOperation
 	rejectMessageTemplate        *template.Template
+	generateTemplates            []*template.Template
+	writePaths                   []string
 	log                          logr.Logger
 }
 
 // ModRuleStoreItemFactory is used to construct ModRuleStoreItems.
 type ModRuleStoreItemFactory struct {
-	jsonPathLanguage *gval.Language
-	log              logr.Logger
+	jsonPathLanguage    *gval.Language
+	valueSourceResolver ValueSourceResolver
+	log                 logr.Logger
 }
 
 // compiledJSONPatchOperation stored a JSON patch operation with a pre-compiled select JSON Path and go template.
@@ -56,12 +66,16 @@ type compiledJSONPatchOperation struct {
 	patchSelect         gval.Evaluable
 	path                string
 	pathSprintfTemplate string
+	from                string
+	fromSprintfTemplate string
 	valueTemplate       *template.Template
+	valueFrom           string
 }
 
 // patchPathItem is used by the patch calculation logic.
 type patchPathItem struct {
 	path           string
+	from           string
 	selectKeyParts []interface{}
 	selectedItem   interface{}
 }
@@ -72,10 +86,11 @@ var (
 )
 
 // NewModRuleStoreItemFactory constructs a new ModRuleStoreItem factory.
-func NewModRuleStoreItemFactory(jsonPathLanguage *gval.Language, log logr.Logger) *ModRuleStoreItemFactory {
+func NewModRuleStoreItemFactory(jsonPathLanguage *gval.Language, valueSourceResolver ValueSourceResolver, log logr.Logger) *ModRuleStoreItemFactory {
 	return &ModRuleStoreItemFactory{
-		jsonPathLanguage: jsonPathLanguage,
-		log:              log.WithName("core"),
+		jsonPathLanguage:    jsonPathLanguage,
+		valueSourceResolver: valueSourceResolver,
+		log:                 log.WithName("core"),
 	}
 }
 
@@ -91,6 +106,20 @@ func (f *ModRuleStoreItemFactory) NewModRuleStoreItem(modRule *v1beta1.ModRule)
 		return nil, err
 	}
 
+	var targetNamespaceSelector labels.Selector
+	if modRule.Spec.TargetNamespaceSelector != nil {
+		if targetNamespaceSelector, err = metav1.LabelSelectorAsSelector(modRule.Spec.TargetNamespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+
+	var excludeNamespaceSelector labels.Selector
+	if modRule.Spec.ExcludeNamespaceSelector != nil {
+		if excludeNamespaceSelector, err = metav1.LabelSelectorAsSelector(modRule.Spec.ExcludeNamespaceSelector); err != nil {
+			return nil, err
+		}
+	}
+
 	compiledMatchSelects, err := newCompiledMatchSelects(modRule.Spec.Match, f.jsonPathLanguage)
 
 	if err != nil {
@@ -103,7 +132,30 @@ func (f *ModRuleStoreItemFactory) NewModRuleStoreItem(modRule *v1beta1.ModRule)
 		return nil, err
 	}
 
-	compiledJSONPatch, err := newCompiledJSONPatch(modRule.Spec.Patch, f.jsonPathLanguage)
+	// The match items of the exclude block share the caches of the ModRule match items.
+	if modRule.Spec.Exclude != nil {
+		compiledExcludeMatchSelects, err := newCompiledMatchSelects(modRule.Spec.Exclude.Match, f.jsonPathLanguage)
+
+		if err != nil {
+			return nil, err
+		}
+
+		compiledExcludeRegexes, err := newCompiledRegexes(modRule.Spec.Exclude.Match)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for matchItem, matchSelect := range compiledExcludeMatchSelects {
+			compiledMatchSelects[matchItem] = matchSelect
+		}
+
+		for matchItem, matchRegex := range compiledExcludeRegexes {
+			compiledRegexes[matchItem] = matchRegex
+		}
+	}
+
+	compiledJSONPatch, err := newCompiledJSONPatch(modRule.Spec.Patch, modRule.Namespace, f.jsonPathLanguage, f.valueSourceResolver)
 
 	if err != nil {
 		return nil, err
@@ -118,14 +170,27 @@ func (f *ModRuleStoreItemFactory) NewModRuleStoreItem(modRule *v1beta1.ModRule)
 		}
 	}
 
+	generateTemplates := make([]*template.Template, len(modRule.Spec.Generate))
+
+	for i, item := range modRule.Spec.Generate {
+		generateTemplates[i], err = util.NewSafeTemplate("generate").Parse(item.Template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &ModRuleStoreItem{
 			modRule:                      modRule,
 			log:                          f.log,
 			compiledTargetNamespaceRegex: compiledTargetNamespaceRegex,
+			targetNamespaceSelector:      targetNamespaceSelector,
+			excludeNamespaceSelector:     excludeNamespaceSelector,
 			compiledMatchSelects:         compiledMatchSelects,
 			compiledRegexes:              compiledRegexes,
 			compiledJSONPatch:            compiledJSONPatch,
 			rejectMessageTemplate:        rejectMessageTemplate,
+			generateTemplates:            generateTemplates,
+			writePaths:                   staticWritePaths(modRule.Spec.Patch),
 		},
 		nil
 }
@@ -167,15 +232,33 @@ func newCompiledRegexes(matchItems []v1beta1.MatchItem) (map[*v1beta1.MatchItem]
 }
 
 // newCompiledJSONPatch converts ModRule patch to evanphx jsonpatch Patch.
-func newCompiledJSONPatch(patch []v1beta1.PatchOperation, jsonPathLanguage *gval.Language) ([]*compiledJSONPatchOperation, error) {
+// The value sources of the patch operations are resolved on behalf of a ModRule in the given namespace.
+func newCompiledJSONPatch(patch []v1beta1.PatchOperation, namespace string, jsonPathLanguage *gval.Language, valueSourceResolver ValueSourceResolver) ([]*compiledJSONPatchOperation, error) {
 	var err error
 	var compiledPatch = []*compiledJSONPatchOperation{}
 
 	for _, po := range patch {
 		// Default to JSON "null" value in case po.Value is nil.
 		var value string = "null"
+		var valueFrom string
 		var patchSelect gval.Evaluable = nil
 
+		// Resolve the value source if any.
+		// Operations with a value source and no value use the resolved data as a string, or as a YAML fragment in the case of merge operations.
+		if po.ValueFrom != nil {
+			valueFrom, err = valueSourceResolver.ResolveValueSource(namespace, po.ValueFrom)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if po.Operation == v1beta1.Merge || po.Operation == v1beta1.StrategicMerge {
+				value = "{{ .ValueFrom }}"
+			} else {
+				value = "{{ .ValueFrom | toJson }}"
+			}
+		}
+
 		if po.Value != nil {
 			value = *po.Value
 		}
@@ -193,6 +276,15 @@ func newCompiledJSONPatch(patch []v1beta1.PatchOperation, jsonPathLanguage *gval
 		// If the path contains placeholders such as #0 and #1, we need to convert them to Sprintf template.
 		pathSprintfTemplate := pathTemplateToSprintfTemplate(po.Path)
 
+		// The same goes for the source path of move and copy operations.
+		from := ""
+
+		if po.From != nil {
+			from = *po.From
+		}
+
+		fromSprintfTemplate := pathTemplateToSprintfTemplate(from)
+
 		// Compile the go template value.
 		tpl, err := util.NewSafeTemplate(po.Path).Parse(util.PreProcessModRuleGoTemplate(value))
 
@@ -205,7 +297,10 @@ func newCompiledJSONPatch(patch []v1beta1.PatchOperation, jsonPathLanguage *gval
 			patchSelect:         patchSelect,
 			path:                po.Path,
 			pathSprintfTemplate: pathSprintfTemplate,
+			from:                from,
+			fromSprintfTemplate: fromSprintfTemplate,
 			valueTemplate:       tpl,
+			valueFrom:           valueFrom,
 		})
 	}
 
@@ -213,7 +308,8 @@ func newCompiledJSONPatch(patch []v1beta1.PatchOperation, jsonPathLanguage *gval
 }
 
 // calculatePatch runs the patch templates and returns a list of patch operations.
-func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext, jsonv interface{}, operationLog logr.Logger) (evanjsonpatch.Patch, error) {
+// If a trace is given, the resulting patch is recorded in it.
+func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext, jsonv interface{}, trace *ModRuleTrace, operationLog logr.Logger) (evanjsonpatch.Patch, error) {
 	var log logr.Logger
 	var operationIndex = 0
 
@@ -229,6 +325,32 @@ func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext
 	b.WriteRune('[')
 
 	for _, cop := range si.compiledJSONPatch {
+		// Merge operations are converted to a list of JSON patch operations against the whole resource.
+		if cop.op == v1beta1.Merge || cop.op == v1beta1.StrategicMerge {
+			mergeOperations, err := cop.calculateMergePatch(templateContext, jsonv)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for i := range mergeOperations {
+				operationJSON, err := mergeOperations[i].MarshalJSON()
+
+				if err != nil {
+					return nil, err
+				}
+
+				if operationIndex > 0 {
+					b.WriteRune(',')
+				}
+
+				b.Write(operationJSON)
+				operationIndex++
+			}
+
+			continue
+		}
+
 		// Calculate the actual set of patches to be performed.
 		// If there is no select expression, just create a single operation with the given path.
 		// If there is a select provided, execute the select query and generate one patch operation per result
@@ -250,8 +372,15 @@ func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext
 					return nil, fmt.Errorf("failed to generate Patch path from path template \"%v\": generated value \"%v\" ", cop.path, path)
 				}
 
+				from := pathFromKeyParts(selectKeyParts, cop.fromSprintfTemplate)
+
+				if strings.Contains(from, "(BADINDEX)") {
+					return nil, fmt.Errorf("failed to generate Patch from-path from path template \"%v\": generated value \"%v\" ", cop.from, from)
+				}
+
 				pathItems = append(pathItems, patchPathItem{
 					path:           path,
+					from:           from,
 					selectKeyParts: selectKeyParts,
 					selectedItem:   val,
 				})
@@ -260,18 +389,36 @@ func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext
 			// No select expression? Add a simple path with no select key parts.
 			pathItems = append(pathItems, patchPathItem{
 				path:           cop.path,
+				from:           cop.from,
 				selectKeyParts: []interface{}{},
 				selectedItem:   nil,
 			})
 		}
 
 		for _, pathItem := range pathItems {
+			if operationIndex > 0 {
+				b.WriteRune(',')
+			}
+
+			operationIndex++
+
+			// Operations move and copy carry a source path instead of a value, while remove carries neither.
+			switch cop.op {
+			case v1beta1.Move, v1beta1.Copy:
+				fmt.Fprintf(&b, `{"op": "%v", "from": "%v", "path": "%v"}`, cop.op, pathItem.from, pathItem.path)
+				continue
+
+			case v1beta1.Remove:
+				fmt.Fprintf(&b, `{"op": "%v", "path": "%v"}`, cop.op, pathItem.path)
+				continue
+			}
 
 			vb := strings.Builder{}
 
 			// Bake in the select-key parts and selected item into the template context.
 			templateContext.SelectKeyParts = pathItem.selectKeyParts
 			templateContext.SelectedItem = pathItem.selectedItem
+			templateContext.ValueFrom = cop.valueFrom
 
 			err := cop.valueTemplate.Execute(&vb, templateContext)
 
@@ -286,13 +433,7 @@ func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext
 				return nil, err
 			}
 
-			if operationIndex > 0 {
-				b.WriteRune(',')
-			}
-
 			fmt.Fprintf(&b, `{"op": "%v", "path": "%v", "value": %v}`, cop.op, pathItem.path, jsonValue)
-
-			operationIndex++
 		}
 	}
 
@@ -307,9 +448,43 @@ func (si *ModRuleStoreItem) calculatePatch(templateContext *PatchTemplateContext
 		log.V(1).Info("modrule patch", "modrule", si.modRule.GetNamespacedName(), "patch", epatch)
 	}
 
+	if trace != nil {
+		trace.Patch = patchText
+	}
+
 	return epatch, err
 }
 
+// calculateMergePatch evaluates the value template of a merge operation and converts the result into a list of JSON patch operations.
+func (cop *compiledJSONPatchOperation) calculateMergePatch(templateContext *PatchTemplateContext, jsonv interface{}) ([]ctrljsonpatch.JsonPatchOperation, error) {
+	vb := strings.Builder{}
+
+	// Merge operations have no select, hence no select-key parts and selected item.
+	templateContext.SelectKeyParts = []interface{}{}
+	templateContext.SelectedItem = nil
+	templateContext.ValueFrom = cop.valueFrom
+
+	err := cop.valueTemplate.Execute(&vb, templateContext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	patchJSON, err := yaml.YAMLToJSON([]byte(vb.String()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	originalJSON, err := json.Marshal(jsonv)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return mergePatchToJSONPatch(cop.op, originalJSON, patchJSON)
+}
+
 // Given a select key in the form of $["0"]["0"]["3"], and pathSprintfTemplate in the form of
 // /abc/%[1]v/def/%[2]v/xyz produce a path by replacing %[i]v with the value of the given key.
 func pathFromKeyParts(selectKeyParts []interface{}, pathSprintfTemplate string) string {
@@ -386,11 +561,130 @@ func modRuleValueToJSONValue(modRuleValue string) (string, error) {
 	return string(jsonb), err
 }
 
+// isNamespaceMatch determines whether a cluster-wide ModRule applies to resources in the given namespace.
+// Non-namespaced resources (empty namespace) are matched by ModRules whose target namespace regex matches the empty string (such as '.*'),
+// and by ModRules which do not target namespaces at all. Namespace selectors are not evaluated against them since they have no namespace.
+// Namespaced resources are only matched by ModRules whose target namespace regex and selector match the namespace
+// and whose exclude namespace selector does not.
+func (si *ModRuleStoreItem) isNamespaceMatch(namespace string, namespaceLabels labels.Set) bool {
+	if namespace == "" {
+		if si.compiledTargetNamespaceRegex != nil {
+			return si.compiledTargetNamespaceRegex.MatchString(namespace)
+		}
+
+		return si.targetNamespaceSelector == nil
+	}
+
+	if si.compiledTargetNamespaceRegex == nil && si.targetNamespaceSelector == nil {
+		return false
+	}
+
+	if si.compiledTargetNamespaceRegex != nil && !si.compiledTargetNamespaceRegex.MatchString(namespace) {
+		return false
+	}
+
+	if si.targetNamespaceSelector != nil && !si.targetNamespaceSelector.Matches(namespaceLabels) {
+		return false
+	}
+
+	if si.excludeNamespaceSelector != nil && si.excludeNamespaceSelector.Matches(namespaceLabels) {
+		return false
+	}
+
+	return true
+}
+
+// renderGeneratedResources evaluates the generate templates of the ModRule and returns the resulting resources.
+// If scopeNamespace is not empty, the resources may only be generated in that namespace.
+func (si *ModRuleStoreItem) renderGeneratedResources(templateContext *GenerateTemplateContext, trigger GeneratedResourceTrigger, scopeNamespace string) ([]*GeneratedResource, error) {
+	resources := make([]*GeneratedResource, 0, len(si.generateTemplates))
+
+	for i, tpl := range si.generateTemplates {
+		vb := strings.Builder{}
+
+		if err := tpl.Execute(&vb, templateContext); err != nil {
+			return nil, err
+		}
+
+		manifestJSON, err := yaml.YAMLToJSON([]byte(vb.String()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		object := &unstructured.Unstructured{}
+
+		if err := object.UnmarshalJSON(manifestJSON); err != nil {
+			return nil, err
+		}
+
+		if object.GetName() == "" {
+			return nil, fmt.Errorf("generated resource %s has no name", object.GroupVersionKind().Kind)
+		}
+
+		// The scope of resources with no namespace depends on their kind - it is checked when they are generated.
+		if scopeNamespace != "" && object.GetNamespace() != "" && object.GetNamespace() != scopeNamespace {
+			return nil, fmt.Errorf("generated resource %s/%s is outside of the namespace of the ModRule: %w", object.GetNamespace(), object.GetName(), errGenerateOutOfScope)
+		}
+
+		resources = append(resources, newGeneratedResource(object, si.modRule, si.modRule.Spec.Generate[i].Synchronize, trigger, scopeNamespace))
+	}
+
+	return resources, nil
+}
+
 // IsMatch runs all the queries stored in the receiving store item against the given JSON object.
 // If all of the queries match, it returns true, otherwise, returns false.
 func (si *ModRuleStoreItem) IsMatch(jsonv interface{}) bool {
-	matchItems := si.modRule.Spec.Match
+	return si.isMatchAll(si.modRule.Spec.Match, jsonv)
+}
+
+// exclusionReason evaluates the exclude block of the ModRule against the given JSON object deployed to the given namespace.
+// It returns the reason the object is excluded or an empty string if the object is not excluded.
+func (si *ModRuleStoreItem) exclusionReason(namespace string, jsonv interface{}) string {
+	exclude := si.modRule.Spec.Exclude
+
+	if exclude == nil {
+		return ""
+	}
+
+	if len(exclude.Match) > 0 && si.isMatchAll(exclude.Match, jsonv) {
+		return "object matches exclude.match"
+	}
+
+	if namespace != "" && containsString(exclude.Namespaces, namespace) {
+		return fmt.Sprintf("namespace %s is excluded", namespace)
+	}
+
+	// The user info is only available when the object comes from an admission request.
+	if username, ok := getValueFromJSONObject(jsonv, "admission:userInfo:username").(string); ok && containsString(exclude.Users, username) {
+		return fmt.Sprintf("user %s is excluded", username)
+	}
+
+	if groups, ok := getValueFromJSONObject(jsonv, "admission:userInfo:groups").([]interface{}); ok {
+		for _, group := range groups {
+			if groupName, ok := group.(string); ok && containsString(exclude.Groups, groupName) {
+				return fmt.Sprintf("group %s is excluded", groupName)
+			}
+		}
+	}
+
+	return ""
+}
+
+// containsString returns true if the given slice contains the given value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
 
+// isMatchAll returns true if all the given match items match the given JSON object.
+func (si *ModRuleStoreItem) isMatchAll(matchItems []v1beta1.MatchItem, jsonv interface{}) bool {
 	for i := range matchItems {
 		matchItem := &matchItems[i]
 
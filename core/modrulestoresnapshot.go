@@ -0,0 +1,84 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// modRuleStoreSnapshot is an immutable, pre-indexed view of the ModRules and ModRuleExceptions of a ModRuleStore.
+// A published snapshot is never modified - writers derive the next snapshot from the current one and publish it atomically.
+// This allows admissions to evaluate all execution tiers against a consistent view without taking any locks.
+type modRuleStoreSnapshot struct {
+	// ModRules keyed by store namespace, sorted in execution order.
+	modRuleListMap map[string][]*ModRuleStoreItem
+	// Target indexes of the ModRules keyed by store namespace.
+	targetIndexMap map[string]*modRuleTargetIndex
+	// ModRuleExceptions keyed by namespace.
+	exceptionListMap map[string][]*modRuleExceptionStoreItem
+}
+
+// newModRuleStoreSnapshot instantiates an empty snapshot.
+func newModRuleStoreSnapshot() *modRuleStoreSnapshot {
+	return &modRuleStoreSnapshot{
+		modRuleListMap:   make(map[string][]*ModRuleStoreItem),
+		targetIndexMap:   make(map[string]*modRuleTargetIndex),
+		exceptionListMap: make(map[string][]*modRuleExceptionStoreItem),
+	}
+}
+
+// withNamespaceModRules returns a new snapshot in which the ModRules of the given store namespace are replaced with the given ones.
+// The given slice is owned by the new snapshot and must not be modified by the caller afterwards.
+// The slices and indexes of all other namespaces are shared between the two snapshots.
+func (snapshot *modRuleStoreSnapshot) withNamespaceModRules(namespace string, modRules []*ModRuleStoreItem) *modRuleStoreSnapshot {
+	next := &modRuleStoreSnapshot{
+		modRuleListMap:   make(map[string][]*ModRuleStoreItem, len(snapshot.modRuleListMap)+1),
+		targetIndexMap:   make(map[string]*modRuleTargetIndex, len(snapshot.targetIndexMap)+1),
+		exceptionListMap: snapshot.exceptionListMap,
+	}
+
+	for ns, items := range snapshot.modRuleListMap {
+		if ns != namespace {
+			next.modRuleListMap[ns] = items
+			next.targetIndexMap[ns] = snapshot.targetIndexMap[ns]
+		}
+	}
+
+	// Namespaces with no modrules are removed from the maps.
+	if len(modRules) > 0 {
+		next.modRuleListMap[namespace] = modRules
+		next.targetIndexMap[namespace] = newModRuleTargetIndex(modRules)
+	}
+
+	return next
+}
+
+// withNamespaceExceptions returns a new snapshot in which the ModRuleExceptions of the given namespace are replaced with the given ones.
+// The given slice is owned by the new snapshot and must not be modified by the caller afterwards.
+func (snapshot *modRuleStoreSnapshot) withNamespaceExceptions(namespace string, exceptions []*modRuleExceptionStoreItem) *modRuleStoreSnapshot {
+	next := &modRuleStoreSnapshot{
+		modRuleListMap:   snapshot.modRuleListMap,
+		targetIndexMap:   snapshot.targetIndexMap,
+		exceptionListMap: make(map[string][]*modRuleExceptionStoreItem, len(snapshot.exceptionListMap)+1),
+	}
+
+	for ns, items := range snapshot.exceptionListMap {
+		if ns != namespace {
+			next.exceptionListMap[ns] = items
+		}
+	}
+
+	if len(exceptions) > 0 {
+		next.exceptionListMap[namespace] = exceptions
+	}
+
+	return next
+}
@@ -0,0 +1,111 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// modRuleTargetIndex organizes the ModRules of a store namespace by the group/version/kind of their targets.
+// It allows the store to skip the evaluation of ModRules which cannot possibly match a given object.
+type modRuleTargetIndex struct {
+	// ModRules with targets, keyed by group/version/kind.
+	// Targets with no version are keyed by their group/kind and an empty version.
+	targeted map[schema.GroupVersionKind][]*ModRuleStoreItem
+	// ModRules with no targets - these are candidates for objects of any kind.
+	untargeted []*ModRuleStoreItem
+}
+
+// newModRuleTargetIndex builds a target index of the given ModRule store items.
+func newModRuleTargetIndex(items []*ModRuleStoreItem) *modRuleTargetIndex {
+	index := &modRuleTargetIndex{
+		targeted: make(map[schema.GroupVersionKind][]*ModRuleStoreItem),
+	}
+
+	for _, mrsi := range items {
+		targets := mrsi.modRule.Spec.Targets
+
+		if len(targets) == 0 {
+			index.untargeted = append(index.untargeted, mrsi)
+			continue
+		}
+
+		// Make sure an item is indexed at most once under the keys an object could be looked up by.
+		keys := make(map[schema.GroupVersionKind]bool, len(targets))
+		anyVersionKinds := make(map[schema.GroupKind]bool, len(targets))
+
+		for _, target := range targets {
+			if target.Version == "" {
+				anyVersionKinds[schema.GroupKind{Group: target.Group, Kind: target.Kind}] = true
+			}
+		}
+
+		for _, target := range targets {
+			key := schema.GroupVersionKind{Group: target.Group, Version: target.Version, Kind: target.Kind}
+
+			// A target with no version already covers all versions of its group/kind.
+			if key.Version != "" && anyVersionKinds[key.GroupKind()] {
+				continue
+			}
+
+			if !keys[key] {
+				keys[key] = true
+				index.targeted[key] = append(index.targeted[key], mrsi)
+			}
+		}
+	}
+
+	return index
+}
+
+// forEachCandidate calls the given function for each ModRule store item which may match an object of the given group/version/kind.
+func (index *modRuleTargetIndex) forEachCandidate(gvk schema.GroupVersionKind, fn func(mrsi *ModRuleStoreItem)) {
+	if index == nil {
+		return
+	}
+
+	for _, mrsi := range index.untargeted {
+		fn(mrsi)
+	}
+
+	if gvk.Kind == "" {
+		return
+	}
+
+	for _, mrsi := range index.targeted[gvk] {
+		fn(mrsi)
+	}
+
+	if gvk.Version != "" {
+		for _, mrsi := range index.targeted[schema.GroupVersionKind{Group: gvk.Group, Kind: gvk.Kind}] {
+			fn(mrsi)
+		}
+	}
+}
+
+// groupVersionKindFromJSONObject returns the group/version/kind of the given unmarshalled JSON object.
+// It returns an empty group/version/kind if the object does not have an apiVersion and kind.
+func groupVersionKindFromJSONObject(jsonv interface{}) schema.GroupVersionKind {
+	apiVersion, _ := getValueFromJSONObject(jsonv, "apiVersion").(string)
+	kind, _ := getValueFromJSONObject(jsonv, "kind").(string)
+
+	gv, err := schema.ParseGroupVersion(apiVersion)
+
+	if err != nil {
+		return schema.GroupVersionKind{}
+	}
+
+	return gv.WithKind(kind)
+}
@@ -0,0 +1,117 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// NamespaceLabelCache is a thread-safe cache of the labels of the namespaces in the cluster.
+// It is kept up to date by the namespace controller and used by the ModRuleStore
+// to evaluate the namespace selectors of cluster-wide ModRules.
+// Namespaces which are missing from the cache (for example, because they have just been created) are looked up in the cluster.
+type NamespaceLabelCache struct {
+	namespaceLabels map[string]labels.Set
+	rwLock          sync.RWMutex
+	// reader looks up the namespaces which are missing from the cache - it is nil if there is no cluster to look them up in.
+	reader client.Reader
+	log    logr.Logger
+}
+
+// NewNamespaceLabelCache instantiates a new NamespaceLabelCache which only holds the labels put into it.
+func NewNamespaceLabelCache() *NamespaceLabelCache {
+	return &NamespaceLabelCache{
+		namespaceLabels: make(map[string]labels.Set),
+		rwLock:          sync.RWMutex{},
+	}
+}
+
+// NewClusterNamespaceLabelCache instantiates a new NamespaceLabelCache which looks up the namespaces missing from it in the cluster.
+func NewClusterNamespaceLabelCache(manager manager.Manager, log logr.Logger) *NamespaceLabelCache {
+	return &NamespaceLabelCache{
+		namespaceLabels: make(map[string]labels.Set),
+		rwLock:          sync.RWMutex{},
+		reader:          manager.GetAPIReader(),
+		log:             log.WithName("core").WithName("namespace-labels"),
+	}
+}
+
+// Put stores a copy of the labels of the given namespace.
+func (c *NamespaceLabelCache) Put(namespace string, namespaceLabels map[string]string) {
+	c.rwLock.Lock()
+	defer c.rwLock.Unlock()
+
+	c.namespaceLabels[namespace] = labels.Merge(nil, namespaceLabels)
+}
+
+// Delete removes the labels of the given namespace from the cache.
+func (c *NamespaceLabelCache) Delete(namespace string) {
+	c.rwLock.Lock()
+	defer c.rwLock.Unlock()
+
+	delete(c.namespaceLabels, namespace)
+}
+
+// Get returns the labels of the given namespace.
+// Namespaces which are not in the cache are looked up in the cluster, if any.
+// Namespaces which cannot be found have no labels.
+func (c *NamespaceLabelCache) Get(namespace string) labels.Set {
+	c.rwLock.RLock()
+	namespaceLabels, ok := c.namespaceLabels[namespace]
+	c.rwLock.RUnlock()
+
+	if ok {
+		return namespaceLabels
+	}
+
+	if c.reader == nil {
+		return labels.Set{}
+	}
+
+	return c.lookup(namespace)
+}
+
+// lookup reads the labels of the given namespace from the cluster and caches them.
+func (c *NamespaceLabelCache) lookup(namespace string) labels.Set {
+	var ns corev1.Namespace
+
+	if err := c.reader.Get(context.Background(), types.NamespacedName{Name: namespace}, &ns); err != nil {
+		if !apierrors.IsNotFound(err) {
+			c.log.Error(err, "unable to look up namespace labels", "namespace", namespace)
+		}
+
+		return labels.Set{}
+	}
+
+	c.rwLock.Lock()
+	defer c.rwLock.Unlock()
+
+	// The namespace controller may have cached more recent labels in the meantime.
+	if namespaceLabels, ok := c.namespaceLabels[namespace]; ok {
+		return namespaceLabels
+	}
+
+	c.namespaceLabels[namespace] = labels.Merge(nil, ns.Labels)
+	return c.namespaceLabels[namespace]
+}
@@ -0,0 +1,152 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+// OperationReport collects the outcomes of evaluating ModRules against an object
+// which are not reflected in the resulting patch, rejections or warnings.
+// A nil *OperationReport is valid and discards everything reported to it.
+type OperationReport struct {
+	// DryRunResults contains the patches and rejections which dry-run ModRules would have performed.
+	DryRunResults []DryRunResult `json:"dryRunResults,omitempty"`
+
+	// Exclusions contains the ModRules which matched the object, but were skipped by their exclude block.
+	Exclusions []ExclusionResult `json:"exclusions,omitempty"`
+
+	// Failures contains the evaluation errors of ModRules with failurePolicy Fail.
+	Failures []FailureResult `json:"failures,omitempty"`
+
+	// Conflicts contains the Patch ModRules in the same execution tier which wrote to overlapping paths.
+	Conflicts []PatchConflict `json:"conflicts,omitempty"`
+
+	// Trace explains the evaluation of the ModRules. It is only collected if it is not nil when the report is passed to the ModRuleStore.
+	Trace *EvaluationTrace `json:"trace,omitempty"`
+
+	// idempotencyCheck marks the report of the second pass of an idempotency check,
+	// which does not record runtime statistics and collects the ModRules which changed the object.
+	idempotencyCheck bool
+
+	// changedBy contains the namespace/name of the ModRules which changed the object during an idempotency check.
+	changedBy []string
+}
+
+// DryRunResult describes the outcome a dry-run ModRule would have had if it was enforced.
+type DryRunResult struct {
+	// ModRule is the namespace/name of the dry-run ModRule.
+	ModRule string `json:"modRule"`
+
+	// Patch is the JSON patch the ModRule would have applied.
+	Patch string `json:"patch,omitempty"`
+
+	// Rejection is the rejection message the ModRule would have produced.
+	Rejection string `json:"rejection,omitempty"`
+}
+
+// ExclusionResult describes a ModRule skipped by its exclude block.
+type ExclusionResult struct {
+	// ModRule is the namespace/name of the excluded ModRule.
+	ModRule string `json:"modRule"`
+
+	// Reason describes the exclude criterion which hit.
+	Reason string `json:"reason"`
+}
+
+// FailureResult describes an error in the evaluation of a ModRule with failurePolicy Fail.
+type FailureResult struct {
+	// ModRule is the namespace/name of the failed ModRule.
+	ModRule string `json:"modRule"`
+
+	// Error describes the evaluation error.
+	Error string `json:"error"`
+}
+
+// isIdempotencyCheck returns true if the report belongs to the second pass of an idempotency check.
+func (r *OperationReport) isIdempotencyCheck() bool {
+	return r != nil && r.idempotencyCheck
+}
+
+// addChange records a ModRule which changed the object during an idempotency check.
+func (r *OperationReport) addChange(modRule string) {
+	if r == nil {
+		return
+	}
+
+	r.changedBy = append(r.changedBy, modRule)
+}
+
+// addDryRunResult appends a dry-run result to the report.
+func (r *OperationReport) addDryRunResult(result DryRunResult) {
+	if r == nil {
+		return
+	}
+
+	r.DryRunResults = append(r.DryRunResults, result)
+}
+
+// addExclusion appends an exclusion to the report.
+func (r *OperationReport) addExclusion(exclusion ExclusionResult) {
+	if r == nil {
+		return
+	}
+
+	r.Exclusions = append(r.Exclusions, exclusion)
+}
+
+// addFailure appends a failure to the report.
+func (r *OperationReport) addFailure(failure FailureResult) {
+	if r == nil {
+		return
+	}
+
+	r.Failures = append(r.Failures, failure)
+}
+
+// addConflict appends a patch conflict to the report.
+func (r *OperationReport) addConflict(conflict PatchConflict) {
+	if r == nil {
+		return
+	}
+
+	r.Conflicts = append(r.Conflicts, conflict)
+}
+
+// isTracing returns true if the report collects an evaluation trace.
+func (r *OperationReport) isTracing() bool {
+	return r != nil && r.Trace != nil
+}
+
+// addTierTrace appends the trace of an execution tier to the report.
+func (r *OperationReport) addTierTrace(tierTrace *TierTrace) {
+	if !r.isTracing() {
+		return
+	}
+
+	r.Trace.Tiers = append(r.Trace.Tiers, tierTrace)
+}
+
+// modRuleTrace returns the trace of the given ModRule in the latest traced execution tier
+// or nil if the report does not collect a trace.
+func (r *OperationReport) modRuleTrace(mrsi *ModRuleStoreItem) *ModRuleTrace {
+	if !r.isTracing() || len(r.Trace.Tiers) == 0 {
+		return nil
+	}
+
+	for _, modRuleTrace := range r.Trace.Tiers[len(r.Trace.Tiers)-1].ModRules {
+		if modRuleTrace.ModRule == mrsi.modRule.GetNamespacedName() {
+			return modRuleTrace
+		}
+	}
+
+	return nil
+}
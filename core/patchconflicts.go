@@ -0,0 +1,336 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	evanjsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-logr/logr"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PatchConflict describes two Patch ModRules in the same execution tier which write to overlapping paths.
+// Rules in the same execution tier and with the same priority are ordered by their namespace/name only,
+// hence the outcome of such patches depends on an order which was likely not intended.
+type PatchConflict struct {
+	// ModRule is the namespace/name of the ModRule which detected the conflict.
+	ModRule string `json:"modRule"`
+
+	// Path is the write path of the ModRule.
+	Path string `json:"path"`
+
+	// ConflictingModRule is the namespace/name of the ModRule it conflicts with.
+	ConflictingModRule string `json:"conflictingModRule"`
+
+	// ConflictingPath is the write path of the conflicting ModRule.
+	ConflictingPath string `json:"conflictingPath"`
+}
+
+// String describes the conflict.
+func (c PatchConflict) String() string {
+	return fmt.Sprintf("path %s of ModRule %s overlaps with path %s of ModRule %s", c.Path, c.ModRule, c.ConflictingPath, c.ConflictingModRule)
+}
+
+// patchWrites holds the paths written by the patch a ModRule applied to an object.
+type patchWrites struct {
+	mrsi  *ModRuleStoreItem
+	paths []string
+}
+
+// FindPatchConflicts returns the conflicts between the given Patch ModRule and the Patch ModRules in the store
+// which may run in the same execution tier against the same objects.
+// The conflicts are determined statically from the paths of the patch operations - placeholders such as #0 match any path segment.
+// Merge operations do not have a static path and are only checked at the time a request is admitted.
+func (s *ModRuleStore) FindPatchConflicts(modRule *v1beta1.ModRule) []PatchConflict {
+	return s.findPatchConflicts(s.currentSnapshot(), modRule, staticWritePaths(modRule.Spec.Patch))
+}
+
+// FindStoredPatchConflicts returns the conflicts between the stored Patch ModRule with the given namespace and name
+// and the other Patch ModRules in the store, keyed by the conflicting ModRule.
+// ClusterModRules are keyed by their name and an empty namespace.
+// It returns an empty map if no such ModRule is stored.
+func (s *ModRuleStore) FindStoredPatchConflicts(modRuleNamespace string, name string) map[types.NamespacedName]PatchConflict {
+	snapshot := s.currentSnapshot()
+	conflicts := make(map[types.NamespacedName]PatchConflict)
+	modRules := snapshot.modRuleListMap[s.storeNamespace(modRuleNamespace)]
+	index := findItemIndexByName(modRules, modRuleNamespace, name)
+
+	if index == -1 {
+		return conflicts
+	}
+
+	s.forEachPatchConflict(snapshot, modRules[index].modRule, modRules[index].writePaths, func(other *v1beta1.ModRule, conflict PatchConflict) {
+		conflicts[types.NamespacedName{Namespace: other.Namespace, Name: other.Name}] = conflict
+	})
+
+	return conflicts
+}
+
+// findPatchConflicts implements FindPatchConflicts against the given snapshot of the store.
+func (s *ModRuleStore) findPatchConflicts(snapshot *modRuleStoreSnapshot, modRule *v1beta1.ModRule, writePaths []string) []PatchConflict {
+	conflicts := []PatchConflict{}
+
+	s.forEachPatchConflict(snapshot, modRule, writePaths, func(_ *v1beta1.ModRule, conflict PatchConflict) {
+		conflicts = append(conflicts, conflict)
+	})
+
+	return conflicts
+}
+
+// forEachPatchConflict calls the given function for every ModRule in the given snapshot of the store
+// whose write paths overlap with the given write paths of the given ModRule.
+func (s *ModRuleStore) forEachPatchConflict(snapshot *modRuleStoreSnapshot, modRule *v1beta1.ModRule, writePaths []string, fn func(other *v1beta1.ModRule, conflict PatchConflict)) {
+	if len(writePaths) == 0 || !isConflictCandidate(modRule) {
+		return
+	}
+
+	storeNamespace := s.storeNamespace(modRule.Namespace)
+
+	checkNamespace := func(namespace string) {
+		for _, mrsi := range snapshot.modRuleListMap[namespace] {
+			other := mrsi.modRule
+
+			if other.Namespace == modRule.Namespace && other.Name == modRule.Name {
+				continue
+			}
+
+			if !isConflictCandidate(other) || !mayRunTogether(modRule, other) {
+				continue
+			}
+
+			if path, conflictingPath, ok := findOverlappingWritePaths(writePaths, mrsi.writePaths); ok {
+				fn(other, PatchConflict{
+					ModRule:            modRule.GetNamespacedName(),
+					Path:               path,
+					ConflictingModRule: other.GetNamespacedName(),
+					ConflictingPath:    conflictingPath,
+				})
+			}
+		}
+	}
+
+	if storeNamespace == s.clusterModRulesNamespace {
+		// Cluster-wide ModRules run alongside the ModRules of any namespace.
+		for namespace := range snapshot.modRuleListMap {
+			checkNamespace(namespace)
+		}
+	} else {
+		checkNamespace(storeNamespace)
+		checkNamespace(s.clusterModRulesNamespace)
+	}
+}
+
+// detectPatchConflicts compares the paths written by the patch of the given ModRule to the paths written
+// by the ModRules which already patched the object in the same execution tier.
+// The conflicts are logged and recorded in the operation report. Conflicts involving enforced ModRules
+// with failurePolicy Fail are also recorded as failures.
+func (s *ModRuleStore) detectPatchConflicts(mrsi *ModRuleStoreItem, writePaths []string, tierWrites []patchWrites, report *OperationReport, log logr.Logger) {
+	for _, previous := range tierWrites {
+		// Rules with different priorities are ordered explicitly - their overlapping writes are intended.
+		if !haveSamePriority(mrsi.modRule, previous.mrsi.modRule) {
+			continue
+		}
+
+		path, conflictingPath, ok := findOverlappingWritePaths(writePaths, previous.paths)
+
+		if !ok {
+			continue
+		}
+
+		conflict := PatchConflict{
+			ModRule:            mrsi.modRule.GetNamespacedName(),
+			Path:               path,
+			ConflictingModRule: previous.mrsi.modRule.GetNamespacedName(),
+			ConflictingPath:    conflictingPath,
+		}
+
+		log.Info("conflicting patches in the same execution tier", "rule", conflict.ModRule, "path", conflict.Path, "conflicting rule", conflict.ConflictingModRule, "conflicting path", conflict.ConflictingPath)
+		report.addConflict(conflict)
+
+		for _, item := range []*ModRuleStoreItem{mrsi, previous.mrsi} {
+			if item.modRule.FailsClosed() && !item.modRule.IsDryRun() {
+				report.addFailure(FailureResult{ModRule: item.modRule.GetNamespacedName(), Error: conflict.String()})
+			}
+		}
+	}
+}
+
+// isConflictCandidate returns true if the given ModRule applies patches which may conflict with other ModRules.
+func isConflictCandidate(modRule *v1beta1.ModRule) bool {
+	return modRule.Spec.Type == v1beta1.ModRuleTypePatch && !modRule.IsDryRun()
+}
+
+// haveSamePriority returns true if the order of the two given ModRules is not set explicitly by their priority.
+func haveSamePriority(a *v1beta1.ModRule, b *v1beta1.ModRule) bool {
+	return a.Spec.Priority == b.Spec.Priority
+}
+
+// mayRunTogether returns true if the two given ModRules may patch the same object in the same execution tier
+// in an order which is not set explicitly by their priority.
+func mayRunTogether(a *v1beta1.ModRule, b *v1beta1.ModRule) bool {
+	if a.Spec.ExecutionTier != b.Spec.ExecutionTier || !haveSamePriority(a, b) {
+		return false
+	}
+
+	sharesOperation := false
+
+	for _, op := range a.Spec.AdmissionOperations {
+		if b.Spec.HasAdmissionOperation(op) {
+			sharesOperation = true
+			break
+		}
+	}
+
+	if !sharesOperation {
+		return false
+	}
+
+	// ModRules with no targets may patch objects of any kind.
+	if len(a.Spec.Targets) == 0 || len(b.Spec.Targets) == 0 {
+		return true
+	}
+
+	for _, ta := range a.Spec.Targets {
+		for _, tb := range b.Spec.Targets {
+			if ta.Group == tb.Group && ta.Kind == tb.Kind && (ta.Version == "" || tb.Version == "" || ta.Version == tb.Version) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// staticWritePaths returns the paths written by the given patch operations.
+// Merge operations are skipped since the paths they write to are only known once their value is rendered.
+func staticWritePaths(patch []v1beta1.PatchOperation) []string {
+	paths := []string{}
+
+	for _, po := range patch {
+		switch po.Operation {
+		case v1beta1.Merge, v1beta1.StrategicMerge, v1beta1.Test:
+			continue
+
+		case v1beta1.Move:
+			// Move operations remove their source.
+			if po.From != nil {
+				paths = append(paths, *po.From)
+			}
+		}
+
+		paths = append(paths, po.Path)
+	}
+
+	return paths
+}
+
+// writePathsFromPatch returns the paths written by the operations of the given JSON patch.
+func writePathsFromPatch(epatch evanjsonpatch.Patch) []string {
+	paths := []string{}
+
+	for _, op := range epatch {
+		kind := op.Kind()
+
+		if kind == "test" {
+			continue
+		}
+
+		if kind == "move" {
+			if from, err := op.From(); err == nil {
+				paths = append(paths, from)
+			}
+		}
+
+		if path, err := op.Path(); err == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// findOverlappingWritePaths returns the first pair of overlapping paths from the two given lists of write paths.
+func findOverlappingWritePaths(paths []string, otherPaths []string) (string, string, bool) {
+	for _, path := range paths {
+		for _, otherPath := range otherPaths {
+			if writePathsOverlap(path, otherPath) {
+				return path, otherPath, true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// writePathsOverlap returns true if one of the given JSON pointers points inside the other one.
+// Placeholders such as #0 match any segment. Appends to the end of an array (segment "-")
+// do not overlap with each other since they never write to the same element.
+// Negative indices such as "-1" address existing elements counting from the end of the array, hence they are not appends -
+// since the length of the array is not known, they may address the same element as any other index.
+func writePathsOverlap(a string, b string) bool {
+	segmentsA := strings.Split(a, "/")
+	segmentsB := strings.Split(b, "/")
+
+	n := len(segmentsA)
+	if len(segmentsB) < n {
+		n = len(segmentsB)
+	}
+
+	for i := 0; i < n; i++ {
+		if !pathSegmentsOverlap(segmentsA[i], segmentsB[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pathSegmentsOverlap returns true if two JSON pointer segments may refer to the same member or element.
+func pathSegmentsOverlap(a string, b string) bool {
+	if isAppendSegment(a) || isAppendSegment(b) {
+		return false
+	}
+
+	if rexPathTemplatePlaceholder.MatchString(a) || rexPathTemplatePlaceholder.MatchString(b) {
+		return true
+	}
+
+	if (isNegativeIndexSegment(a) && isIndexSegment(b)) || (isNegativeIndexSegment(b) && isIndexSegment(a)) {
+		return true
+	}
+
+	return a == b
+}
+
+// isAppendSegment returns true if the given JSON pointer segment refers to the position past the end of an array.
+func isAppendSegment(segment string) bool {
+	return segment == "-"
+}
+
+// isIndexSegment returns true if the given JSON pointer segment is an array index, including negative ones.
+func isIndexSegment(segment string) bool {
+	_, err := strconv.Atoi(segment)
+	return err == nil
+}
+
+// isNegativeIndexSegment returns true if the given JSON pointer segment is a negative array index.
+func isNegativeIndexSegment(segment string) bool {
+	index, err := strconv.Atoi(segment)
+	return err == nil && index < 0
+}
@@ -0,0 +1,108 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// PatchConflictWebhookHandler is the entrypoint to KubeMod's validating admission webhook which checks new and updated
+// ModRules and ClusterModRules for patch conflicts with the ModRules in the same execution tier.
+// Conflicts are reported as admission warnings - ModRules with failurePolicy Fail which conflict with other ModRules are rejected.
+type PatchConflictWebhookHandler struct {
+	log          logr.Logger
+	modRuleStore *ModRuleStore
+}
+
+// NewPatchConflictWebhookHandler constructs a new patch conflict webhook handler.
+func NewPatchConflictWebhookHandler(modRuleStore *ModRuleStore, log logr.Logger) *PatchConflictWebhookHandler {
+	return &PatchConflictWebhookHandler{
+		log:          log.WithName("patchconflict-webhook"),
+		modRuleStore: modRuleStore,
+	}
+}
+
+// Handle checks the admitted ModRule or ClusterModRule for patch conflicts.
+func (h *PatchConflictWebhookHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := h.log.WithValues("request uid", req.UID, "namespace", req.Namespace, "resource", fmt.Sprintf("%v/%v", req.Resource.Resource, req.Name), "operation", req.Operation)
+
+	modRule, err := decodeAdmittedModRule(&req)
+
+	if err != nil {
+		// Malformed ModRules are rejected by the regular validating webhooks.
+		log.Error(err, "Failed to decode ModRule")
+		return admission.Allowed("failed to decode ModRule")
+	}
+
+	conflicts := h.modRuleStore.FindPatchConflicts(modRule)
+
+	if len(conflicts) == 0 {
+		return admission.Allowed("no patch conflicts")
+	}
+
+	messages := make([]string, len(conflicts))
+
+	for i, conflict := range conflicts {
+		messages[i] = conflict.String()
+	}
+
+	log.Info("ModRule patch conflicts with ModRules in the same execution tier", "conflicts", messages)
+
+	if modRule.FailsClosed() {
+		return admission.Denied(fmt.Sprintf("ModRule patch conflicts with ModRules in the same execution tier: %s", strings.Join(messages, "; ")))
+	}
+
+	AddAdmissionWarnings(ctx, messages...)
+
+	return admission.Allowed("patch conflicts reported as warnings")
+}
+
+// decodeAdmittedModRule decodes the ModRule or ClusterModRule of an admission request as a ModRule.
+// ClusterModRules are decoded as ModRules with an empty namespace.
+func decodeAdmittedModRule(req *admission.Request) (*v1beta1.ModRule, error) {
+	if req.Kind.Kind == "ClusterModRule" {
+		clusterModRule := &v1beta1.ClusterModRule{}
+
+		if err := json.Unmarshal(req.Object.Raw, clusterModRule); err != nil {
+			return nil, err
+		}
+
+		clusterModRule.Default()
+
+		return clusterModRule.AsModRule(), nil
+	}
+
+	modRule := &v1beta1.ModRule{}
+
+	if err := json.Unmarshal(req.Object.Raw, modRule); err != nil {
+		return nil, err
+	}
+
+	modRule.Default()
+
+	// The namespace of new objects may be missing from their manifest.
+	if modRule.Namespace == "" {
+		modRule.Namespace = req.Namespace
+	}
+
+	return modRule, nil
+}
@@ -0,0 +1,365 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	ctrljsonpatch "gomodules.xyz/jsonpatch/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// generatedModRuleAnnotation holds the namespace/name of the ModRule which generated a resource.
+	generatedModRuleAnnotation = "generate.kubemod.io/modrule"
+	// generatedTriggerAnnotation holds the kind, namespace and name of the resource whose admission triggered the generation.
+	generatedTriggerAnnotation = "generate.kubemod.io/trigger"
+	// generatedTriggerUIDLabel holds the UID of the resource whose admission triggered the generation.
+	generatedTriggerUIDLabel = "generate.kubemod.io/trigger-uid"
+	// generatedTriggerRequestLabel holds the UID of the admission request which created a trigger resource with no name.
+	generatedTriggerRequestLabel = "generate.kubemod.io/trigger-request"
+
+	// The field manager used by KubeMod when synchronizing generated resources.
+	generatorFieldManager = "kubemod"
+
+	// The number of times the generation of a resource is retried before it is given up on.
+	generatorMaxRetries = 8
+)
+
+// GeneratedResourceTrigger identifies the resource whose admission triggered the generation of companion resources.
+type GeneratedResourceTrigger struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	UID        types.UID
+	// RequestUID is the UID of the admission request which created the trigger.
+	// It is only set for triggers with no name (such as resources named by generateName), which are labeled with it.
+	RequestUID types.UID
+}
+
+// GeneratedResource is a companion resource rendered by a Generate ModRule.
+type GeneratedResource struct {
+	// Object is the rendered manifest of the resource.
+	Object *unstructured.Unstructured
+	// Synchronize indicates that an existing resource should be overwritten with Object.
+	Synchronize bool
+	// Trigger is the resource whose admission triggered the generation.
+	Trigger GeneratedResourceTrigger
+	// ScopeNamespace is the only namespace the resource may be generated in.
+	// It is empty if the ModRule which rendered the resource may generate cluster-scoped resources and resources in any namespace.
+	ScopeNamespace string
+}
+
+// errGenerateOutOfScope is returned for resources which the ModRule that rendered them is not allowed to generate.
+// Such resources are not retried.
+var errGenerateOutOfScope = errors.New("resource is out of the scope of the ModRule which generated it")
+
+// ResourceGenerator creates the companion resources rendered by Generate ModRules.
+// Resources are created asynchronously, outside of the admission request which triggered them.
+type ResourceGenerator struct {
+	client     client.Client
+	restMapper meta.RESTMapper
+	queue      workqueue.RateLimitingInterface
+	log        logr.Logger
+}
+
+// NewResourceGenerator instantiates a new ResourceGenerator.
+func NewResourceGenerator(manager manager.Manager, log logr.Logger) *ResourceGenerator {
+	return &ResourceGenerator{
+		client:     manager.GetClient(),
+		restMapper: manager.GetRESTMapper(),
+		queue:      workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(100*time.Millisecond, 10*time.Second)),
+		log:        log.WithName("resource-generator"),
+	}
+}
+
+// newGeneratedResourceTrigger extracts the identity of the trigger resource from the given unmarshalled JSON object.
+func newGeneratedResourceTrigger(namespace string, jsonv interface{}) GeneratedResourceTrigger {
+	trigger := GeneratedResourceTrigger{Namespace: namespace}
+	trigger.APIVersion, _ = getValueFromJSONObject(jsonv, "apiVersion").(string)
+	trigger.Kind, _ = getValueFromJSONObject(jsonv, "kind").(string)
+	trigger.Name, _ = getValueFromJSONObject(jsonv, "metadata:name").(string)
+
+	if uid, ok := getValueFromJSONObject(jsonv, "metadata:uid").(string); ok {
+		trigger.UID = types.UID(uid)
+	}
+
+	return trigger
+}
+
+// newGeneratedResource ties the given rendered object back to the ModRule and the trigger resource which generated it.
+// If scopeNamespace is not empty, the object may only be generated as a namespaced resource in that namespace.
+func newGeneratedResource(object *unstructured.Unstructured, modRule *v1beta1.ModRule, synchronize bool, trigger GeneratedResourceTrigger, scopeNamespace string) *GeneratedResource {
+	annotations := object.GetAnnotations()
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[generatedModRuleAnnotation] = modRule.GetNamespacedName()
+	annotations[generatedTriggerAnnotation] = trigger.String()
+	object.SetAnnotations(annotations)
+
+	if trigger.UID != "" {
+		setGeneratedTriggerUIDLabel(object, trigger.UID)
+	}
+
+	return &GeneratedResource{
+		Object:         object,
+		Synchronize:    synchronize,
+		Trigger:        trigger,
+		ScopeNamespace: scopeNamespace,
+	}
+}
+
+// setGeneratedTriggerUIDLabel labels the given object with the UID of its trigger resource.
+func setGeneratedTriggerUIDLabel(object *unstructured.Unstructured, uid types.UID) {
+	labels := object.GetLabels()
+
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+
+	labels[generatedTriggerUIDLabel] = string(uid)
+	object.SetLabels(labels)
+}
+
+// labelUnnamedTrigger labels the given trigger resource with the UID of the admission request which created it if the trigger has no name.
+// The label allows the resource generator to find the trigger once it is persisted and named.
+// It returns the patch operations which apply the label, and records the request UID in the trigger of each of the given resources.
+func labelUnnamedTrigger(jsonv interface{}, requestUID types.UID, resources []*GeneratedResource) []ctrljsonpatch.JsonPatchOperation {
+	if len(resources) == 0 || resources[0].Trigger.Name != "" || requestUID == "" {
+		return nil
+	}
+
+	for _, resource := range resources {
+		resource.Trigger.RequestUID = requestUID
+	}
+
+	if _, ok := getValueFromJSONObject(jsonv, "metadata:labels").(map[string]interface{}); ok {
+		return []ctrljsonpatch.JsonPatchOperation{
+			{Operation: "add", Path: "/metadata/labels/" + strings.ReplaceAll(generatedTriggerRequestLabel, "/", "~1"), Value: string(requestUID)},
+		}
+	}
+
+	return []ctrljsonpatch.JsonPatchOperation{
+		{Operation: "add", Path: "/metadata/labels", Value: map[string]interface{}{generatedTriggerRequestLabel: string(requestUID)}},
+	}
+}
+
+// String returns the kind, namespace and name of the trigger resource.
+func (t GeneratedResourceTrigger) String() string {
+	if t.Namespace == "" {
+		return fmt.Sprintf("%s/%s", t.Kind, t.Name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", t.Kind, t.Namespace, t.Name)
+}
+
+// Enqueue schedules the creation of the given resources.
+func (g *ResourceGenerator) Enqueue(resources ...*GeneratedResource) {
+	for _, resource := range resources {
+		g.queue.Add(resource)
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+// Every replica of the operator serves admission requests, hence every replica must process the resources it has rendered.
+func (g *ResourceGenerator) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+// It creates the enqueued resources until the stop channel is closed.
+func (g *ResourceGenerator) Start(stop <-chan struct{}) error {
+	go func() {
+		<-stop
+		g.queue.ShutDown()
+	}()
+
+	for g.processNextItem() {
+	}
+
+	return nil
+}
+
+// processNextItem creates the next resource in the queue.
+// Failed resources are retried with exponential back-off up to generatorMaxRetries times, then dropped.
+// In particular, resources whose trigger is never persisted (for example, because its admission was denied later on) are dropped
+// rather than being left behind with no owner.
+// It returns false when the queue has been shut down.
+func (g *ResourceGenerator) processNextItem() bool {
+	item, shutdown := g.queue.Get()
+
+	if shutdown {
+		return false
+	}
+
+	defer g.queue.Done(item)
+
+	resource := item.(*GeneratedResource)
+	lastAttempt := g.queue.NumRequeues(item) >= generatorMaxRetries
+	log := g.log.WithValues("resource", fmt.Sprintf("%s/%s", resource.Object.GetKind(), resource.Object.GetName()), "trigger", resource.Trigger.String())
+
+	if err := g.generate(context.Background(), resource); err != nil {
+		if !lastAttempt && !errors.Is(err, errGenerateOutOfScope) {
+			log.V(1).Info("failed to generate resource - will retry", "error", err.Error())
+			g.queue.AddRateLimited(item)
+			return true
+		}
+
+		log.Error(err, "failed to generate resource - dropping it")
+	} else {
+		log.V(1).Info("generated resource")
+	}
+
+	g.queue.Forget(item)
+	return true
+}
+
+// +kubebuilder:rbac:groups=*,resources=*,verbs=get;create;patch
+
+// generate creates or synchronizes the given resource.
+// The resource is owned by its trigger whenever Kubernetes allows it.
+// Since resources are generated at admission time, the trigger may not be persisted yet - in which case an error is returned
+// and the resource is not generated.
+func (g *ResourceGenerator) generate(ctx context.Context, resource *GeneratedResource) error {
+	object := resource.Object.DeepCopy()
+	gvk := object.GroupVersionKind()
+	mapping, err := g.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+
+	if err != nil {
+		return err
+	}
+
+	namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+
+	if !namespaced {
+		object.SetNamespace("")
+	} else if object.GetNamespace() == "" {
+		object.SetNamespace(resource.Trigger.Namespace)
+	}
+
+	// The operator creates resources with its own permissions - make sure namespaced ModRules do not reach beyond their namespace
+	// and do not grant permissions their authors may not have.
+	if resource.ScopeNamespace != "" {
+		if !namespaced {
+			return fmt.Errorf("%w: %s is cluster-scoped and can only be generated by ClusterModRules", errGenerateOutOfScope, gvk.Kind)
+		}
+
+		if object.GetNamespace() != resource.ScopeNamespace {
+			return fmt.Errorf("%w: the resource can only be generated in namespace %s, not in %s", errGenerateOutOfScope, resource.ScopeNamespace, object.GetNamespace())
+		}
+
+		secretType, _, _ := unstructured.NestedString(object.Object, "type")
+
+		if v1beta1.IsPrivilegedGeneratedResource(gvk.GroupKind(), secretType) {
+			return fmt.Errorf("%w: %s grants permissions or credentials and can only be generated by ClusterModRules", errGenerateOutOfScope, gvk.Kind)
+		}
+	}
+
+	trigger, err := g.resolveTrigger(ctx, resource.Trigger)
+
+	if err != nil {
+		return err
+	}
+
+	// The trigger annotation and label are refreshed since the trigger may not have had a name or UID when it was admitted.
+	annotations := object.GetAnnotations()
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[generatedTriggerAnnotation] = trigger.String()
+	object.SetAnnotations(annotations)
+	setGeneratedTriggerUIDLabel(object, trigger.UID)
+
+	// Cluster-scoped triggers can own any resource, while namespaced triggers can only own resources in their own namespace.
+	if trigger.Namespace == "" || (namespaced && trigger.Namespace == object.GetNamespace()) {
+		object.SetOwnerReferences(append(object.GetOwnerReferences(), metav1.OwnerReference{
+			APIVersion: trigger.APIVersion,
+			Kind:       trigger.Kind,
+			Name:       trigger.Name,
+			UID:        trigger.UID,
+		}))
+	}
+
+	if resource.Synchronize {
+		return g.client.Patch(ctx, object, client.Apply, client.FieldOwner(generatorFieldManager), client.ForceOwnership)
+	}
+
+	if err := g.client.Create(ctx, object); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
+
+// resolveTrigger returns the given trigger resource with the name and UID it has been persisted with.
+// Triggers of CREATE requests have no UID until they are persisted, so they are looked up in the cluster.
+// Triggers with no name (such as resources named by generateName) are looked up by the admission request label applied to them.
+func (g *ResourceGenerator) resolveTrigger(ctx context.Context, trigger GeneratedResourceTrigger) (GeneratedResourceTrigger, error) {
+	if trigger.UID != "" {
+		return trigger, nil
+	}
+
+	gvk := schema.FromAPIVersionAndKind(trigger.APIVersion, trigger.Kind)
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+
+	switch {
+	case trigger.Name != "":
+		if err := g.client.Get(ctx, types.NamespacedName{Namespace: trigger.Namespace, Name: trigger.Name}, object); err != nil {
+			return trigger, fmt.Errorf("failed to look up trigger %s: %v", trigger.String(), err)
+		}
+
+	case trigger.RequestUID != "":
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+
+		if err := g.client.List(ctx, list, client.InNamespace(trigger.Namespace), client.MatchingLabels{generatedTriggerRequestLabel: string(trigger.RequestUID)}); err != nil {
+			return trigger, fmt.Errorf("failed to look up trigger %s: %v", trigger.String(), err)
+		}
+
+		if len(list.Items) == 0 {
+			return trigger, fmt.Errorf("trigger %s created by admission request %s has not been persisted", trigger.String(), trigger.RequestUID)
+		}
+
+		object = &list.Items[0]
+
+	default:
+		return trigger, fmt.Errorf("trigger %s has no name and cannot be looked up", trigger.String())
+	}
+
+	trigger.Name = object.GetName()
+	trigger.UID = object.GetUID()
+	return trigger, nil
+}
@@ -23,11 +23,22 @@ type PatchTemplateContext struct {
 	// Target hosts the data of the resource being patched.
 	Target interface{}
 
+	// Admission hosts the context of the admission request - userInfo, dryRun, subResource and kind.
+	// It is nil when the resource is not evaluated as part of an admission request.
+	Admission interface{}
+
+	// OldObject hosts the data of the resource before the update in UPDATE admission requests.
+	// It is nil for all other operations.
+	OldObject interface{}
+
 	// SelectKeyParts contains the indexes collected from the patch select operation.
 	SelectKeyParts []interface{}
 
 	// SelectedItem is a reference to the current item resulting from executing the select expression.
 	SelectedItem interface{}
+	// ValueFrom is the data resolved from the valueFrom source of the current patch operation.
+	// It is empty for patch operations with no valueFrom.
+	ValueFrom string
 }
 
 // RejectTemplateContext is an internal structure which is passed as context to all reject template executions.
@@ -38,4 +49,30 @@ type RejectTemplateContext struct {
 
 	// Target hosts the data of the resource being patched.
 	Target interface{}
+
+	// Admission hosts the context of the admission request - userInfo, dryRun, subResource and kind.
+	// It is nil when the resource is not evaluated as part of an admission request.
+	Admission interface{}
+
+	// OldObject hosts the data of the resource before the update in UPDATE admission requests.
+	// It is nil for all other operations.
+	OldObject interface{}
+}
+
+// GenerateTemplateContext is an internal structure which is passed as context to all generate template executions.
+type GenerateTemplateContext struct {
+
+	// Namespace is the namespace of the resource which triggered the generation.
+	Namespace string
+
+	// Target hosts the data of the resource which triggered the generation.
+	Target interface{}
+
+	// Admission hosts the context of the admission request - userInfo, dryRun, subResource and kind.
+	// It is nil when the resource is not evaluated as part of an admission request.
+	Admission interface{}
+
+	// OldObject hosts the data of the resource before the update in UPDATE admission requests.
+	// It is nil for all other operations.
+	OldObject interface{}
 }
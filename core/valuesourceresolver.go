@@ -0,0 +1,467 @@
+/*
+Licensed under the BSD 3-Clause License (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://opensource.org/licenses/BSD-3-Clause
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/kubemod/kubemod/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// valueSourceSyncTimeout is how long reads of watched ConfigMaps and Secrets wait for their informer to sync
+// before falling back to reading them from the API server.
+const valueSourceSyncTimeout = 5 * time.Second
+
+// ValueSourceResolver resolves the ConfigMap and Secret keys referenced by the valueFrom field of patch operations.
+type ValueSourceResolver interface {
+	// ResolveValueSource returns the data referenced by the given value source on behalf of a ModRule in the given namespace.
+	// An empty namespace stands for a ClusterModRule.
+	ResolveValueSource(namespace string, valueFrom *v1beta1.PatchValueSource) (string, error)
+}
+
+// KubernetesValueSourceResolver resolves value sources by reading ConfigMaps and Secrets.
+// Instead of caching all ConfigMaps and Secrets of the cluster, it watches only the objects referenced by the tracked ModRules -
+// each of them individually - and notifies the ModRules which reference an object whenever the object changes.
+// References which are not tracked are read straight from the API server.
+type KubernetesValueSourceResolver struct {
+	reader                   client.Reader
+	clientset                kubernetes.Interface
+	clusterModRulesNamespace string
+	syncTimeout              time.Duration
+	log                      logr.Logger
+
+	lock                 sync.Mutex
+	watches              map[valueSourceRef]*valueSourceWatch
+	modRuleRefs          map[types.NamespacedName][]valueSourceRef
+	modRuleEvents        chan event.GenericEvent
+	clusterModRuleEvents chan event.GenericEvent
+}
+
+// valueSourceRef identifies a ConfigMap or Secret referenced by the valueFrom field of patch operations.
+type valueSourceRef struct {
+	secret    bool
+	namespace string
+	name      string
+}
+
+// valueSourceWatch is the single-object informer of a referenced ConfigMap or Secret,
+// along with the ModRules which reference it.
+type valueSourceWatch struct {
+	informer cache.SharedIndexInformer
+	stop     chan struct{}
+	modRules map[types.NamespacedName]struct{}
+}
+
+// UnavailableValueSourceResolver is used in contexts where value sources cannot be resolved, such as the web app.
+type UnavailableValueSourceResolver struct{}
+
+// NewKubernetesValueSourceResolver instantiates a new KubernetesValueSourceResolver.
+func NewKubernetesValueSourceResolver(manager manager.Manager, clusterModRulesNamespace ClusterModRulesNamespace, log logr.Logger) (*KubernetesValueSourceResolver, error) {
+	clientset, err := kubernetes.NewForConfig(manager.GetConfig())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newKubernetesValueSourceResolver(manager.GetAPIReader(), clientset, string(clusterModRulesNamespace), log), nil
+}
+
+// newKubernetesValueSourceResolver instantiates a new KubernetesValueSourceResolver with the given clients.
+func newKubernetesValueSourceResolver(reader client.Reader, clientset kubernetes.Interface, clusterModRulesNamespace string, log logr.Logger) *KubernetesValueSourceResolver {
+	return &KubernetesValueSourceResolver{
+		reader:                   reader,
+		clientset:                clientset,
+		clusterModRulesNamespace: clusterModRulesNamespace,
+		syncTimeout:              valueSourceSyncTimeout,
+		log:                      log.WithName("core").WithName("value-sources"),
+		watches:                  make(map[valueSourceRef]*valueSourceWatch),
+		modRuleRefs:              make(map[types.NamespacedName][]valueSourceRef),
+		modRuleEvents:            make(chan event.GenericEvent),
+		clusterModRuleEvents:     make(chan event.GenericEvent),
+	}
+}
+
+// NewUnavailableValueSourceResolver instantiates a new UnavailableValueSourceResolver.
+func NewUnavailableValueSourceResolver() *UnavailableValueSourceResolver {
+	return &UnavailableValueSourceResolver{}
+}
+
+// ModRuleEvents returns the channel which receives a generic event for every ModRule whose referenced ConfigMaps or Secrets have changed.
+func (r *KubernetesValueSourceResolver) ModRuleEvents() <-chan event.GenericEvent {
+	return r.modRuleEvents
+}
+
+// ClusterModRuleEvents returns the channel which receives a generic event for every ClusterModRule whose referenced ConfigMaps or Secrets have changed.
+func (r *KubernetesValueSourceResolver) ClusterModRuleEvents() <-chan event.GenericEvent {
+	return r.clusterModRuleEvents
+}
+
+// Track starts watching the ConfigMaps and Secrets referenced by the given patch of the ModRule identified by the given key
+// and stops watching the ones the ModRule no longer references.
+// Keys with an empty namespace identify ClusterModRules.
+// Track must be called before the ModRule is compiled, so that its references are resolved from the watches.
+func (r *KubernetesValueSourceResolver) Track(modRule types.NamespacedName, patch []v1beta1.PatchOperation) {
+	refs := r.valueSourceRefs(modRule.Namespace, patch)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, ref := range refs {
+		w, ok := r.watches[ref]
+
+		if !ok {
+			w = r.startWatch(ref)
+			r.watches[ref] = w
+		}
+
+		w.modRules[modRule] = struct{}{}
+	}
+
+	for _, ref := range r.modRuleRefs[modRule] {
+		if !containsValueSourceRef(refs, ref) {
+			r.releaseWatch(ref, modRule)
+		}
+	}
+
+	if len(refs) > 0 {
+		r.modRuleRefs[modRule] = refs
+	} else {
+		delete(r.modRuleRefs, modRule)
+	}
+}
+
+// Untrack stops watching the ConfigMaps and Secrets referenced by the deleted ModRule identified by the given key.
+func (r *KubernetesValueSourceResolver) Untrack(modRule types.NamespacedName) {
+	r.Track(modRule, nil)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+// Every replica of the operator compiles the ModRules, hence every replica must watch their value sources.
+func (r *KubernetesValueSourceResolver) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+// It stops all watches once the stop channel is closed.
+func (r *KubernetesValueSourceResolver) Start(stop <-chan struct{}) error {
+	<-stop
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for ref, w := range r.watches {
+		close(w.stop)
+		delete(r.watches, ref)
+	}
+
+	return nil
+}
+
+// ResolveValueSource returns the data referenced by the given value source.
+// Missing objects and keys result in an error, unless the reference is marked as optional, in which case the data is empty.
+// Secrets can only be referenced by ClusterModRules - otherwise anyone allowed to deploy a ModRule to a namespace
+// could read the Secrets of the namespace through the ModRule's patch, even without having access to them.
+func (r *KubernetesValueSourceResolver) ResolveValueSource(namespace string, valueFrom *v1beta1.PatchValueSource) (string, error) {
+	if valueFrom.SecretKeyRef != nil && namespace != "" {
+		return "", errors.New("secretKeyRef is only supported by ClusterModRules")
+	}
+
+	// ClusterModRules source their values from the KubeMod namespace.
+	if namespace == "" {
+		namespace = r.clusterModRulesNamespace
+	}
+
+	switch {
+	case valueFrom.ConfigMapKeyRef != nil:
+		ref := valueFrom.ConfigMapKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		configMap := corev1.ConfigMap{}
+
+		if err := r.get(valueSourceRef{namespace: namespace, name: ref.Name}, &configMap); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", nil
+			}
+
+			return "", fmt.Errorf("failed to get ConfigMap %s/%s: %v", namespace, ref.Name, err)
+		}
+
+		if value, ok := configMap.Data[ref.Key]; ok {
+			return value, nil
+		}
+
+		if value, ok := configMap.BinaryData[ref.Key]; ok {
+			return string(value), nil
+		}
+
+		if optional {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("key %s not found in ConfigMap %s/%s", ref.Key, namespace, ref.Name)
+
+	case valueFrom.SecretKeyRef != nil:
+		ref := valueFrom.SecretKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		secret := corev1.Secret{}
+
+		if err := r.get(valueSourceRef{secret: true, namespace: namespace, name: ref.Name}, &secret); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", nil
+			}
+
+			return "", fmt.Errorf("failed to get Secret %s/%s: %v", namespace, ref.Name, err)
+		}
+
+		if value, ok := secret.Data[ref.Key]; ok {
+			return string(value), nil
+		}
+
+		if optional {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("key %s not found in Secret %s/%s", ref.Key, namespace, ref.Name)
+	}
+
+	return "", errors.New("valueFrom must reference either a ConfigMap key or a Secret key")
+}
+
+// get reads the referenced ConfigMap or Secret into the given object.
+// Watched objects are read from their informer, once it has synced. Other objects are read from the API server.
+// Objects whose informer does not sync within the sync timeout (for example, because the operator cannot watch them)
+// are read from the API server as well, so that compiling a ModRule never blocks indefinitely.
+func (r *KubernetesValueSourceResolver) get(ref valueSourceRef, obj runtime.Object) error {
+	r.lock.Lock()
+	w := r.watches[ref]
+	r.lock.Unlock()
+
+	if w == nil || !r.waitForSync(w) {
+		return r.reader.Get(context.Background(), types.NamespacedName{Namespace: ref.namespace, Name: ref.name}, obj)
+	}
+
+	item, exists, err := w.informer.GetStore().GetByKey(ref.namespace + "/" + ref.name)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return apierrors.NewNotFound(ref.groupResource(), ref.name)
+	}
+
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		item.(*corev1.ConfigMap).DeepCopyInto(o)
+	case *corev1.Secret:
+		item.(*corev1.Secret).DeepCopyInto(o)
+	}
+
+	return nil
+}
+
+// waitForSync waits for the informer of the given watch to sync.
+// It returns false if the informer has not synced within the sync timeout or if the watch is stopped in the meantime.
+func (r *KubernetesValueSourceResolver) waitForSync(w *valueSourceWatch) bool {
+	timeout := time.NewTimer(r.syncTimeout)
+	defer timeout.Stop()
+
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+
+	for !w.informer.HasSynced() {
+		select {
+		case <-w.stop:
+			return false
+		case <-timeout.C:
+			return false
+		case <-poll.C:
+		}
+	}
+
+	return true
+}
+
+// valueSourceRefs returns the ConfigMaps and Secrets referenced by the given patch of a ModRule in the given namespace.
+// An empty namespace stands for a ClusterModRule. Secrets referenced by namespaced ModRules are not resolved, hence not returned.
+func (r *KubernetesValueSourceResolver) valueSourceRefs(namespace string, patch []v1beta1.PatchOperation) []valueSourceRef {
+	var refs []valueSourceRef
+	refNamespace := namespace
+
+	if refNamespace == "" {
+		refNamespace = r.clusterModRulesNamespace
+	}
+
+	for _, po := range patch {
+		var ref valueSourceRef
+
+		switch {
+		case po.ValueFrom == nil:
+			continue
+		case po.ValueFrom.ConfigMapKeyRef != nil:
+			ref = valueSourceRef{namespace: refNamespace, name: po.ValueFrom.ConfigMapKeyRef.Name}
+		case po.ValueFrom.SecretKeyRef != nil && namespace == "":
+			ref = valueSourceRef{secret: true, namespace: refNamespace, name: po.ValueFrom.SecretKeyRef.Name}
+		default:
+			continue
+		}
+
+		if !containsValueSourceRef(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+// startWatch starts an informer which watches the single object identified by the given reference.
+// The caller must hold the lock.
+func (r *KubernetesValueSourceResolver) startWatch(ref valueSourceRef) *valueSourceWatch {
+	nameSelector := fields.OneTermEqualSelector("metadata.name", ref.name).String()
+	listWatch := &cache.ListWatch{}
+	var objectType runtime.Object
+
+	if ref.secret {
+		objectType = &corev1.Secret{}
+		listWatch.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = nameSelector
+			return r.clientset.CoreV1().Secrets(ref.namespace).List(context.Background(), options)
+		}
+		listWatch.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = nameSelector
+			return r.clientset.CoreV1().Secrets(ref.namespace).Watch(context.Background(), options)
+		}
+	} else {
+		objectType = &corev1.ConfigMap{}
+		listWatch.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = nameSelector
+			return r.clientset.CoreV1().ConfigMaps(ref.namespace).List(context.Background(), options)
+		}
+		listWatch.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = nameSelector
+			return r.clientset.CoreV1().ConfigMaps(ref.namespace).Watch(context.Background(), options)
+		}
+	}
+
+	w := &valueSourceWatch{
+		informer: cache.NewSharedIndexInformer(listWatch, objectType, 0, cache.Indexers{}),
+		stop:     make(chan struct{}),
+		modRules: make(map[types.NamespacedName]struct{}),
+	}
+
+	// The initial listing of the object is reported as an addition, too - the ModRules are compiled once more, which is harmless.
+	w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { r.notify(ref, w) },
+		UpdateFunc: func(interface{}, interface{}) { r.notify(ref, w) },
+		DeleteFunc: func(interface{}) { r.notify(ref, w) },
+	})
+
+	go w.informer.Run(w.stop)
+
+	r.log.V(1).Info("started watching value source", "secret", ref.secret, "namespace", ref.namespace, "name", ref.name)
+
+	return w
+}
+
+// releaseWatch removes the given ModRule from the watch of the given reference and stops the watch if no other ModRule references the object.
+// The caller must hold the lock.
+func (r *KubernetesValueSourceResolver) releaseWatch(ref valueSourceRef, modRule types.NamespacedName) {
+	w, ok := r.watches[ref]
+
+	if !ok {
+		return
+	}
+
+	delete(w.modRules, modRule)
+
+	if len(w.modRules) == 0 {
+		close(w.stop)
+		delete(r.watches, ref)
+		r.log.V(1).Info("stopped watching value source", "secret", ref.secret, "namespace", ref.namespace, "name", ref.name)
+	}
+}
+
+// notify sends a generic event for each ModRule which references the object watched by the given watch.
+func (r *KubernetesValueSourceResolver) notify(ref valueSourceRef, w *valueSourceWatch) {
+	r.lock.Lock()
+	modRules := make([]types.NamespacedName, 0, len(w.modRules))
+
+	for modRule := range w.modRules {
+		modRules = append(modRules, modRule)
+	}
+	r.lock.Unlock()
+
+	for _, modRule := range modRules {
+		meta := metav1.ObjectMeta{Namespace: modRule.Namespace, Name: modRule.Name}
+
+		if modRule.Namespace == "" {
+			object := &v1beta1.ClusterModRule{ObjectMeta: meta}
+			r.send(r.clusterModRuleEvents, event.GenericEvent{Meta: object, Object: object}, w)
+		} else {
+			object := &v1beta1.ModRule{ObjectMeta: meta}
+			r.send(r.modRuleEvents, event.GenericEvent{Meta: object, Object: object}, w)
+		}
+	}
+}
+
+// send sends the given event to the given channel unless the given watch is stopped in the meantime.
+func (r *KubernetesValueSourceResolver) send(events chan<- event.GenericEvent, e event.GenericEvent, w *valueSourceWatch) {
+	select {
+	case events <- e:
+	case <-w.stop:
+	}
+}
+
+// groupResource returns the group/resource of the referenced object.
+func (ref valueSourceRef) groupResource() schema.GroupResource {
+	if ref.secret {
+		return corev1.Resource("secrets")
+	}
+
+	return corev1.Resource("configmaps")
+}
+
+// containsValueSourceRef returns true if the given slice contains the given reference.
+func containsValueSourceRef(refs []valueSourceRef, ref valueSourceRef) bool {
+	for _, r := range refs {
+		if r == ref {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveValueSource always fails.
+func (r *UnavailableValueSourceResolver) ResolveValueSource(namespace string, valueFrom *v1beta1.PatchValueSource) (string, error) {
+	return "", errors.New("valueFrom is not supported in this context")
+}
@@ -95,7 +95,10 @@ func InitializeModRuleStoreTestBed(clusterModRulesNamespace ClusterModRulesNames
 		NewModRuleStoreTestBed,
 		NewTestLogger,
 		expressions.NewKubeModJSONPathLanguage,
+		NewUnavailableValueSourceResolver,
+		wire.Bind(new(ValueSourceResolver), new(*UnavailableValueSourceResolver)),
 		NewModRuleStoreItemFactory,
+		NewNamespaceLabelCache,
 		NewModRuleStore,
 	)
 
@@ -111,7 +114,10 @@ func InitializeDragnetWebhookHandlerTestBed(clusterModRulesNamespace ClusterModR
 		NewK8sMockClient,
 		NewTestLogger,
 		expressions.NewKubeModJSONPathLanguage,
+		NewUnavailableValueSourceResolver,
+		wire.Bind(new(ValueSourceResolver), new(*UnavailableValueSourceResolver)),
 		NewModRuleStoreItemFactory,
+		NewNamespaceLabelCache,
 		NewModRuleStore,
 	)
 
@@ -124,6 +130,8 @@ func InitializeModRuleStoreItemTestBed(tLogger util.TLogger) *ModRuleStoreItemTe
 		NewModRuleStoreItemTestBed,
 		NewTestLogger,
 		expressions.NewKubeModJSONPathLanguage,
+		NewUnavailableValueSourceResolver,
+		wire.Bind(new(ValueSourceResolver), new(*UnavailableValueSourceResolver)),
 		NewModRuleStoreItemFactory,
 	)
 
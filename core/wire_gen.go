@@ -19,9 +19,11 @@ import (
 // InitializeModRuleStoreTestBed instructs wire how to construct a new test bed.
 func InitializeModRuleStoreTestBed(clusterModRulesNamespace ClusterModRulesNamespace, tLogger util.TLogger) *ModRuleStoreTestBed {
 	language := expressions.NewKubeModJSONPathLanguage()
+	unavailableValueSourceResolver := NewUnavailableValueSourceResolver()
 	logger := NewTestLogger(tLogger)
-	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, logger)
-	modRuleStore := NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, logger)
+	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, unavailableValueSourceResolver, logger)
+	namespaceLabelCache := NewNamespaceLabelCache()
+	modRuleStore := NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, namespaceLabelCache, logger)
 	modRuleStoreTestBed := NewModRuleStoreTestBed(modRuleStore)
 	return modRuleStoreTestBed
 }
@@ -29,9 +31,11 @@ func InitializeModRuleStoreTestBed(clusterModRulesNamespace ClusterModRulesNames
 // InitializeDragnetWebhookHandlerTestBed instructs wire how to construct a new test bed.
 func InitializeDragnetWebhookHandlerTestBed(clusterModRulesNamespace ClusterModRulesNamespace, tLogger util.TLogger) *DragnetWebhookHandlerTestBed {
 	language := expressions.NewKubeModJSONPathLanguage()
+	unavailableValueSourceResolver := NewUnavailableValueSourceResolver()
 	logger := NewTestLogger(tLogger)
-	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, logger)
-	modRuleStore := NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, logger)
+	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, unavailableValueSourceResolver, logger)
+	namespaceLabelCache := NewNamespaceLabelCache()
+	modRuleStore := NewModRuleStore(modRuleStoreItemFactory, clusterModRulesNamespace, namespaceLabelCache, logger)
 	testReporter := NewMockTestReporter(tLogger)
 	controller := NewGoMockController(testReporter)
 	mockClient := NewK8sMockClient(controller)
@@ -42,8 +46,9 @@ func InitializeDragnetWebhookHandlerTestBed(clusterModRulesNamespace ClusterModR
 // InitializeModRuleStoreItemTestBed instructs wire how to construct a new test bed.
 func InitializeModRuleStoreItemTestBed(tLogger util.TLogger) *ModRuleStoreItemTestBed {
 	language := expressions.NewKubeModJSONPathLanguage()
+	unavailableValueSourceResolver := NewUnavailableValueSourceResolver()
 	logger := NewTestLogger(tLogger)
-	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, logger)
+	modRuleStoreItemFactory := NewModRuleStoreItemFactory(language, unavailableValueSourceResolver, logger)
 	modRuleStoreItemTestBed := NewModRuleStoreItemTestBed(modRuleStoreItemFactory)
 	return modRuleStoreItemTestBed
 }
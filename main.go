@@ -20,6 +20,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -27,6 +28,7 @@ import (
 
 	apiv1beta1 "github.com/kubemod/kubemod/api/v1beta1"
 	"github.com/kubemod/kubemod/app"
+	"github.com/kubemod/kubemod/controllers"
 	"github.com/kubemod/kubemod/core"
 	// +kubebuilder:scaffold:imports
 )
@@ -44,8 +46,9 @@ func init() {
 
 // Config holds the application configuration settings.
 type Config struct {
-	RunOperator bool
-	RunWebApp   bool
+	RunOperator         bool
+	RunWebApp           bool
+	RunIdempotencyCheck bool
 
 	WebAppAddr               string
 	OperatorMetricsAddr      string
@@ -54,6 +57,14 @@ type Config struct {
 
 	EnableLeaderElection bool
 	EnableDevModeLog     bool
+
+	ModRuleStatsFlushInterval time.Duration
+	BackgroundApplyQPS        float64
+	AuditInterval             time.Duration
+	WarnNonIdempotentPatches  bool
+
+	IdempotencyCheckModRulesFile string
+	IdempotencyCheckResourceFile string
 }
 
 func main() {
@@ -62,6 +73,7 @@ func main() {
 
 	flag.BoolVar(&config.RunOperator, "operator", false, "Run KubeMod operator.")
 	flag.BoolVar(&config.RunWebApp, "webapp", false, "Run KubeMod web application.")
+	flag.BoolVar(&config.RunIdempotencyCheck, "check-idempotency", false, "Check the idempotency of the Patch ModRules in -modrules-file against the resource in -resource-file and exit.")
 
 	flag.StringVar(&config.WebAppAddr, "webapp-addr", ":8081", "The address the web app binds to.")
 	flag.StringVar(&config.OperatorMetricsAddr, "operator-metrics-addr", ":8082", "The address the operator metric endpoint binds to.")
@@ -69,8 +81,15 @@ func main() {
 	flag.StringVar(&config.ClusterModRulesNamespace, "cluster-modrules-namespace", "kubemod-system", "The namespace where cluster-wide ModRules are deployed.")
 	flag.BoolVar(&config.EnableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for KubeMod operator. "+
-			"Enabling this will ensure there is only one active controller manager.")
+			"Enabling this will ensure there is only one replica updating the status of ModRules and applying them to existing resources. "+
+			"Every replica loads the ModRules and serves admission requests regardless of leader election.")
 	flag.BoolVar(&config.EnableDevModeLog, "enable-dev-mode-log", false, "Enable development level logging.")
+	flag.DurationVar(&config.ModRuleStatsFlushInterval, "modrule-stats-flush-interval", 30*time.Second, "The interval at which ModRule runtime statistics are flushed to ModRule status.")
+	flag.Float64Var(&config.BackgroundApplyQPS, "background-apply-qps", 10, "The maximum number of existing resources per second evaluated by the background application of ModRules.")
+	flag.DurationVar(&config.AuditInterval, "audit-interval", 0, "The interval at which existing resources are audited against Reject ModRules. Zero disables the audit.")
+	flag.BoolVar(&config.WarnNonIdempotentPatches, "warn-non-idempotent-patches", false, "Warn API clients when the patch applied to their object would change it again on its next update.")
+	flag.StringVar(&config.IdempotencyCheckModRulesFile, "modrules-file", "", "The YAML file with the ModRules checked by -check-idempotency.")
+	flag.StringVar(&config.IdempotencyCheckResourceFile, "resource-file", "", "The YAML or JSON file with the resource manifest used by -check-idempotency.")
 
 	flag.Parse()
 
@@ -94,6 +113,17 @@ func run(config *Config) error {
 
 	setupLog := log.WithName("main-setup")
 
+	// The idempotency check is a one-off command - it runs instead of the operator and the web app.
+	if config.RunIdempotencyCheck {
+		_, err := app.InitializeKubeModIdempotencyCheckApp(
+			app.IdempotencyCheckModRulesFile(config.IdempotencyCheckModRulesFile),
+			app.IdempotencyCheckResourceFile(config.IdempotencyCheckResourceFile),
+			core.ClusterModRulesNamespace(config.ClusterModRulesNamespace),
+			log)
+
+		return err
+	}
+
 	// Start operator application.
 	wg.Add(1)
 
@@ -107,6 +137,10 @@ func run(config *Config) error {
 				app.OperatorHealthProbeAddr(config.OperatorHealthProbeAddr),
 				core.ClusterModRulesNamespace(config.ClusterModRulesNamespace),
 				app.EnableLeaderElection(config.EnableLeaderElection),
+				controllers.ModRuleStatsFlushInterval(config.ModRuleStatsFlushInterval),
+				controllers.BackgroundApplyQPS(config.BackgroundApplyQPS),
+				controllers.AuditInterval(config.AuditInterval),
+				core.WarnNonIdempotentPatches(config.WarnNonIdempotentPatches),
 				log)
 
 			if err != nil {